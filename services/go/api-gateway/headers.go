@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// hopByHopHeaders are connection-specific per RFC 7230 §6.1 and must not be
+// forwarded to the next hop as-is.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// identityHeaders are set by the gateway from a validated token; a client
+// must never be able to set them directly.
+var identityHeaders = []string{
+	"X-User-ID",
+	"X-User-Email",
+	"X-User-Role",
+}
+
+// stripHopByHopHeaders removes the standard hop-by-hop headers plus any
+// extra field names the Connection header lists for this request.
+func stripHopByHopHeaders(header http.Header) {
+	if conn := header.Get("Connection"); conn != "" {
+		for _, field := range strings.Split(conn, ",") {
+			header.Del(strings.TrimSpace(field))
+		}
+	}
+	for _, h := range hopByHopHeaders {
+		header.Del(h)
+	}
+}
+
+// stripInboundIdentityHeaders removes any X-User-*/X-Forwarded-* headers the
+// client may have set, so only values the gateway sets itself reach upstream.
+func stripInboundIdentityHeaders(header http.Header) {
+	for _, h := range identityHeaders {
+		header.Del(h)
+	}
+	for h := range header {
+		if strings.HasPrefix(h, "X-Forwarded-") {
+			header.Del(h)
+		}
+	}
+}
+
+// setForwardingHeaders appends the proxy-chain headers downstream services
+// rely on for identifying the original client and correlating logs across
+// services. original is the inbound request, since req (the outbound clone)
+// has already had its Host/RemoteAddr rewritten for the upstream.
+func setForwardingHeaders(req, original *http.Request) {
+	host, _, err := net.SplitHostPort(original.RemoteAddr)
+	if err != nil {
+		host = original.RemoteAddr
+	}
+	req.Header.Set("X-Forwarded-For", host)
+
+	proto := "http"
+	if original.TLS != nil {
+		proto = "https"
+	}
+	req.Header.Set("X-Forwarded-Proto", proto)
+	req.Header.Set("X-Forwarded-Host", original.Host)
+
+	requestID := original.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = generateRequestID()
+	}
+	req.Header.Set("X-Request-ID", requestID)
+}
+
+// generateRequestID returns a random 128-bit hex string for requests that
+// didn't already carry one in from an upstream caller.
+func generateRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
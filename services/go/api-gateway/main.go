@@ -13,49 +13,48 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/homeguard/api-gateway/pkg/breaker"
+	"github.com/homeguard/api-gateway/pkg/routeconfig"
+	"github.com/homeguard/api-gateway/pkg/wsproxy"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
-	"golang.org/x/time/rate"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Port                   string
-	JWTSecret              string
-	UserServiceURL         string
-	DeviceServiceURL       string
-	DeviceIngestURL        string
-	NotificationServiceURL string
-	AnalyticsServiceURL    string
-	AgenticAIURL           string
-	ScenarioEngineURL      string
-	RateLimitPerMinute     int
-	RateLimitBurst         int
-}
-
-// Claims represents JWT claims
-type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-// RateLimiter manages per-client rate limiting
-type RateLimiter struct {
-	limiters map[string]*rate.Limiter
-	mu       sync.RWMutex
-	r        rate.Limit
-	b        int
+	Port                     string
+	JWTSecret                string
+	UserServiceURL           string
+	DeviceIngestURL          string
+	NotificationServiceURL   string
+	RateLimitPerMinute       int
+	RateLimitBurst           int
+	DeviceRateLimitPerMinute int
+	DeviceRateLimitBurst     int
+	AuthRateLimitPerMinute   int
+	AuthRateLimitBurst       int
+	RateLimitRedisURL        string
+
+	RoutesConfigPath string
+
+	MaxRequestsInFlight     int
+	LongRunningMaxInFlight  int
+	LongRunningPathPatterns []string
+	RequestTimeout          time.Duration
+
+	OIDCIssuerURL       string
+	OIDCAudience        string
+	JWKSRefreshInterval time.Duration
 }
 
 // WebSocket upgrader
@@ -107,17 +106,29 @@ func init() {
 
 func loadConfig() *Config {
 	return &Config{
-		Port:                   getEnv("PORT", "8080"),
-		JWTSecret:              getEnv("JWT_SECRET", "homeguard-jwt-secret-change-in-production-2024-very-long-key"),
-		UserServiceURL:         getEnv("USER_SERVICE_URL", "http://user-service:8080"),
-		DeviceServiceURL:       getEnv("DEVICE_SERVICE_URL", "http://device-service:8080"),
-		DeviceIngestURL:        getEnv("DEVICE_INGEST_URL", "http://device-ingest:8080"),
-		NotificationServiceURL: getEnv("NOTIFICATION_SERVICE_URL", "http://notification-service:8080"),
-		AnalyticsServiceURL:    getEnv("ANALYTICS_SERVICE_URL", "http://analytics-service:8080"),
-		AgenticAIURL:           getEnv("AGENTIC_AI_URL", "http://agentic-ai:8080"),
-		ScenarioEngineURL:      getEnv("SCENARIO_ENGINE_URL", "http://scenario-engine:8080"),
-		RateLimitPerMinute:     getEnvInt("RATE_LIMIT_REQUESTS_PER_MINUTE", 100),
-		RateLimitBurst:         getEnvInt("RATE_LIMIT_BURST", 20),
+		Port:                     getEnv("PORT", "8080"),
+		JWTSecret:                getEnv("JWT_SECRET", "homeguard-jwt-secret-change-in-production-2024-very-long-key"),
+		UserServiceURL:           getEnv("USER_SERVICE_URL", "http://user-service:8080"),
+		DeviceIngestURL:          getEnv("DEVICE_INGEST_URL", "http://device-ingest:8080"),
+		NotificationServiceURL:   getEnv("NOTIFICATION_SERVICE_URL", "http://notification-service:8080"),
+		RateLimitPerMinute:       getEnvInt("RATE_LIMIT_REQUESTS_PER_MINUTE", 100),
+		RateLimitBurst:           getEnvInt("RATE_LIMIT_BURST", 20),
+		DeviceRateLimitPerMinute: getEnvInt("DEVICE_RATE_LIMIT_REQUESTS_PER_MINUTE", 1000),
+		DeviceRateLimitBurst:     getEnvInt("DEVICE_RATE_LIMIT_BURST", 100),
+		AuthRateLimitPerMinute:   getEnvInt("AUTH_RATE_LIMIT_REQUESTS_PER_MINUTE", 10),
+		AuthRateLimitBurst:       getEnvInt("AUTH_RATE_LIMIT_BURST", 5),
+		RateLimitRedisURL:        getEnv("RATE_LIMIT_REDIS_URL", ""),
+
+		RoutesConfigPath: getEnv("ROUTES_CONFIG_PATH", "routes.yaml"),
+
+		MaxRequestsInFlight:     getEnvInt("MAX_REQUESTS_IN_FLIGHT", 200),
+		LongRunningMaxInFlight:  getEnvInt("LONG_RUNNING_MAX_IN_FLIGHT", 50),
+		LongRunningPathPatterns: splitCSV(getEnv("LONG_RUNNING_PATH_PATTERNS", "/agent/stream,/activity/stream,/ws$")),
+		RequestTimeout:          time.Duration(getEnvInt("REQUEST_TIMEOUT_SECONDS", 30)) * time.Second,
+
+		OIDCIssuerURL:       getEnv("OIDC_ISSUER_URL", ""),
+		OIDCAudience:        getEnv("OIDC_AUDIENCE", ""),
+		JWKSRefreshInterval: time.Duration(getEnvInt("JWKS_REFRESH_INTERVAL_SECONDS", 300)) * time.Second,
 	}
 }
 
@@ -139,120 +150,181 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
-// NewRateLimiter creates a new rate limiter
-func NewRateLimiter(r rate.Limit, b int) *RateLimiter {
-	return &RateLimiter{
-		limiters: make(map[string]*rate.Limiter),
-		r:        r,
-		b:        b,
-	}
-}
-
-// GetLimiter returns a rate limiter for a given client
-func (rl *RateLimiter) GetLimiter(clientID string) *rate.Limiter {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	limiter, exists := rl.limiters[clientID]
-	if !exists {
-		limiter = rate.NewLimiter(rl.r, rl.b)
-		rl.limiters[clientID] = limiter
-	}
-	return limiter
-}
-
 // Gateway is the main API gateway struct
 type Gateway struct {
 	config      *Config
-	router      *mux.Router
-	rateLimiter *RateLimiter
+	router      atomic.Pointer[mux.Router]
+	rateLimiter Limiter
+	rateTiers   RateLimitTiers
+
+	breakersMu sync.Mutex
+	breakers   map[string]*breaker.Breaker
+
+	longRunningPatterns atomic.Pointer[[]*regexp.Regexp]
+	normalInFlight      chan struct{}
+	longRunningInFlight chan struct{}
+
+	verifier TokenVerifier
+
+	routes *routeconfig.Handler
 }
 
 // NewGateway creates a new API gateway
 func NewGateway(config *Config) *Gateway {
-	rateLimit := rate.Limit(float64(config.RateLimitPerMinute) / 60.0)
-	return &Gateway{
+	var verifier TokenVerifier
+	if config.OIDCIssuerURL != "" {
+		oidcVerifier, err := newJWKSVerifier(config.OIDCIssuerURL, config.OIDCAudience, config.JWKSRefreshInterval)
+		if err != nil {
+			log.Fatalf("Failed to initialize OIDC verifier: %v", err)
+		}
+		verifier = oidcVerifier
+	} else {
+		verifier = newHMACVerifier(config.JWTSecret)
+	}
+
+	g := &Gateway{
 		config:      config,
-		router:      mux.NewRouter(),
-		rateLimiter: NewRateLimiter(rateLimit, config.RateLimitBurst),
+		rateLimiter: newLimiter(config.RateLimitRedisURL),
+		rateTiers: RateLimitTiers{
+			Admin:  RateLimitTier{Name: "admin", Unlimited: true},
+			User:   RateLimitTier{Name: "user", RequestsPerMinute: config.RateLimitPerMinute, Burst: config.RateLimitBurst},
+			Device: RateLimitTier{Name: "device", RequestsPerMinute: config.DeviceRateLimitPerMinute, Burst: config.DeviceRateLimitBurst},
+			AuthIP: RateLimitTier{Name: "auth-ip", RequestsPerMinute: config.AuthRateLimitPerMinute, Burst: config.AuthRateLimitBurst},
+		},
+		breakers: make(map[string]*breaker.Breaker),
+
+		normalInFlight:      make(chan struct{}, config.MaxRequestsInFlight),
+		longRunningInFlight: make(chan struct{}, config.LongRunningMaxInFlight),
+
+		verifier: verifier,
 	}
+	patterns := compileLongRunningPatterns(config.LongRunningPathPatterns)
+	g.longRunningPatterns.Store(&patterns)
+	return g
 }
 
-// SetupRoutes configures all API routes
-func (g *Gateway) SetupRoutes() {
+// LoadRoutes (re)loads the declarative route config at path and rebuilds the
+// router from it, then atomically swaps it in. It's safe to call concurrently
+// with requests being served, and is what a SIGHUP reload invokes.
+func (g *Gateway) LoadRoutes(path string) error {
+	if g.routes == nil {
+		routes, err := routeconfig.NewHandler(path)
+		if err != nil {
+			return err
+		}
+		g.routes = routes
+	} else if err := g.routes.Reload(); err != nil {
+		return err
+	}
+
+	cfg := g.routes.Config()
+	patterns := compileLongRunningPatterns(append(append([]string{}, g.config.LongRunningPathPatterns...), longRunningRoutePatterns(cfg)...))
+	g.longRunningPatterns.Store(&patterns)
+
+	g.router.Store(g.buildRouter(cfg))
+	return nil
+}
+
+// longRunningRoutePatterns returns one pattern per route the config flags as
+// long-running, so the classifier picks them up alongside the env-configured
+// patterns without the operator having to list the same path twice.
+func longRunningRoutePatterns(cfg *routeconfig.Config) []string {
+	if cfg == nil {
+		return nil
+	}
+	var patterns []string
+	for _, route := range cfg.Routes {
+		if route.LongRunning {
+			patterns = append(patterns, route.Path)
+		}
+	}
+	return patterns
+}
+
+// buildRouter assembles the full router: the static infrastructure and
+// auth-special-cased endpoints that aren't expressible in the declarative
+// route config, plus the proxy routes the config describes.
+func (g *Gateway) buildRouter(cfg *routeconfig.Config) *mux.Router {
+	router := mux.NewRouter()
+
 	// Health check
-	g.router.HandleFunc("/health", g.healthCheck).Methods("GET")
-	g.router.HandleFunc("/ready", g.readinessCheck).Methods("GET")
+	router.HandleFunc("/health", g.healthCheck).Methods("GET")
+	router.HandleFunc("/ready", g.readinessCheck).Methods("GET")
 
 	// Metrics
-	g.router.Handle("/metrics", promhttp.Handler())
-
-	// Public routes (no auth) - support both /api and /api/v1 prefixes
-	g.router.HandleFunc("/api/auth/login", g.proxyHandler(g.config.UserServiceURL)).Methods("POST")
-	g.router.HandleFunc("/api/auth/register", g.proxyHandler(g.config.UserServiceURL)).Methods("POST")
-	g.router.HandleFunc("/api/auth/refresh", g.proxyHandler(g.config.UserServiceURL)).Methods("POST")
-	g.router.HandleFunc("/api/v1/auth/login", g.proxyHandler(g.config.UserServiceURL)).Methods("POST")
-	g.router.HandleFunc("/api/v1/auth/register", g.proxyHandler(g.config.UserServiceURL)).Methods("POST")
-	g.router.HandleFunc("/api/v1/auth/refresh", g.proxyHandler(g.config.UserServiceURL)).Methods("POST")
+	router.Handle("/metrics", promhttp.Handler())
+
+	// Public routes (no auth) - support both /api and /api/v1 prefixes. Rate
+	// limited per-IP on the strict auth-ip tier to blunt credential stuffing.
+	authRateLimit := g.rateLimitMiddleware
+	for _, prefix := range []string{"/api", "/api/v1"} {
+		router.Handle(prefix+"/auth/login", authRateLimit(g.proxyHandler(g.config.UserServiceURL))).Methods("POST")
+		router.Handle(prefix+"/auth/register", authRateLimit(g.proxyHandler(g.config.UserServiceURL))).Methods("POST")
+		router.Handle(prefix+"/auth/refresh", authRateLimit(g.proxyHandler(g.config.UserServiceURL))).Methods("POST")
+	}
 
-	// Device ingestion (device-token auth, not user JWT)
-	g.router.HandleFunc("/api/v1/ingest/{path:.*}", g.deviceAuthMiddleware(g.proxyHandler(g.config.DeviceIngestURL))).Methods("POST")
+	// Device ingestion (device-token auth, not user JWT), limited on the
+	// higher-throughput device tier.
+	router.Handle("/api/v1/ingest/{path:.*}",
+		g.deviceAuthMiddleware(g.rateLimitMiddleware(g.proxyHandler(g.config.DeviceIngestURL)).ServeHTTP)).Methods("POST")
 
 	// WebSocket routes - registered directly on main router to avoid middleware wrapping ResponseWriter
-	// These handlers do their own auth via Sec-WebSocket-Protocol header
-	g.router.HandleFunc("/api/activity/stream", g.activityStreamHandler).Methods("GET")
-	g.router.HandleFunc("/api/v1/activity/stream", g.activityStreamHandler).Methods("GET")
-
-	// Protected routes (require JWT) - support both /api and /api/v1 prefixes
-	apiV1 := g.router.PathPrefix("/api/v1").Subrouter()
-	apiV1.Use(g.authMiddleware)
-	apiV1.Use(g.rateLimitMiddleware)
-
-	api := g.router.PathPrefix("/api").Subrouter()
-	api.Use(g.authMiddleware)
-	api.Use(g.rateLimitMiddleware)
-
-	// Register routes for both prefixes
-	for _, r := range []*mux.Router{api, apiV1} {
-		// User routes
-		r.HandleFunc("/users/me", g.proxyHandler(g.config.UserServiceURL)).Methods("GET", "PUT")
-		r.HandleFunc("/users/{id}", g.proxyHandler(g.config.UserServiceURL)).Methods("GET")
-
-		// Device routes
-		r.HandleFunc("/devices", g.proxyHandler(g.config.DeviceServiceURL)).Methods("GET", "POST")
-		r.HandleFunc("/devices/{id}", g.proxyHandler(g.config.DeviceServiceURL)).Methods("GET", "PUT", "PATCH", "DELETE")
-		r.HandleFunc("/devices/{id}/command", g.proxyHandler(g.config.DeviceServiceURL)).Methods("POST")
-		r.HandleFunc("/devices/{id}/status", g.proxyHandler(g.config.DeviceServiceURL)).Methods("GET")
-		r.HandleFunc("/devices/{id}/events", g.proxyHandler(g.config.DeviceServiceURL)).Methods("GET")
-
-		// Notification routes
-		r.HandleFunc("/notifications", g.proxyHandler(g.config.NotificationServiceURL)).Methods("GET")
-		r.HandleFunc("/notifications/{id}/read", g.proxyHandler(g.config.NotificationServiceURL)).Methods("PUT")
-		r.HandleFunc("/notifications/preferences", g.proxyHandler(g.config.NotificationServiceURL)).Methods("GET", "PUT")
-
-		// Analytics routes
-		r.HandleFunc("/analytics/summary", g.proxyHandler(g.config.AnalyticsServiceURL)).Methods("GET")
-		r.HandleFunc("/analytics/devices/{id}", g.proxyHandler(g.config.AnalyticsServiceURL)).Methods("GET")
-		r.HandleFunc("/analytics/trends", g.proxyHandler(g.config.AnalyticsServiceURL)).Methods("GET")
-
-		// AI Agent routes
-		r.HandleFunc("/agent/chat", g.proxyHandler(g.config.AgenticAIURL)).Methods("POST")
-		r.HandleFunc("/agent/stream", g.proxyHandler(g.config.AgenticAIURL)).Methods("POST")
-		r.HandleFunc("/agent/history", g.proxyHandler(g.config.AgenticAIURL)).Methods("GET", "DELETE")
-		r.HandleFunc("/agent/suggestions", g.proxyHandler(g.config.AgenticAIURL)).Methods("GET")
-
-		// Scenario/Automation routes
-		r.HandleFunc("/scenarios", g.proxyHandler(g.config.ScenarioEngineURL)).Methods("GET", "POST")
-		r.HandleFunc("/scenarios/{id}", g.proxyHandler(g.config.ScenarioEngineURL)).Methods("GET", "PUT", "DELETE")
-		r.HandleFunc("/scenarios/{id}/enable", g.proxyHandler(g.config.ScenarioEngineURL)).Methods("POST")
-		r.HandleFunc("/scenarios/{id}/disable", g.proxyHandler(g.config.ScenarioEngineURL)).Methods("POST")
-
-		// Activity stream routes (non-WebSocket)
-		r.HandleFunc("/activity/recent", g.proxyHandler(g.config.NotificationServiceURL)).Methods("GET")
-
-		// General WebSocket endpoint
-		r.HandleFunc("/ws", g.websocketHandler).Methods("GET")
-		// Note: /activity/stream is registered directly on main router to avoid middleware ResponseWriter wrapping
+	// These handlers do their own auth via Sec-WebSocket-Protocol header, and are
+	// long-running by nature so they get the in-flight middleware applied directly
+	// rather than through a subrouter.
+	router.Handle("/api/activity/stream", g.maxInFlightMiddleware(http.HandlerFunc(g.activityStreamHandler))).Methods("GET")
+	router.Handle("/api/v1/activity/stream", g.maxInFlightMiddleware(http.HandlerFunc(g.activityStreamHandler))).Methods("GET")
+
+	for _, prefix := range []string{"/api", "/api/v1"} {
+		router.Handle(prefix+"/ws", g.maxInFlightMiddleware(g.rateLimitMiddleware(g.authMiddleware(http.HandlerFunc(g.websocketHandler))))).Methods("GET")
+	}
+
+	g.registerDeclarativeRoutes(router, cfg)
+
+	return router
+}
+
+// registerDeclarativeRoutes registers every route the config declares, under
+// both the /api and /api/v1 prefixes, resolving its upstream by name and
+// composing middleware according to its auth mode.
+func (g *Gateway) registerDeclarativeRoutes(router *mux.Router, cfg *routeconfig.Config) {
+	if cfg == nil {
+		return
+	}
+
+	for _, route := range cfg.Routes {
+		upstreamURL := cfg.UpstreamURL(route.Upstream)
+		if upstreamURL == "" {
+			log.Printf("Skipping route %s: unknown upstream %q", route.Path, route.Upstream)
+			continue
+		}
+
+		methods := route.Methods
+		if len(methods) == 0 {
+			methods = []string{"GET"}
+		}
+
+		handler := g.declarativeRouteHandler(route, upstreamURL)
+		for _, prefix := range []string{"/api", "/api/v1"} {
+			router.Handle(prefix+route.Path, handler).Methods(methods...)
+		}
+	}
+}
+
+// declarativeRouteHandler builds the handler chain for one config-declared
+// route according to its auth mode.
+func (g *Gateway) declarativeRouteHandler(route routeconfig.Route, upstreamURL string) http.Handler {
+	proxy := g.proxyHandler(upstreamURL)
+
+	rateLimit := g.rateLimitMiddlewareForBucket(route.RateLimitBucket)
+
+	switch route.Auth {
+	case routeconfig.AuthDeviceToken:
+		return g.deviceAuthMiddleware(rateLimit(proxy).ServeHTTP)
+	case routeconfig.AuthJWT:
+		return g.maxInFlightMiddleware(rateLimit(g.authMiddleware(proxy)))
+	default:
+		return proxy
 	}
 }
 
@@ -264,8 +336,12 @@ func (g *Gateway) healthCheck(w http.ResponseWriter, r *http.Request) {
 func (g *Gateway) readinessCheck(w http.ResponseWriter, r *http.Request) {
 	// Check downstream services
 	services := map[string]string{
-		"user-service":   g.config.UserServiceURL,
-		"device-service": g.config.DeviceServiceURL,
+		"user-service": g.config.UserServiceURL,
+	}
+	if cfg := g.routes.Config(); cfg != nil {
+		for _, u := range cfg.Upstreams {
+			services[u.Name] = u.URL
+		}
 	}
 
 	allReady := true
@@ -284,13 +360,24 @@ func (g *Gateway) readinessCheck(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	degradedUpstreams := make(map[string]string)
+	g.breakersMu.Lock()
+	for upstream, brk := range g.breakers {
+		if state := brk.State(); state != breaker.Closed {
+			degradedUpstreams[upstream] = state.String()
+			allReady = false
+		}
+	}
+	g.breakersMu.Unlock()
+
 	w.Header().Set("Content-Type", "application/json")
 	if !allReady {
 		w.WriteHeader(http.StatusServiceUnavailable)
 	}
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"ready":    allReady,
-		"services": status,
+		"ready":              allReady,
+		"services":           status,
+		"degraded_upstreams": degradedUpstreams,
 	})
 }
 
@@ -326,29 +413,20 @@ func (g *Gateway) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(g.config.JWTSecret), nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := g.verifier.Verify(tokenString)
+		if err != nil {
 			g.errorResponse(w, http.StatusUnauthorized, "Invalid or expired token")
 			return
 		}
 
-		// Add user info to request context
+		// Add user info to request context. The X-User-* headers downstream
+		// services see are set later, from this context, once proxyHandler's
+		// Director has stripped whatever the client sent for those names -
+		// setting them here would just be overwritten again there.
 		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
 		ctx = context.WithValue(ctx, "user_email", claims.Email)
 		ctx = context.WithValue(ctx, "user_role", claims.Role)
 
-		// Add user info to headers for downstream services
-		r.Header.Set("X-User-ID", claims.UserID)
-		r.Header.Set("X-User-Email", claims.Email)
-		r.Header.Set("X-User-Role", claims.Role)
-
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -365,22 +443,84 @@ func (g *Gateway) deviceAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func (g *Gateway) rateLimitMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		clientID := r.Header.Get("X-User-ID")
-		if clientID == "" {
-			clientID = r.RemoteAddr
+// rateLimitKeyAndTier picks the rate limit bucket key and tier for a
+// request: authenticated requests are limited per user by role, device
+// requests are limited per device token, and everything else (the public
+// auth routes) falls back to a strict per-IP bucket to blunt credential
+// stuffing.
+func (g *Gateway) rateLimitKeyAndTier(r *http.Request) (string, RateLimitTier) {
+	if role, _ := r.Context().Value("user_role").(string); role != "" {
+		userID, _ := r.Context().Value("user_id").(string)
+		if role == "admin" {
+			return "user:" + userID, g.rateTiers.Admin
 		}
+		return "user:" + userID, g.rateTiers.User
+	}
+	if token := r.Header.Get("X-Device-Token"); token != "" {
+		return "device:" + token, g.rateTiers.Device
+	}
 
-		limiter := g.rateLimiter.GetLimiter(clientID)
-		if !limiter.Allow() {
-			g.errorResponse(w, http.StatusTooManyRequests, "Rate limit exceeded")
-			return
-		}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host, g.rateTiers.AuthIP
+}
+
+// enforceRateLimit runs tier's policy for key, sets the X-RateLimit-* and
+// (when rejected) Retry-After response headers, and either forwards to next
+// or returns 429. A Limiter error (e.g. Redis unreachable) fails open so a
+// backend outage degrades to no rate limiting rather than blocking traffic.
+func (g *Gateway) enforceRateLimit(w http.ResponseWriter, r *http.Request, next http.Handler, key string, tier RateLimitTier) {
+	decision, err := g.rateLimiter.Allow(r.Context(), key, tier)
+	if err != nil {
+		log.Printf("Rate limiter error for tier %s: %v - allowing request", tier.Name, err)
 		next.ServeHTTP(w, r)
+		return
+	}
+
+	if !tier.Unlimited {
+		w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", decision.Limit))
+		w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", decision.Remaining))
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", decision.ResetAt.Unix()))
+	}
+
+	if !decision.Allowed {
+		retryAfter := int(time.Until(decision.ResetAt).Seconds())
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+		g.errorResponse(w, http.StatusTooManyRequests, "Rate limit exceeded")
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// rateLimitMiddleware enforces the tier selected by role/device-token/IP.
+func (g *Gateway) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, tier := g.rateLimitKeyAndTier(r)
+		g.enforceRateLimit(w, r, next, key, tier)
 	})
 }
 
+// rateLimitMiddlewareForBucket is like rateLimitMiddleware, but a non-empty
+// bucket overrides the normally-selected tier - letting a declarative route
+// pin itself to a stricter (or looser) policy via rate_limit_bucket.
+func (g *Gateway) rateLimitMiddlewareForBucket(bucket string) func(http.Handler) http.Handler {
+	override, hasOverride := g.rateTiers.byName(bucket)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, tier := g.rateLimitKeyAndTier(r)
+			if hasOverride {
+				tier = override
+			}
+			g.enforceRateLimit(w, r, next, key, tier)
+		})
+	}
+}
+
 func (g *Gateway) proxyHandler(targetURL string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		target, err := url.Parse(targetURL)
@@ -389,23 +529,37 @@ func (g *Gateway) proxyHandler(targetURL string) http.HandlerFunc {
 			return
 		}
 
+		brk := g.breakerFor(targetURL)
+		allowed, probe := brk.Allow()
+		g.recordBreakerState(targetURL, brk)
+		if !allowed {
+			g.errorResponse(w, http.StatusServiceUnavailable, "Upstream temporarily unavailable")
+			return
+		}
+		defer g.recordBreakerState(targetURL, brk)
+
 		proxy := httputil.NewSingleHostReverseProxy(target)
 
-		// Use a longer timeout transport for all proxied requests
-		proxy.Transport = &http.Transport{
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-			ResponseHeaderTimeout: 120 * time.Second, // Wait up to 2 min for AI response
+		// Use a longer timeout transport for all proxied requests, wrapped
+		// with bounded retries for idempotent methods that also feed the
+		// upstream's circuit breaker.
+		proxy.Transport = &retryingTransport{
+			base: &http.Transport{
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				MaxIdleConns:          100,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+				ResponseHeaderTimeout: 120 * time.Second, // Wait up to 2 min for AI response
+			},
+			brk: brk,
 		}
 
 		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-			log.Printf("Proxy error: %v", err)
+			log.Printf("Proxy error for %s: %v", targetURL, err)
 			g.errorResponse(w, http.StatusBadGateway, "Service unavailable")
 		}
 
@@ -422,6 +576,27 @@ func (g *Gateway) proxyHandler(targetURL string) http.HandlerFunc {
 			} else if strings.HasPrefix(path, "/api/") {
 				req.URL.Path = strings.TrimPrefix(path, "/api")
 			}
+
+			stripHopByHopHeaders(req.Header)
+			stripInboundIdentityHeaders(req.Header)
+
+			// Re-set the identity headers from the validated token context
+			// (if any) rather than trusting whatever the client sent.
+			if userID, ok := r.Context().Value("user_id").(string); ok && userID != "" {
+				req.Header.Set("X-User-ID", userID)
+				if email, ok := r.Context().Value("user_email").(string); ok {
+					req.Header.Set("X-User-Email", email)
+				}
+				if role, ok := r.Context().Value("user_role").(string); ok {
+					req.Header.Set("X-User-Role", role)
+				}
+			}
+
+			setForwardingHeaders(req, r)
+		}
+
+		if probe {
+			r = r.WithContext(context.WithValue(r.Context(), probeContextKey{}, true))
 		}
 
 		proxy.ServeHTTP(w, r)
@@ -446,36 +621,24 @@ func (g *Gateway) websocketHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// activityStreamSubprotocols are the subprotocols this endpoint will
+// negotiate with a client, in preference order. They describe the wire
+// format of events on the stream; authentication is a standard Authorization
+// header, not the subprotocol slot.
+var activityStreamSubprotocols = []string{"activity.json.v1", "activity.msgpack.v1", "bearer.jwt.v1"}
+
 // activityStreamHandler proxies WebSocket connections to the notification service activity stream
 // This handler does its own auth because it's registered directly on the main router to avoid ResponseWriter wrapping
 func (g *Gateway) activityStreamHandler(w http.ResponseWriter, r *http.Request) {
-	// Authenticate via Sec-WebSocket-Protocol header (browser WebSocket sends token as subprotocol)
-	wsProtocol := r.Header.Get("Sec-WebSocket-Protocol")
-	if wsProtocol == "" {
-		g.errorResponse(w, http.StatusUnauthorized, "Missing authentication")
+	authHeader := r.Header.Get("Authorization")
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == "" || tokenString == authHeader {
+		g.errorResponse(w, http.StatusUnauthorized, "Missing authorization header")
 		return
 	}
 
-	// Parse "Bearer, <token>" format
-	var tokenString string
-	parts := strings.Split(wsProtocol, ", ")
-	if len(parts) == 2 && parts[0] == "Bearer" {
-		tokenString = parts[1]
-	}
-	if tokenString == "" {
-		g.errorResponse(w, http.StatusUnauthorized, "Invalid authentication format")
-		return
-	}
-
-	// Validate JWT token
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(g.config.JWTSecret), nil
-	})
-	if err != nil || !token.Valid {
+	claims, err := g.verifier.Verify(tokenString)
+	if err != nil {
 		g.errorResponse(w, http.StatusUnauthorized, "Invalid or expired token")
 		return
 	}
@@ -501,17 +664,13 @@ func (g *Gateway) activityStreamHandler(w http.ResponseWriter, r *http.Request)
 
 	// IMPORTANT: Upgrade client connection FIRST before any other operations
 	// The http.ResponseWriter must not be used before upgrading, otherwise Hijacker fails
-	// For subprotocol auth, browser sends "Bearer, <token>" but we must respond with just "Bearer"
-	var responseHeader http.Header
-	if wsProtocol := r.Header.Get("Sec-WebSocket-Protocol"); wsProtocol != "" {
-		responseHeader = http.Header{}
-		// Only respond with the protocol name, not the token
-		parts := strings.Split(wsProtocol, ", ")
-		if len(parts) >= 1 {
-			responseHeader.Set("Sec-WebSocket-Protocol", parts[0])
-		}
+	activityUpgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    activityStreamSubprotocols,
+		CheckOrigin:     upgrader.CheckOrigin,
 	}
-	clientConn, err := upgrader.Upgrade(w, r, responseHeader)
+	clientConn, err := activityUpgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Client WebSocket upgrade error: %v", err)
 		return
@@ -530,49 +689,17 @@ func (g *Gateway) activityStreamHandler(w http.ResponseWriter, r *http.Request)
 		} else {
 			log.Printf("Backend WebSocket connection failed: %v", err)
 		}
-		clientConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "Failed to connect to activity stream"))
+		clientConn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "failed to connect to activity stream"),
+			time.Now().Add(wsproxy.DefaultOptions().WriteWait))
 		return
 	}
 	defer backendConn.Close()
 
-	log.Printf("[ACTIVITY] WebSocket connection established for user %s", userID)
-
-	// Proxy messages between client and backend
-	done := make(chan struct{})
-
-	// Backend to client
-	go func() {
-		defer close(done)
-		for {
-			messageType, message, err := backendConn.ReadMessage()
-			if err != nil {
-				log.Printf("[ACTIVITY] Backend read error: %v", err)
-				return
-			}
-			if err := clientConn.WriteMessage(messageType, message); err != nil {
-				log.Printf("[ACTIVITY] Client write error: %v", err)
-				return
-			}
-		}
-	}()
+	log.Printf("[ACTIVITY] WebSocket connection established for user %s (subprotocol=%q)", userID, clientConn.Subprotocol())
 
-	// Client to backend (for pings/pongs)
-	go func() {
-		for {
-			messageType, message, err := clientConn.ReadMessage()
-			if err != nil {
-				log.Printf("[ACTIVITY] Client read error: %v", err)
-				backendConn.Close()
-				return
-			}
-			if err := backendConn.WriteMessage(messageType, message); err != nil {
-				log.Printf("[ACTIVITY] Backend write error: %v", err)
-				return
-			}
-		}
-	}()
+	wsproxy.Run(clientConn, backendConn, wsproxy.DefaultOptions(), "activity:"+userID)
 
-	<-done
 	log.Printf("[ACTIVITY] WebSocket connection closed for user %s", userID)
 }
 
@@ -624,12 +751,34 @@ func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return nil, nil, fmt.Errorf("underlying ResponseWriter does not implement http.Hijacker")
 }
 
+// ServeHTTP dispatches to the currently active router, so a route reload
+// swapped in mid-flight is picked up by the very next request.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.router.Load().ServeHTTP(w, r)
+}
+
 func main() {
 	log.Println("Starting HomeGuard API Gateway...")
 
 	config := loadConfig()
 	gateway := NewGateway(config)
-	gateway.SetupRoutes()
+	if err := gateway.LoadRoutes(config.RoutesConfigPath); err != nil {
+		log.Fatalf("Failed to load route config from %s: %v", config.RoutesConfigPath, err)
+	}
+
+	// SIGHUP triggers a hot reload of the route config without a restart
+	go func() {
+		sighupChan := make(chan os.Signal, 1)
+		signal.Notify(sighupChan, syscall.SIGHUP)
+		for range sighupChan {
+			log.Println("Received SIGHUP, reloading route config...")
+			if err := gateway.LoadRoutes(config.RoutesConfigPath); err != nil {
+				log.Printf("Route config reload failed, keeping previous routes: %v", err)
+				continue
+			}
+			log.Println("Route config reloaded")
+		}
+	}()
 
 	// Setup CORS
 	c := cors.New(cors.Options{
@@ -641,7 +790,7 @@ func main() {
 	})
 
 	// Wrap router with CORS and metrics
-	handler := c.Handler(metricsMiddleware(gateway.router))
+	handler := c.Handler(metricsMiddleware(gateway))
 
 	server := &http.Server{
 		Addr:         ":" + config.Port,
@@ -0,0 +1,149 @@
+// Package breaker implements a per-upstream circuit breaker with the usual
+// closed/open/half-open state machine, tripped by a rolling failure ratio
+// rather than a single bad response.
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State is one of the three circuit states.
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Config controls when a Breaker trips and how long it stays open before
+// allowing a probe request through.
+type Config struct {
+	// WindowSize is how many recent outcomes are tracked for the failure ratio.
+	WindowSize int
+	// MinRequests is the minimum outcomes needed in the window before the
+	// ratio is evaluated, so one failed request doesn't trip an idle breaker.
+	MinRequests int
+	// FailureRatio is the fraction of failures in the window that trips the breaker.
+	FailureRatio float64
+	// CooldownPeriod is how long Open is held before a half-open probe is allowed.
+	CooldownPeriod time.Duration
+}
+
+// DefaultConfig is a reasonable starting point for an internal HTTP upstream.
+func DefaultConfig() Config {
+	return Config{
+		WindowSize:     20,
+		MinRequests:    5,
+		FailureRatio:   0.5,
+		CooldownPeriod: 30 * time.Second,
+	}
+}
+
+// Breaker tracks a rolling window of outcomes for one upstream and decides
+// whether a request may proceed.
+type Breaker struct {
+	cfg Config
+
+	mu            sync.Mutex
+	state         State
+	outcomes      []bool
+	pos           int
+	count         int
+	openedAt      time.Time
+	probeInFlight bool
+}
+
+// New creates a Breaker starting in the closed state.
+func New(cfg Config) *Breaker {
+	return &Breaker{cfg: cfg, outcomes: make([]bool, cfg.WindowSize)}
+}
+
+// Allow reports whether a request may proceed. probe is true when this is
+// the single half-open request allowed through while the breaker is open;
+// callers should treat its outcome as decisive and not retry it internally.
+func (b *Breaker) Allow() (allowed bool, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.cfg.CooldownPeriod || b.probeInFlight {
+			return false, false
+		}
+		b.state = HalfOpen
+		b.probeInFlight = true
+		return true, true
+	case HalfOpen:
+		return false, false
+	default:
+		return true, false
+	}
+}
+
+// Record reports the outcome of a request Allow permitted.
+func (b *Breaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == HalfOpen {
+		b.probeInFlight = false
+		if success {
+			b.reset()
+		} else {
+			b.trip()
+		}
+		return
+	}
+
+	b.outcomes[b.pos] = success
+	b.pos = (b.pos + 1) % len(b.outcomes)
+	if b.count < len(b.outcomes) {
+		b.count++
+	}
+
+	if b.count >= b.cfg.MinRequests && b.failureRatio() >= b.cfg.FailureRatio {
+		b.trip()
+	}
+}
+
+func (b *Breaker) failureRatio() float64 {
+	failures := 0
+	for i := 0; i < b.count; i++ {
+		if !b.outcomes[i] {
+			failures++
+		}
+	}
+	return float64(failures) / float64(b.count)
+}
+
+func (b *Breaker) trip() {
+	b.state = Open
+	b.openedAt = time.Now()
+	b.probeInFlight = false
+}
+
+func (b *Breaker) reset() {
+	b.state = Closed
+	b.count = 0
+	b.pos = 0
+}
+
+// State returns the breaker's current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
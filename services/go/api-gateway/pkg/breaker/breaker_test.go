@@ -0,0 +1,103 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerStaysClosedBelowMinRequests(t *testing.T) {
+	b := New(Config{WindowSize: 10, MinRequests: 5, FailureRatio: 0.5, CooldownPeriod: time.Minute})
+
+	for i := 0; i < 4; i++ {
+		if allowed, probe := b.Allow(); !allowed || probe {
+			t.Fatalf("Allow() = %v, %v, want true, false while closed", allowed, probe)
+		}
+		b.Record(false)
+	}
+
+	if got := b.State(); got != Closed {
+		t.Errorf("State() = %v, want %v (below MinRequests, breaker shouldn't trip)", got, Closed)
+	}
+}
+
+func TestBreakerTripsAtFailureRatio(t *testing.T) {
+	b := New(Config{WindowSize: 10, MinRequests: 4, FailureRatio: 0.5, CooldownPeriod: time.Minute})
+
+	b.Record(true)
+	b.Record(true)
+	b.Record(false)
+	b.Record(false)
+
+	if got := b.State(); got != Open {
+		t.Fatalf("State() = %v, want %v after hitting the failure ratio", got, Open)
+	}
+
+	if allowed, _ := b.Allow(); allowed {
+		t.Error("Allow() = true while open and within the cooldown period")
+	}
+}
+
+func TestBreakerAllowsSingleProbeAfterCooldown(t *testing.T) {
+	b := New(Config{WindowSize: 10, MinRequests: 2, FailureRatio: 0.5, CooldownPeriod: 10 * time.Millisecond})
+
+	b.Record(false)
+	b.Record(false)
+	if got := b.State(); got != Open {
+		t.Fatalf("State() = %v, want %v", got, Open)
+	}
+
+	time.Sleep(15 * time.Millisecond)
+
+	allowed, probe := b.Allow()
+	if !allowed || !probe {
+		t.Fatalf("Allow() after cooldown = %v, %v, want true, true (the half-open probe)", allowed, probe)
+	}
+
+	// A second caller must not get a concurrent probe while one is in flight.
+	if allowed, probe := b.Allow(); allowed || probe {
+		t.Errorf("second Allow() while a probe is in flight = %v, %v, want false, false", allowed, probe)
+	}
+}
+
+func TestBreakerProbeSuccessResets(t *testing.T) {
+	b := New(Config{WindowSize: 10, MinRequests: 2, FailureRatio: 0.5, CooldownPeriod: 10 * time.Millisecond})
+
+	b.Record(false)
+	b.Record(false)
+	time.Sleep(15 * time.Millisecond)
+
+	allowed, probe := b.Allow()
+	if !allowed || !probe {
+		t.Fatalf("Allow() after cooldown = %v, %v, want true, true", allowed, probe)
+	}
+	b.Record(true)
+
+	if got := b.State(); got != Closed {
+		t.Errorf("State() after a successful probe = %v, want %v", got, Closed)
+	}
+
+	if allowed, probe := b.Allow(); !allowed || probe {
+		t.Errorf("Allow() after reset = %v, %v, want true, false", allowed, probe)
+	}
+}
+
+func TestBreakerProbeFailureReopens(t *testing.T) {
+	b := New(Config{WindowSize: 10, MinRequests: 2, FailureRatio: 0.5, CooldownPeriod: 10 * time.Millisecond})
+
+	b.Record(false)
+	b.Record(false)
+	time.Sleep(15 * time.Millisecond)
+
+	allowed, probe := b.Allow()
+	if !allowed || !probe {
+		t.Fatalf("Allow() after cooldown = %v, %v, want true, true", allowed, probe)
+	}
+	b.Record(false)
+
+	if got := b.State(); got != Open {
+		t.Errorf("State() after a failed probe = %v, want %v", got, Open)
+	}
+	if allowed, _ := b.Allow(); allowed {
+		t.Error("Allow() immediately after a failed probe = true, want false (cooldown restarted)")
+	}
+}
@@ -0,0 +1,169 @@
+// Package wsproxy implements a generic bidirectional WebSocket proxy: it
+// copies frames between an already-upgraded client connection and a dialed
+// backend connection, applying read/write deadlines, ping/pong keepalive,
+// and a bounded, drop-oldest outbound queue so a slow client can't stall the
+// backend reader indefinitely.
+package wsproxy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var droppedMessages = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_gateway_wsproxy_dropped_messages_total",
+		Help: "Total number of outbound WebSocket messages dropped for a slow client, by connection label",
+	},
+	[]string{"label"},
+)
+
+func init() {
+	prometheus.MustRegister(droppedMessages)
+}
+
+// Options configures connection timing and the outbound backpressure queue.
+type Options struct {
+	// ReadLimit caps the size of a single inbound message from the client.
+	ReadLimit int64
+	// PongWait is how long a client has to respond to a ping before it's
+	// considered dead. Pings go out at 9/10 of this interval.
+	PongWait time.Duration
+	// WriteWait bounds how long a single write to the client may take.
+	WriteWait time.Duration
+	// QueueSize is how many backend messages can be buffered for a slow
+	// client before the oldest one is dropped to make room for the newest.
+	QueueSize int
+}
+
+// DefaultOptions matches the gorilla/websocket recommended chat-example
+// timing, with a modestly sized outbound queue.
+func DefaultOptions() Options {
+	return Options{
+		ReadLimit: 32 * 1024,
+		PongWait:  60 * time.Second,
+		WriteWait: 10 * time.Second,
+		QueueSize: 64,
+	}
+}
+
+func (o Options) pingPeriod() time.Duration {
+	return (o.PongWait * 9) / 10
+}
+
+// NegotiateSubprotocol returns the first entry of offered (in preference
+// order) that r's Sec-WebSocket-Protocol header also lists, or "" if none
+// match. Pass the result to websocket.Upgrader.Subprotocols.
+func NegotiateSubprotocol(r *http.Request, offered []string) string {
+	requested := websocket.Subprotocols(r)
+	for _, candidate := range offered {
+		for _, want := range requested {
+			if candidate == want {
+				return candidate
+			}
+		}
+	}
+	return ""
+}
+
+type message struct {
+	messageType int
+	data        []byte
+}
+
+// Run proxies messages between an already-upgraded client connection and a
+// dialed backend connection until either side closes or errors, then closes
+// both ends. label identifies the connection in the dropped-message metric.
+// Run blocks until the session ends.
+func Run(client, backend *websocket.Conn, opts Options, label string) {
+	outbound := make(chan message, opts.QueueSize)
+	backendDone := make(chan struct{})
+
+	client.SetReadLimit(opts.ReadLimit)
+	client.SetReadDeadline(time.Now().Add(opts.PongWait))
+	client.SetPongHandler(func(string) error {
+		client.SetReadDeadline(time.Now().Add(opts.PongWait))
+		return nil
+	})
+
+	// backend -> outbound queue, drop-oldest on overflow
+	go func() {
+		defer close(backendDone)
+		for {
+			messageType, data, err := backend.ReadMessage()
+			if err != nil {
+				return
+			}
+			enqueue(outbound, message{messageType, data}, label)
+		}
+	}()
+
+	// outbound queue -> client, plus ping keepalive
+	writeDone := make(chan struct{})
+	go func() {
+		defer close(writeDone)
+		ticker := time.NewTicker(opts.pingPeriod())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-backendDone:
+				client.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, "backend connection closed"),
+					time.Now().Add(opts.WriteWait))
+				return
+			case msg, ok := <-outbound:
+				if !ok {
+					return
+				}
+				client.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+				if err := client.WriteMessage(msg.messageType, msg.data); err != nil {
+					return
+				}
+			case <-ticker.C:
+				client.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+				if err := client.WriteMessage(websocket.PingMessage, nil); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	// client -> backend, direct: the backend is a trusted internal service,
+	// so there's no need to buffer or drop on this side.
+	for {
+		messageType, data, err := client.ReadMessage()
+		if err != nil {
+			break
+		}
+		backend.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+		if err := backend.WriteMessage(messageType, data); err != nil {
+			break
+		}
+	}
+
+	backend.Close()
+	<-writeDone
+}
+
+// enqueue buffers msg for the client, dropping the oldest queued message
+// (and counting it) if the queue is already full.
+func enqueue(outbound chan message, msg message, label string) {
+	select {
+	case outbound <- msg:
+		return
+	default:
+	}
+
+	select {
+	case <-outbound:
+	default:
+	}
+	select {
+	case outbound <- msg:
+	default:
+	}
+	droppedMessages.WithLabelValues(label).Inc()
+}
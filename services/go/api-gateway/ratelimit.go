@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitTier is a named rate limit policy: a requests-per-minute rate
+// plus burst, or Unlimited for roles (admin) that bypass limiting entirely.
+type RateLimitTier struct {
+	Name              string
+	RequestsPerMinute int
+	Burst             int
+	Unlimited         bool
+}
+
+// RateLimitTiers are the gateway's configured policies, selected per request
+// by role (or, for unauthenticated requests, by IP).
+type RateLimitTiers struct {
+	Admin  RateLimitTier
+	User   RateLimitTier
+	Device RateLimitTier
+	AuthIP RateLimitTier
+}
+
+// byName returns the tier named name, or ok=false if there's no such tier -
+// used to resolve a route's configured rate_limit_bucket override.
+func (t RateLimitTiers) byName(name string) (RateLimitTier, bool) {
+	switch name {
+	case t.Admin.Name:
+		return t.Admin, true
+	case t.User.Name:
+		return t.User, true
+	case t.Device.Name:
+		return t.Device, true
+	case t.AuthIP.Name:
+		return t.AuthIP, true
+	default:
+		return RateLimitTier{}, false
+	}
+}
+
+// RateLimitDecision is the outcome of one Allow call, carrying everything
+// needed to populate the X-RateLimit-* response headers.
+type RateLimitDecision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// Limiter enforces a RateLimitTier's policy against a key (a user ID, device
+// token, or IP address). Implementations must be safe for concurrent use.
+type Limiter interface {
+	Allow(ctx context.Context, key string, tier RateLimitTier) (RateLimitDecision, error)
+}
+
+// inMemoryLimiter is a per-process token bucket limiter, one bucket per
+// (tier, key) pair. It's accurate only within a single gateway replica - two
+// replicas each let a client through up to the configured limit, so the
+// effective limit scales with replica count.
+type inMemoryLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newInMemoryLimiter() *inMemoryLimiter {
+	return &inMemoryLimiter{limiters: make(map[string]*rate.Limiter)}
+}
+
+func (l *inMemoryLimiter) Allow(ctx context.Context, key string, tier RateLimitTier) (RateLimitDecision, error) {
+	if tier.Unlimited {
+		return RateLimitDecision{Allowed: true, Limit: -1, Remaining: -1}, nil
+	}
+
+	bucketKey := tier.Name + ":" + key
+	l.mu.Lock()
+	limiter, ok := l.limiters[bucketKey]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(float64(tier.RequestsPerMinute)/60.0), tier.Burst)
+		l.limiters[bucketKey] = limiter
+	}
+	l.mu.Unlock()
+
+	now := time.Now()
+	allowed := limiter.AllowN(now, 1)
+	remaining := int(limiter.TokensAt(now))
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	resetAt := now
+	if remaining == 0 && limiter.Limit() > 0 {
+		resetAt = now.Add(time.Duration(float64(time.Second) / float64(limiter.Limit())))
+	}
+
+	return RateLimitDecision{
+		Allowed:   allowed,
+		Limit:     tier.RequestsPerMinute,
+		Remaining: remaining,
+		ResetAt:   resetAt,
+	}, nil
+}
+
+// slidingWindowScript atomically increments the counter for a fixed window
+// (keyed by tier+key+window start) and sets its expiry on first use, so
+// concurrent requests across every gateway replica share one true count
+// instead of each replica under-counting against its own in-memory bucket.
+var slidingWindowScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// redisLimiter is a distributed fixed-window counter shared across every
+// gateway replica, backed by go-redis and the Lua script above so the
+// increment-and-expire is atomic.
+type redisLimiter struct {
+	client *redis.Client
+}
+
+func newRedisLimiter(client *redis.Client) *redisLimiter {
+	return &redisLimiter{client: client}
+}
+
+func (l *redisLimiter) Allow(ctx context.Context, key string, tier RateLimitTier) (RateLimitDecision, error) {
+	if tier.Unlimited {
+		return RateLimitDecision{Allowed: true, Limit: -1, Remaining: -1}, nil
+	}
+
+	windowStart := time.Now().Truncate(time.Minute)
+	redisKey := "ratelimit:" + tier.Name + ":" + key + ":" + windowStart.Format(time.RFC3339)
+	resetAt := windowStart.Add(time.Minute)
+
+	count, err := slidingWindowScript.Run(ctx, l.client, []string{redisKey}, time.Minute.Milliseconds()).Int()
+	if err != nil {
+		return RateLimitDecision{}, err
+	}
+
+	remaining := tier.RequestsPerMinute - count
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return RateLimitDecision{
+		Allowed:   count <= tier.RequestsPerMinute,
+		Limit:     tier.RequestsPerMinute,
+		Remaining: remaining,
+		ResetAt:   resetAt,
+	}, nil
+}
+
+// newLimiter picks a redisLimiter when redisURL is set and reachable,
+// falling back to the in-memory limiter otherwise - consistent with how
+// device-service degrades when its Redis cache is unavailable.
+func newLimiter(redisURL string) Limiter {
+	if redisURL == "" {
+		return newInMemoryLimiter()
+	}
+
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		log.Printf("Warning: failed to parse RATE_LIMIT_REDIS_URL: %v - falling back to in-memory rate limiting", err)
+		return newInMemoryLimiter()
+	}
+
+	client := redis.NewClient(opt)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Printf("Warning: failed to connect to rate limit Redis: %v - falling back to in-memory rate limiting", err)
+		return newInMemoryLimiter()
+	}
+
+	log.Println("Connected to Redis for distributed rate limiting")
+	return newRedisLimiter(client)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/homeguard/api-gateway/pkg/breaker"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var breakerState = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "api_gateway_breaker_state",
+		Help: "Circuit breaker state per upstream (0=closed, 1=half-open, 2=open)",
+	},
+	[]string{"upstream"},
+)
+
+func init() {
+	prometheus.MustRegister(breakerState)
+}
+
+// maxUpstreamRetries bounds how many extra attempts an idempotent request
+// gets after its first failure.
+const maxUpstreamRetries = 2
+
+type probeContextKey struct{}
+
+// breakerFor returns the shared circuit breaker for targetURL, creating one
+// on first use.
+func (g *Gateway) breakerFor(targetURL string) *breaker.Breaker {
+	g.breakersMu.Lock()
+	defer g.breakersMu.Unlock()
+
+	brk, ok := g.breakers[targetURL]
+	if !ok {
+		brk = breaker.New(breaker.DefaultConfig())
+		g.breakers[targetURL] = brk
+	}
+	return brk
+}
+
+// recordBreakerState publishes brk's current state for targetURL so /ready
+// and dashboards don't need to poll the breaker directly.
+func (g *Gateway) recordBreakerState(targetURL string, brk *breaker.Breaker) {
+	var value float64
+	switch brk.State() {
+	case breaker.HalfOpen:
+		value = 1
+	case breaker.Open:
+		value = 2
+	}
+	breakerState.WithLabelValues(targetURL).Set(value)
+}
+
+// retryingTransport wraps a base RoundTripper with bounded, jittered retries
+// for idempotent methods, and reports every attempt's outcome to brk so the
+// breaker's failure ratio reflects the upstream's real behavior. A request
+// marked as the breaker's half-open probe is never retried internally — its
+// single outcome is what decides whether the breaker closes or reopens.
+type retryingTransport struct {
+	base http.RoundTripper
+	brk  *breaker.Breaker
+}
+
+func (t *retryingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions
+	probe, _ := req.Context().Value(probeContextKey{}).(bool)
+
+	attempts := 1
+	if idempotent && !probe {
+		attempts = maxUpstreamRetries + 1
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(retryBackoff(attempt))
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			t.brk.Record(true)
+			return resp, nil
+		}
+
+		if err == nil {
+			lastErr = fmt.Errorf("upstream returned %d", resp.StatusCode)
+			resp.Body.Close()
+		} else {
+			lastErr = err
+		}
+		t.brk.Record(false)
+	}
+
+	return nil, lastErr
+}
+
+// retryBackoff returns a jittered delay that grows with attempt, kept short
+// enough that a couple of retries still finish within the proxy's response
+// header timeout.
+func retryBackoff(attempt int) time.Duration {
+	base := 50 * time.Millisecond * time.Duration(uint(1)<<uint(attempt))
+	return base/2 + time.Duration(rand.Int63n(int64(base)/2+1))
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/homeguard/user-service/pkg/auth"
+)
+
+// clockSkewLeeway is how far apart the gateway's and an issuer's clocks are
+// allowed to drift when checking exp/nbf.
+const clockSkewLeeway = 60 * time.Second
+
+// TokenVerifier validates a bearer token string and returns the claims it
+// carries. hmacVerifier is used when no OIDC issuer is configured; jwksVerifier
+// federates with an external IdP (Keycloak/Auth0/Cognito-style) instead.
+type TokenVerifier interface {
+	Verify(tokenString string) (*auth.Claims, error)
+}
+
+// hmacVerifier checks tokens signed with the secret shared across this
+// deployment's microservices. It's the default, dev-friendly verifier,
+// delegating to pkg/auth (the same package user-service uses to issue these
+// tokens) instead of re-implementing JWT parsing here.
+type hmacVerifier struct {
+	secret string
+}
+
+func newHMACVerifier(secret string) *hmacVerifier {
+	return &hmacVerifier{secret: secret}
+}
+
+func (v *hmacVerifier) Verify(tokenString string) (*auth.Claims, error) {
+	return auth.ParseToken(tokenString, v.secret)
+}
+
+// oidcDiscovery is the subset of a provider's
+// /.well-known/openid-configuration document the gateway needs.
+type oidcDiscovery struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// jwk is one entry of a JSON Web Key Set, as published by an OIDC provider.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwksDocument struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwksVerifier validates RS256/ES256 tokens against the public keys published
+// by an OIDC issuer's JWKS endpoint, refreshing them periodically so rotated
+// signing keys are picked up without a gateway restart.
+type jwksVerifier struct {
+	issuer          string
+	audience        string
+	jwksURI         string
+	refreshInterval time.Duration
+	httpClient      *http.Client
+
+	mu   sync.RWMutex
+	keys map[string]interface{}
+}
+
+// newJWKSVerifier discovers issuer's JWKS endpoint via OIDC discovery, fetches
+// its current keys, and starts a background refresh loop.
+func newJWKSVerifier(issuer, audience string, refreshInterval time.Duration) (*jwksVerifier, error) {
+	v := &jwksVerifier{
+		issuer:          issuer,
+		audience:        audience,
+		refreshInterval: refreshInterval,
+		httpClient:      &http.Client{Timeout: 10 * time.Second},
+		keys:            make(map[string]interface{}),
+	}
+
+	jwksURI, err := v.discoverJWKSURI()
+	if err != nil {
+		return nil, fmt.Errorf("discovering OIDC configuration: %w", err)
+	}
+	v.jwksURI = jwksURI
+
+	if err := v.refreshKeys(); err != nil {
+		return nil, fmt.Errorf("fetching initial JWKS: %w", err)
+	}
+
+	go v.refreshLoop()
+	return v, nil
+}
+
+func (v *jwksVerifier) discoverJWKSURI() (string, error) {
+	resp, err := v.httpClient.Get(strings.TrimSuffix(v.issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var doc oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return "", err
+	}
+	if doc.JWKSURI == "" {
+		return "", fmt.Errorf("discovery document has no jwks_uri")
+	}
+	return doc.JWKSURI, nil
+}
+
+func (v *jwksVerifier) refreshLoop() {
+	ticker := time.NewTicker(v.refreshInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := v.refreshKeys(); err != nil {
+			log.Printf("JWKS refresh failed for %s: %v", v.issuer, err)
+		}
+	}
+}
+
+func (v *jwksVerifier) refreshKeys() error {
+	resp, err := v.httpClient.Get(v.jwksURI)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var doc jwksDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return err
+	}
+
+	keys := make(map[string]interface{}, len(doc.Keys))
+	for _, k := range doc.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("Skipping JWKS key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *jwksVerifier) keyFor(kid string) (interface{}, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+func (v *jwksVerifier) Verify(tokenString string) (*auth.Claims, error) {
+	claims := &auth.Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, ok := v.keyFor(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return key, nil
+	}, jwt.WithIssuer(v.issuer), jwt.WithAudience(v.audience), jwt.WithLeeway(clockSkewLeeway))
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid or expired token: %w", err)
+	}
+	return claims, nil
+}
+
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("decoding modulus: %w", err)
+		}
+		eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("decoding exponent: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(nBytes),
+			E: int(new(big.Int).SetBytes(eBytes).Int64()),
+		}, nil
+
+	case "EC":
+		xBytes, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("decoding x coordinate: %w", err)
+		}
+		yBytes, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("decoding y coordinate: %w", err)
+		}
+		curve, err := ecCurve(k.Crv)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(xBytes),
+			Y:     new(big.Int).SetBytes(yBytes),
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func ecCurve(crv string) (elliptic.Curve, error) {
+	switch crv {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/homeguard/user-service/pkg/auth"
+)
+
+func TestJWKPublicKeyParsesRSA(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	k := jwk{
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(priv.PublicKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.PublicKey.E)).Bytes()),
+	}
+
+	got, err := k.publicKey()
+	if err != nil {
+		t.Fatalf("publicKey: %v", err)
+	}
+	pub, ok := got.(*rsa.PublicKey)
+	if !ok {
+		t.Fatalf("publicKey returned %T, want *rsa.PublicKey", got)
+	}
+	if pub.N.Cmp(priv.PublicKey.N) != 0 || pub.E != priv.PublicKey.E {
+		t.Error("publicKey did not round-trip the RSA key's N and E")
+	}
+}
+
+func TestJWKPublicKeyRejectsBadBase64(t *testing.T) {
+	k := jwk{Kty: "RSA", N: "not base64!!", E: "AQAB"}
+	if _, err := k.publicKey(); err == nil {
+		t.Error("publicKey with invalid base64 modulus = nil error, want an error")
+	}
+}
+
+func TestJWKPublicKeyRejectsUnsupportedType(t *testing.T) {
+	k := jwk{Kty: "oct"}
+	if _, err := k.publicKey(); err == nil {
+		t.Error("publicKey with kty=oct = nil error, want an error")
+	}
+}
+
+func TestEcCurveKnownAndUnknown(t *testing.T) {
+	if _, err := ecCurve("P-256"); err != nil {
+		t.Errorf("ecCurve(P-256): %v", err)
+	}
+	if _, err := ecCurve("P-7"); err == nil {
+		t.Error("ecCurve(P-7) = nil error, want an error for an unknown curve")
+	}
+}
+
+func TestJWKSVerifierVerifyAcceptsValidToken(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	v := &jwksVerifier{
+		issuer:   "https://issuer.example",
+		audience: "homeguard",
+		keys:     map[string]interface{}{"kid-1": &priv.PublicKey},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    v.issuer,
+			Audience:  jwt.ClaimStrings{v.audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	token.Header["kid"] = "kid-1"
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	claims, err := v.Verify(signed)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims.Issuer != v.issuer {
+		t.Errorf("claims.Issuer = %q, want %q", claims.Issuer, v.issuer)
+	}
+}
+
+func TestJWKSVerifierVerifyRejectsUnknownKid(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	v := &jwksVerifier{issuer: "https://issuer.example", audience: "homeguard", keys: map[string]interface{}{}}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    v.issuer,
+			Audience:  jwt.ClaimStrings{v.audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	token.Header["kid"] = "missing-kid"
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	if _, err := v.Verify(signed); err == nil {
+		t.Error("Verify with an unknown kid = nil error, want an error")
+	}
+}
+
+func TestJWKSVerifierVerifyRejectsWrongIssuer(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	v := &jwksVerifier{issuer: "https://issuer.example", audience: "homeguard", keys: map[string]interface{}{"kid-1": &priv.PublicKey}}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://attacker.example",
+			Audience:  jwt.ClaimStrings{v.audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	token.Header["kid"] = "kid-1"
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	if _, err := v.Verify(signed); err == nil {
+		t.Error("Verify with a mismatched issuer = nil error, want an error")
+	}
+}
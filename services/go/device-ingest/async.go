@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	bufferDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "device_ingest_buffer_depth",
+			Help: "Current number of messages queued for async Kafka publish",
+		},
+	)
+	dlqTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "device_ingest_dlq_total",
+			Help: "Total number of messages sent to the dead-letter topic after exhausting retries",
+		},
+	)
+	enqueueToAckLatency = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "device_ingest_enqueue_to_ack_seconds",
+			Help:    "End-to-end latency from enqueue to Kafka ack or final failure",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(bufferDepth)
+	prometheus.MustRegister(dlqTotal)
+	prometheus.MustRegister(enqueueToAckLatency)
+}
+
+// pendingMessage rides along in a ProducerMessage's Metadata field so the
+// Errors()/Successes() reconciler can decide whether to retry or spill to
+// the dead-letter topic without a side lookup table.
+type pendingMessage struct {
+	originalTopic string
+	retries       int
+	enqueuedAt    time.Time
+	isAlert       bool
+}
+
+// walEntry is the on-disk shape of a message spilled during a shutdown that
+// couldn't drain the buffer in time, replayed on the next startup.
+type walEntry struct {
+	Topic   string `json:"topic"`
+	Key     string `json:"key"`
+	Value   []byte `json:"value"`
+	IsAlert bool   `json:"is_alert"`
+}
+
+// AsyncPublisher fronts a sarama.AsyncProducer with a bounded buffer so
+// /ingest/* handlers never block on a Kafka round-trip. Telemetry shares a
+// channel that sheds load once 80% full; alerts get a separate, reserved
+// channel so they keep being accepted under the same backpressure.
+type AsyncPublisher struct {
+	producer   sarama.AsyncProducer
+	health     *HealthChecker
+	dlqTopic   string
+	maxRetries int
+	walPath    string
+
+	normal chan *sarama.ProducerMessage
+	alert  chan *sarama.ProducerMessage
+
+	wg sync.WaitGroup
+}
+
+func NewAsyncPublisher(producer sarama.AsyncProducer, health *HealthChecker, bufferSize, reservedForAlerts, maxRetries int, dlqTopic, walPath string) *AsyncPublisher {
+	if reservedForAlerts <= 0 || reservedForAlerts >= bufferSize {
+		reservedForAlerts = bufferSize / 10
+	}
+	return &AsyncPublisher{
+		producer:   producer,
+		health:     health,
+		dlqTopic:   dlqTopic,
+		maxRetries: maxRetries,
+		walPath:    walPath,
+		normal:     make(chan *sarama.ProducerMessage, bufferSize-reservedForAlerts),
+		alert:      make(chan *sarama.ProducerMessage, reservedForAlerts),
+	}
+}
+
+// Start replays any WAL left over from an ungraceful shutdown, then
+// launches the worker pool feeding the Sarama producer and the goroutine
+// reconciling its Successes()/Errors() channels.
+func (p *AsyncPublisher) Start(ctx context.Context, workers int) {
+	p.replayWAL()
+
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.worker(ctx)
+	}
+
+	p.wg.Add(1)
+	go p.reconcile()
+
+	p.wg.Add(1)
+	go p.reportDepth(ctx)
+}
+
+// worker feeds messages into the Sarama producer's input channel, always
+// preferring the reserved alert channel over the shared one.
+func (p *AsyncPublisher) worker(ctx context.Context) {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-p.alert:
+			p.producer.Input() <- msg
+		default:
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-p.alert:
+				p.producer.Input() <- msg
+			case msg := <-p.normal:
+				p.producer.Input() <- msg
+			}
+		}
+	}
+}
+
+func (p *AsyncPublisher) reconcile() {
+	defer p.wg.Done()
+	for {
+		select {
+		case success, ok := <-p.producer.Successes():
+			if !ok {
+				return
+			}
+			p.health.SetHealthy("kafka-producer")
+			eventsPublished.WithLabelValues(success.Topic).Inc()
+			if pending, ok := success.Metadata.(*pendingMessage); ok {
+				enqueueToAckLatency.Observe(time.Since(pending.enqueuedAt).Seconds())
+			}
+		case prodErr, ok := <-p.producer.Errors():
+			if !ok {
+				return
+			}
+			p.handleError(prodErr)
+		}
+	}
+}
+
+func (p *AsyncPublisher) handleError(prodErr *sarama.ProducerError) {
+	p.health.SetFailed("kafka-producer", ReasonConnectionError, prodErr.Err.Error())
+
+	pending, _ := prodErr.Msg.Metadata.(*pendingMessage)
+	if pending == nil {
+		pending = &pendingMessage{originalTopic: prodErr.Msg.Topic, enqueuedAt: time.Now()}
+	}
+
+	if pending.retries < p.maxRetries {
+		pending.retries++
+		prodErr.Msg.Metadata = pending
+
+		target := p.normal
+		if pending.isAlert {
+			target = p.alert
+		}
+		select {
+		case target <- prodErr.Msg:
+		default:
+			p.sendToDLQ(prodErr.Msg, pending, "buffer full on retry")
+		}
+		return
+	}
+
+	p.sendToDLQ(prodErr.Msg, pending, prodErr.Err.Error())
+}
+
+func (p *AsyncPublisher) sendToDLQ(msg *sarama.ProducerMessage, pending *pendingMessage, reason string) {
+	dlqMsg := &sarama.ProducerMessage{
+		Topic: p.dlqTopic,
+		Key:   msg.Key,
+		Value: msg.Value,
+		Headers: []sarama.RecordHeader{
+			{Key: []byte("X-Failure-Reason"), Value: []byte(reason)},
+			{Key: []byte("X-Original-Topic"), Value: []byte(pending.originalTopic)},
+		},
+	}
+
+	select {
+	case p.producer.Input() <- dlqMsg:
+		dlqTotal.Inc()
+	default:
+		log.Printf("Dropping message, DLQ buffer full: %s", reason)
+	}
+}
+
+// Enqueue queues a message for async publish, returning an error if the
+// buffer for its priority class is full. Telemetry and general events share
+// the normal class and shed load under backpressure; alerts use the
+// reserved class so they keep being accepted.
+func (p *AsyncPublisher) Enqueue(topic, key string, value []byte, isAlert bool) error {
+	msg := &sarama.ProducerMessage{
+		Topic:     topic,
+		Key:       sarama.StringEncoder(key),
+		Value:     sarama.ByteEncoder(value),
+		Timestamp: time.Now(),
+		Metadata:  &pendingMessage{originalTopic: topic, enqueuedAt: time.Now(), isAlert: isAlert},
+	}
+
+	target := p.normal
+	if isAlert {
+		target = p.alert
+	}
+
+	select {
+	case target <- msg:
+		return nil
+	default:
+		return fmt.Errorf("publish buffer full")
+	}
+}
+
+// OverCapacity reports whether the shared (non-alert) buffer has crossed
+// the 80% shed-load threshold.
+func (p *AsyncPublisher) OverCapacity() bool {
+	return float64(len(p.normal)) >= 0.8*float64(cap(p.normal))
+}
+
+func (p *AsyncPublisher) reportDepth(ctx context.Context) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			bufferDepth.Set(float64(len(p.normal) + len(p.alert)))
+		}
+	}
+}
+
+// Drain waits up to timeout for the buffer to empty, then spills whatever
+// is left to a local WAL file for replay on the next startup.
+func (p *AsyncPublisher) Drain(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if len(p.normal)+len(p.alert) == 0 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	p.spillToWAL()
+}
+
+func (p *AsyncPublisher) spillToWAL() {
+	if p.walPath == "" || len(p.normal)+len(p.alert) == 0 {
+		return
+	}
+
+	file, err := os.OpenFile(p.walPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Printf("Error opening WAL for spill: %v", err)
+		return
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	spilled := 0
+	for _, ch := range []chan *sarama.ProducerMessage{p.alert, p.normal} {
+		spilled += spillChannel(ch, encoder)
+	}
+
+	if spilled > 0 {
+		log.Printf("Spilled %d undelivered messages to WAL", spilled)
+	}
+}
+
+func spillChannel(ch chan *sarama.ProducerMessage, encoder *json.Encoder) int {
+	spilled := 0
+	for {
+		select {
+		case msg := <-ch:
+			pending, _ := msg.Metadata.(*pendingMessage)
+			key, _ := msg.Key.Encode()
+			value, _ := msg.Value.Encode()
+			entry := walEntry{
+				Topic:   msg.Topic,
+				Key:     string(key),
+				Value:   value,
+				IsAlert: pending != nil && pending.isAlert,
+			}
+			if err := encoder.Encode(entry); err != nil {
+				log.Printf("Error spilling message to WAL: %v", err)
+				continue
+			}
+			spilled++
+		default:
+			return spilled
+		}
+	}
+}
+
+func (p *AsyncPublisher) replayWAL() {
+	if p.walPath == "" {
+		return
+	}
+
+	file, err := os.Open(p.walPath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	replayed := 0
+	for scanner.Scan() {
+		var entry walEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("Error parsing WAL entry: %v", err)
+			continue
+		}
+		if err := p.Enqueue(entry.Topic, entry.Key, entry.Value, entry.IsAlert); err != nil {
+			log.Printf("Error replaying WAL entry: %v", err)
+			continue
+		}
+		replayed++
+	}
+
+	if replayed > 0 {
+		log.Printf("Replayed %d messages from WAL", replayed)
+	}
+	os.Remove(p.walPath)
+}
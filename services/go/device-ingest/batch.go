@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var eventsFiltered = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "device_ingest_events_filtered_total",
+		Help: "Total number of events dropped at ingest by a registered tenant filter",
+	},
+	[]string{"tenant_id"},
+)
+
+func init() {
+	prometheus.MustRegister(eventsFiltered)
+}
+
+// ingestBatch accepts a JSON array or newline-delimited JSON stream of
+// events from a single device token, optionally gzip-compressed, and
+// enqueues the survivors onto the async publisher instead of blocking on a
+// Kafka round-trip per event.
+func (s *Service) ingestBatch(w http.ResponseWriter, r *http.Request) {
+	deviceToken := r.Header.Get("X-Device-Token")
+	if deviceToken == "" {
+		s.errorResponse(w, http.StatusUnauthorized, "Missing device token")
+		return
+	}
+
+	deviceInfo, err := s.validateDeviceToken(deviceToken)
+	if err != nil {
+		s.errorResponse(w, http.StatusUnauthorized, "Invalid device token")
+		return
+	}
+
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			s.errorResponse(w, http.StatusBadRequest, "Invalid gzip body")
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	payloads, err := decodeBatchPayloads(body)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, hasFilter := s.filters.Get(deviceInfo.UserID)
+
+	accepted := 0
+	filtered := 0
+	rejected := 0
+
+	for _, payload := range payloads {
+		eventType, _ := payload["event_type"].(string)
+		if eventType == "" {
+			eventType = "generic"
+		}
+
+		event := DeviceEvent{
+			ID:        uuid.New().String(),
+			DeviceID:  deviceInfo.DeviceID,
+			UserID:    deviceInfo.UserID,
+			EventType: eventType,
+			Timestamp: time.Now(),
+			Payload:   payload,
+		}
+
+		if err := classifyEvent(&event, payload); err != nil {
+			s.errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if hasFilter && !filter.matches(event) {
+			filtered++
+			continue
+		}
+
+		if err := s.publishEvent(s.topicFor(event), event, false); err != nil {
+			rejected++
+			continue
+		}
+
+		eventsReceived.WithLabelValues(eventType, event.DeviceID, event.Category, event.Severity).Inc()
+		accepted++
+	}
+
+	if filtered > 0 {
+		eventsFiltered.WithLabelValues(deviceInfo.UserID).Add(float64(filtered))
+	}
+
+	status := http.StatusAccepted
+	if rejected > 0 && accepted == 0 {
+		status = http.StatusTooManyRequests
+	}
+
+	s.jsonResponse(w, status, map[string]interface{}{
+		"accepted": accepted,
+		"filtered": filtered,
+		"rejected": rejected,
+		"total":    len(payloads),
+	})
+}
+
+// decodeBatchPayloads accepts either a JSON array of event objects or a
+// stream of newline-delimited JSON objects.
+func decodeBatchPayloads(r io.Reader) ([]map[string]interface{}, error) {
+	buffered := bufio.NewReader(r)
+
+	first, err := buffered.Peek(1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if len(first) > 0 && first[0] == '[' {
+		var payloads []map[string]interface{}
+		if err := json.NewDecoder(buffered).Decode(&payloads); err != nil {
+			return nil, err
+		}
+		return payloads, nil
+	}
+
+	var payloads []map[string]interface{}
+	decoder := json.NewDecoder(buffered)
+	for {
+		var payload map[string]interface{}
+		if err := decoder.Decode(&payload); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
+
+// registerFilter stores the calling tenant's ingest filter, keyed by the
+// user ID resolved from its device token.
+func (s *Service) registerFilter(w http.ResponseWriter, r *http.Request) {
+	deviceToken := r.Header.Get("X-Device-Token")
+	if deviceToken == "" {
+		s.errorResponse(w, http.StatusUnauthorized, "Missing device token")
+		return
+	}
+
+	deviceInfo, err := s.validateDeviceToken(deviceToken)
+	if err != nil {
+		s.errorResponse(w, http.StatusUnauthorized, "Invalid device token")
+		return
+	}
+
+	var spec FilterSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := s.filters.Register(deviceInfo.UserID, spec); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "registered"})
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// severityRank orders severities from least to most urgent so a filter's
+// severity_min can be compared against an incoming event's severity.
+var severityRank = map[string]int{
+	SeverityCleared:       0,
+	SeverityIndeterminate: 1,
+	SeverityWarning:       2,
+	SeverityMinor:         3,
+	SeverityMajor:         4,
+	SeverityCritical:      5,
+}
+
+// FilterSpec is a tenant-registered ingest filter, shaped after the O-RAN
+// job definition: a coarse allow-list over measurement type/device identity
+// plus a severity floor, and an optional boolean expression over payload
+// fields for anything finer-grained.
+type FilterSpec struct {
+	MeasurementTypes []string `json:"measurement_types,omitempty"`
+	DeviceIdentities []string `json:"device_identities,omitempty"`
+	SeverityMin      string   `json:"severity_min,omitempty"`
+	Expression       string   `json:"expression,omitempty"`
+}
+
+// compiledFilter is a FilterSpec with its expression parsed once at
+// registration time rather than re-parsed on every event.
+type compiledFilter struct {
+	spec             FilterSpec
+	measurementTypes map[string]bool
+	deviceIdentities map[string]bool
+	expr             exprNode
+}
+
+func compileFilter(spec FilterSpec) (*compiledFilter, error) {
+	if spec.SeverityMin != "" {
+		if _, ok := severityRank[strings.ToUpper(spec.SeverityMin)]; !ok {
+			return nil, fmt.Errorf("unknown severity_min: %s", spec.SeverityMin)
+		}
+		spec.SeverityMin = strings.ToUpper(spec.SeverityMin)
+	}
+
+	cf := &compiledFilter{spec: spec}
+
+	if len(spec.MeasurementTypes) > 0 {
+		cf.measurementTypes = make(map[string]bool, len(spec.MeasurementTypes))
+		for _, t := range spec.MeasurementTypes {
+			cf.measurementTypes[t] = true
+		}
+	}
+	if len(spec.DeviceIdentities) > 0 {
+		cf.deviceIdentities = make(map[string]bool, len(spec.DeviceIdentities))
+		for _, d := range spec.DeviceIdentities {
+			cf.deviceIdentities[d] = true
+		}
+	}
+
+	if spec.Expression != "" {
+		expr, err := parseExpr(spec.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression: %w", err)
+		}
+		cf.expr = expr
+	}
+
+	return cf, nil
+}
+
+// matches reports whether event passes every stage of the filter: the
+// measurement-type and device-identity allow-lists, the severity floor, and
+// finally the boolean expression, in that order, short-circuiting on the
+// first failure.
+func (cf *compiledFilter) matches(event DeviceEvent) bool {
+	if cf.measurementTypes != nil && !cf.measurementTypes[event.EventType] {
+		return false
+	}
+	if cf.deviceIdentities != nil && !cf.deviceIdentities[event.DeviceID] {
+		return false
+	}
+	if cf.spec.SeverityMin != "" && severityRank[event.Severity] < severityRank[cf.spec.SeverityMin] {
+		return false
+	}
+	if cf.expr != nil {
+		ok, err := cf.expr.eval(filterEnv(event))
+		if err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// filterEnv builds the variable environment an expression is evaluated
+// against: top-level event fields plus the raw payload under "payload".
+func filterEnv(event DeviceEvent) map[string]interface{} {
+	return map[string]interface{}{
+		"device_id":    event.DeviceID,
+		"event_type":   event.EventType,
+		"category":     event.Category,
+		"sub_category": event.SubCategory,
+		"severity":     event.Severity,
+		"payload":      event.Payload,
+	}
+}
+
+// FilterStore holds the per-tenant registered filters, cached by tenant ID
+// so the hot ingest path never re-parses an expression.
+type FilterStore struct {
+	mu      sync.RWMutex
+	filters map[string]*compiledFilter
+}
+
+func NewFilterStore() *FilterStore {
+	return &FilterStore{filters: make(map[string]*compiledFilter)}
+}
+
+// Register compiles and stores spec as the active filter for tenantID,
+// replacing any previous one.
+func (fs *FilterStore) Register(tenantID string, spec FilterSpec) error {
+	cf, err := compileFilter(spec)
+	if err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	fs.filters[tenantID] = cf
+	fs.mu.Unlock()
+	return nil
+}
+
+// Get returns the compiled filter for tenantID, if one is registered.
+func (fs *FilterStore) Get(tenantID string) (*compiledFilter, bool) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	cf, ok := fs.filters[tenantID]
+	return cf, ok
+}
+
+// exprNode is a parsed boolean expression over the map[string]interface{}
+// environment produced by filterEnv. There is no code-gen here: eval walks
+// the tree directly against the event on every call.
+type exprNode interface {
+	eval(env map[string]interface{}) (bool, error)
+}
+
+type orNode struct{ left, right exprNode }
+
+func (n *orNode) eval(env map[string]interface{}) (bool, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return false, err
+	}
+	if left {
+		return true, nil
+	}
+	return n.right.eval(env)
+}
+
+type andNode struct{ left, right exprNode }
+
+func (n *andNode) eval(env map[string]interface{}) (bool, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return false, err
+	}
+	if !left {
+		return false, nil
+	}
+	return n.right.eval(env)
+}
+
+type notNode struct{ operand exprNode }
+
+func (n *notNode) eval(env map[string]interface{}) (bool, error) {
+	operand, err := n.operand.eval(env)
+	if err != nil {
+		return false, err
+	}
+	return !operand, nil
+}
+
+type compareNode struct {
+	op          string
+	left, right operand
+}
+
+func (n *compareNode) eval(env map[string]interface{}) (bool, error) {
+	left, err := n.left.resolve(env)
+	if err != nil {
+		return false, err
+	}
+	right, err := n.right.resolve(env)
+	if err != nil {
+		return false, err
+	}
+
+	switch n.op {
+	case "==":
+		return fmt.Sprint(left) == fmt.Sprint(right), nil
+	case "!=":
+		return fmt.Sprint(left) != fmt.Sprint(right), nil
+	case ">", "<", ">=", "<=":
+		leftNum, leftOK := toFloat(left)
+		rightNum, rightOK := toFloat(right)
+		if !leftOK || !rightOK {
+			return false, fmt.Errorf("non-numeric operand in %s comparison", n.op)
+		}
+		switch n.op {
+		case ">":
+			return leftNum > rightNum, nil
+		case "<":
+			return leftNum < rightNum, nil
+		case ">=":
+			return leftNum >= rightNum, nil
+		default:
+			return leftNum <= rightNum, nil
+		}
+	default:
+		return false, fmt.Errorf("unknown operator: %s", n.op)
+	}
+}
+
+// operand is either a literal value or a dotted field path resolved against
+// the environment at eval time, e.g. "payload.temperature".
+type operand struct {
+	literal   interface{}
+	isField   bool
+	fieldPath []string
+}
+
+func (o operand) resolve(env map[string]interface{}) (interface{}, error) {
+	if !o.isField {
+		return o.literal, nil
+	}
+
+	var current interface{} = env
+	for _, part := range o.fieldPath {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		current = m[part]
+	}
+	return current, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseExpr compiles a small boolean expression language into an exprNode
+// tree. Grammar (lowest to highest precedence):
+//
+//	expr       := and ( "||" and )*
+//	and        := unary ( "&&" unary )*
+//	unary      := "!" unary | comparison
+//	comparison := operand ( ("==" | "!=" | ">" | "<" | ">=" | "<=") operand )?
+//	operand    := number | string | "true" | "false" | fieldPath | "(" expr ")"
+//	fieldPath  := identifier ( "." identifier )*
+func parseExpr(src string) (exprNode, error) {
+	p := &exprParser{tokens: tokenizeExpr(src)}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token %q", p.tokens[p.pos])
+	}
+	return node, nil
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *exprParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.peek() == "!" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+var comparisonOps = map[string]bool{
+	"==": true, "!=": true, ">": true, "<": true, ">=": true, "<=": true,
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	if p.peek() == "(" {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("expected closing parenthesis")
+		}
+		return node, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if op := p.peek(); comparisonOps[op] {
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &compareNode{op: op, left: left, right: right}, nil
+	}
+
+	// A bare field path used on its own is truthy, e.g. "payload.locked".
+	return &compareNode{op: "!=", left: left, right: operand{literal: nil}}, nil
+}
+
+func (p *exprParser) parseOperand() (operand, error) {
+	tok := p.next()
+	if tok == "" {
+		return operand{}, fmt.Errorf("unexpected end of expression")
+	}
+
+	switch {
+	case tok == "true":
+		return operand{literal: true}, nil
+	case tok == "false":
+		return operand{literal: false}, nil
+	case strings.HasPrefix(tok, `"`):
+		return operand{literal: strings.Trim(tok, `"`)}, nil
+	default:
+		if f, err := strconv.ParseFloat(tok, 64); err == nil {
+			return operand{literal: f}, nil
+		}
+		return operand{isField: true, fieldPath: strings.Split(tok, ".")}, nil
+	}
+}
+
+// tokenizeExpr splits src into tokens: quoted strings, multi-char operators,
+// parentheses, and bare words (identifiers/numbers/booleans).
+func tokenizeExpr(src string) []string {
+	var tokens []string
+	runes := []rune(src)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n':
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		case r == '(' || r == ')':
+			tokens = append(tokens, string(r))
+			i++
+		case strings.ContainsRune("=!<>", r):
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, string(runes[i:i+2]))
+				i += 2
+			} else {
+				tokens = append(tokens, string(r))
+				i++
+			}
+		case r == '&' && i+1 < len(runes) && runes[i+1] == '&':
+			tokens = append(tokens, "&&")
+			i += 2
+		case r == '|' && i+1 < len(runes) && runes[i+1] == '|':
+			tokens = append(tokens, "||")
+			i += 2
+		default:
+			j := i
+			for j < len(runes) && !strings.ContainsRune(" \t\n()=!<>&|\"", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		}
+	}
+
+	return tokens
+}
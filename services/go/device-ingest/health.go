@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ComponentState is the health of a single dependency, modeled on Botkube's
+// notifier health pattern: a component starts out Initializing, becomes
+// Healthy once it proves itself, and flips to Failed with a reason when it
+// stops working.
+type ComponentState string
+
+const (
+	StateHealthy      ComponentState = "Healthy"
+	StateInitializing ComponentState = "Initializing"
+	StateFailed       ComponentState = "Failed"
+)
+
+// Failure reasons a component can report alongside StateFailed.
+const (
+	ReasonConnectionError = "ConnectionError"
+	ReasonAuthError       = "AuthError"
+	ReasonConfigError     = "ConfigError"
+)
+
+// ComponentHealth is the current status of one registered dependency.
+type ComponentHealth struct {
+	State          ComponentState `json:"state"`
+	Reason         string         `json:"reason,omitempty"`
+	Message        string         `json:"message,omitempty"`
+	LastTransition time.Time      `json:"last_transition"`
+	Critical       bool           `json:"critical"`
+}
+
+// HealthChecker tracks the status of the ingest service's dependencies so
+// /healthz, /readyz, and /health can report on them independently of the
+// HTTP server's own liveness.
+type HealthChecker struct {
+	mu         sync.RWMutex
+	components map[string]*ComponentHealth
+}
+
+func NewHealthChecker() *HealthChecker {
+	return &HealthChecker{components: make(map[string]*ComponentHealth)}
+}
+
+// Register adds a component in the Initializing state. critical components
+// cause /readyz to fail when they transition to Failed.
+func (h *HealthChecker) Register(name string, critical bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.components[name] = &ComponentHealth{
+		State:          StateInitializing,
+		LastTransition: time.Now(),
+		Critical:       critical,
+	}
+}
+
+// SetHealthy transitions a component to Healthy, clearing any prior failure.
+func (h *HealthChecker) SetHealthy(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c, ok := h.components[name]
+	if !ok || c.State == StateHealthy {
+		return
+	}
+	c.State = StateHealthy
+	c.Reason = ""
+	c.Message = ""
+	c.LastTransition = time.Now()
+}
+
+// SetFailed transitions a component to Failed with the given reason.
+func (h *HealthChecker) SetFailed(name, reason, message string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c, ok := h.components[name]
+	if !ok {
+		return
+	}
+	c.State = StateFailed
+	c.Reason = reason
+	c.Message = message
+	c.LastTransition = time.Now()
+}
+
+// Snapshot returns a copy of every component's current health, for the
+// /health endpoint.
+func (h *HealthChecker) Snapshot() map[string]ComponentHealth {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	snapshot := make(map[string]ComponentHealth, len(h.components))
+	for name, c := range h.components {
+		snapshot[name] = *c
+	}
+	return snapshot
+}
+
+// Ready reports whether every critical component is not Failed.
+func (h *HealthChecker) Ready() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, c := range h.components {
+		if c.Critical && c.State == StateFailed {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Service) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "alive"})
+}
+
+func (s *Service) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.health.Ready() {
+		s.jsonResponse(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status":     "not_ready",
+			"components": s.health.Snapshot(),
+		})
+		return
+	}
+	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+func (s *Service) healthHandler(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"status":     "healthy",
+		"components": s.health.Snapshot(),
+	})
+}
+
+// consecutiveFailureTracker flips a component to Failed after threshold
+// consecutive failures observed in a sliding window, and back to Healthy on
+// the next success, used for the device-service HTTP client.
+type consecutiveFailureTracker struct {
+	mu        sync.Mutex
+	failures  int
+	threshold int
+	component string
+	reason    string
+	health    *HealthChecker
+}
+
+func newConsecutiveFailureTracker(health *HealthChecker, component, reason string, threshold int) *consecutiveFailureTracker {
+	return &consecutiveFailureTracker{
+		threshold: threshold,
+		component: component,
+		reason:    reason,
+		health:    health,
+	}
+}
+
+func (t *consecutiveFailureTracker) recordSuccess() {
+	t.mu.Lock()
+	t.failures = 0
+	t.mu.Unlock()
+	t.health.SetHealthy(t.component)
+}
+
+func (t *consecutiveFailureTracker) recordFailure(message string) {
+	t.mu.Lock()
+	t.failures++
+	failed := t.failures >= t.threshold
+	t.mu.Unlock()
+
+	if failed {
+		t.health.SetFailed(t.component, t.reason, message)
+	}
+}
@@ -0,0 +1,168 @@
+// Package kafka provides device-to-topic routing helpers used by the device
+// ingest service, independent of the sarama client wiring in main.go.
+package kafka
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var assignmentChurn = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "device_ingest_endpoint_assignment_churn_total",
+		Help: "Total number of device topic reassignments caused by ring changes",
+	},
+	[]string{"base_topic"},
+)
+
+func init() {
+	prometheus.MustRegister(assignmentChurn)
+}
+
+// EndpointManager maps a device ID onto one of a fixed pool of partitioned
+// Kafka topics sharing a common prefix, e.g. "device-events-00".."device-events-07",
+// using rendezvous (HRW) hashing: for each device ID d, compute
+// score(d, t_i) = hash64(d || t_i) for every candidate topic t_i in the
+// current ring and pick the topic with the maximum score. This gives minimal
+// reassignment when topics are added or removed (only ~1/N keys move)
+// without needing a ring of virtual nodes, modeled on VOLTHA's device-scoped
+// topic approach.
+type EndpointManager struct {
+	mu        sync.RWMutex
+	baseTopic string
+	replicas  int
+	epoch     uint64
+	cache     map[string]cachedAssignment
+	overrides map[string]string
+}
+
+type cachedAssignment struct {
+	topic string
+	epoch uint64
+}
+
+// NewEndpointManager creates a manager that shards deviceIDs across replicas
+// topics named "<baseTopic>-<NN>".
+func NewEndpointManager(baseTopic string, replicas int) *EndpointManager {
+	if replicas < 1 {
+		replicas = 1
+	}
+	return &EndpointManager{
+		baseTopic: baseTopic,
+		replicas:  replicas,
+		cache:     make(map[string]cachedAssignment),
+		overrides: make(map[string]string),
+	}
+}
+
+// TopicForDevice returns the topic this device is currently assigned to,
+// honoring any pinned override from the device-service override table. The
+// assignment is cached until the ring's epoch changes (SetReplicaCount).
+func (m *EndpointManager) TopicForDevice(deviceID string) string {
+	if override := m.overrideFor(deviceID); override != "" {
+		return override
+	}
+
+	m.mu.RLock()
+	if cached, ok := m.cache[deviceID]; ok && cached.epoch == m.epoch {
+		m.mu.RUnlock()
+		return cached.topic
+	}
+	epoch := m.epoch
+	m.mu.RUnlock()
+
+	topic := rendezvousPick(deviceID, m.baseTopic, m.replicas)
+
+	m.mu.Lock()
+	m.cache[deviceID] = cachedAssignment{topic: topic, epoch: epoch}
+	m.mu.Unlock()
+
+	return topic
+}
+
+// DualWriteTargets returns the topics a device's events should be published
+// to during a migration window: just the current topic normally, or both the
+// previous and current topic when the ring size changed and the device's
+// score differs between rings and dual-write is requested for it.
+func (m *EndpointManager) DualWriteTargets(deviceID string, previousReplicas int, dualWrite bool) []string {
+	current := m.TopicForDevice(deviceID)
+	if !dualWrite || previousReplicas <= 0 || previousReplicas == m.replicas {
+		return []string{current}
+	}
+
+	previous := rendezvousPick(deviceID, m.baseTopic, previousReplicas)
+	if previous == current {
+		return []string{current}
+	}
+	return []string{previous, current}
+}
+
+// SetReplicaCount changes the number of topics in the ring, bumping the
+// epoch so cached assignments are lazily recomputed on next lookup rather
+// than evicted eagerly.
+func (m *EndpointManager) SetReplicaCount(replicas int) {
+	if replicas < 1 {
+		replicas = 1
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if replicas == m.replicas {
+		return
+	}
+	m.replicas = replicas
+	m.epoch++
+	assignmentChurn.WithLabelValues(m.baseTopic).Inc()
+}
+
+// SetOverride pins a device to a specific topic, e.g. for high-value devices
+// that should not share a shard with the general fleet.
+func (m *EndpointManager) SetOverride(deviceID, topic string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.overrides[deviceID] = topic
+}
+
+// ReplaceOverrides atomically swaps the full override table, as fetched
+// periodically from the device-service.
+func (m *EndpointManager) ReplaceOverrides(overrides map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.overrides = overrides
+}
+
+func (m *EndpointManager) overrideFor(deviceID string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.overrides[deviceID]
+}
+
+// Snapshot returns the current ring configuration, for debug endpoints.
+func (m *EndpointManager) Snapshot() (baseTopic string, replicas int, epoch uint64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.baseTopic, m.replicas, m.epoch
+}
+
+func rendezvousPick(deviceID, baseTopic string, replicas int) string {
+	var bestTopic string
+	var bestScore uint64
+
+	for i := 0; i < replicas; i++ {
+		topic := fmt.Sprintf("%s-%02d", baseTopic, i)
+		score := hash64(deviceID + "|" + topic)
+		if bestTopic == "" || score > bestScore {
+			bestScore = score
+			bestTopic = topic
+		}
+	}
+	return bestTopic
+}
+
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
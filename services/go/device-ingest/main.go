@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,23 +19,152 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/homeguard/device-ingest/kafka"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Port             string
-	KafkaBrokers     []string
-	DeviceServiceURL string
+	Port               string
+	KafkaBrokers       []string
+	DeviceServiceURL   string
+	KafkaTopicPoolSize int
+	OAuthTokenURL      string
+	OAuthClientID      string
+	OAuthClientSecret  string
+	OAuthJWKSURL       string
+	KafkaSASLMechanism string
+	PublishBufferSize  int
+	AlertReservedSlots int
+	PublishMaxRetries  int
+	DLQTopic           string
+	WALPath            string
+	PublishWorkers     int
 }
 
 // DeviceEvent represents an event from a device
 type DeviceEvent struct {
-	ID        string                 `json:"id"`
-	DeviceID  string                 `json:"device_id"`
-	UserID    string                 `json:"user_id"`
-	EventType string                 `json:"event_type"`
-	Timestamp time.Time              `json:"timestamp"`
-	Payload   map[string]interface{} `json:"payload"`
+	ID          string                 `json:"id"`
+	DeviceID    string                 `json:"device_id"`
+	UserID      string                 `json:"user_id"`
+	EventType   string                 `json:"event_type"`
+	Timestamp   time.Time              `json:"timestamp"`
+	Payload     map[string]interface{} `json:"payload"`
+	Category    string                 `json:"category,omitempty"`
+	SubCategory string                 `json:"sub_category,omitempty"`
+	Severity    string                 `json:"severity,omitempty"`
+	RaisedTs    time.Time              `json:"raised_ts,omitempty"`
+	AlarmID     string                 `json:"alarm_id,omitempty"`
+}
+
+// Event categories, modeled on VOLTHA's EventProxy categorization.
+const (
+	CategoryCommunication = "COMMUNICATION"
+	CategorySecurity      = "SECURITY"
+	CategoryEquipment     = "EQUIPMENT"
+	CategoryEnvironment   = "ENVIRONMENT"
+)
+
+// Event severities, ordered from least to most urgent.
+const (
+	SeverityCleared       = "CLEARED"
+	SeverityIndeterminate = "INDETERMINATE"
+	SeverityWarning       = "WARNING"
+	SeverityMinor         = "MINOR"
+	SeverityMajor         = "MAJOR"
+	SeverityCritical      = "CRITICAL"
+)
+
+var validCategories = map[string]bool{
+	CategoryCommunication: true,
+	CategorySecurity:      true,
+	CategoryEquipment:     true,
+	CategoryEnvironment:   true,
+}
+
+var validSeverities = map[string]bool{
+	SeverityCleared:       true,
+	SeverityIndeterminate: true,
+	SeverityWarning:       true,
+	SeverityMinor:         true,
+	SeverityMajor:         true,
+	SeverityCritical:      true,
+}
+
+// subCategoriesByCategory mirrors the ONU/OLT-style finer grouping VOLTHA
+// uses, adapted to the device types this hub ingests from.
+var subCategoriesByCategory = map[string]map[string]bool{
+	CategoryCommunication: {"ONU": true, "OLT": true, "NETWORK": true},
+	CategorySecurity:      {"LOCK": true, "ALARM": true, "CAMERA": true},
+	CategoryEquipment:     {"SENSOR": true, "ACTUATOR": true, "BATTERY": true},
+	CategoryEnvironment:   {"TEMPERATURE": true, "HUMIDITY": true, "SMOKE": true, "LEAK": true},
+}
+
+// classifyEvent validates and fills in classification defaults for an
+// incoming event, returning an error if an explicitly provided enum value
+// is unrecognized.
+func classifyEvent(event *DeviceEvent, payload map[string]interface{}) error {
+	if category, ok := payload["category"].(string); ok && category != "" {
+		category = strings.ToUpper(category)
+		if !validCategories[category] {
+			return fmt.Errorf("unknown category: %s", category)
+		}
+		event.Category = category
+	} else {
+		event.Category = CategoryEquipment
+	}
+
+	if subCategory, ok := payload["sub_category"].(string); ok && subCategory != "" {
+		subCategory = strings.ToUpper(subCategory)
+		if !subCategoriesByCategory[event.Category][subCategory] {
+			return fmt.Errorf("unknown sub_category %s for category %s", subCategory, event.Category)
+		}
+		event.SubCategory = subCategory
+	}
+
+	if severity, ok := payload["severity"].(string); ok && severity != "" {
+		severity = strings.ToUpper(severity)
+		if !validSeverities[severity] {
+			return fmt.Errorf("unknown severity: %s", severity)
+		}
+		event.Severity = severity
+	} else {
+		event.Severity = SeverityIndeterminate
+	}
+
+	if raisedTs, ok := payload["raised_ts"].(string); ok && raisedTs != "" {
+		parsed, err := time.Parse(time.RFC3339, raisedTs)
+		if err != nil {
+			return fmt.Errorf("invalid raised_ts: %w", err)
+		}
+		event.RaisedTs = parsed
+	} else {
+		event.RaisedTs = event.Timestamp
+	}
+
+	if alarmID, ok := payload["alarm_id"].(string); ok && alarmID != "" {
+		event.AlarmID = alarmID
+	} else if event.Severity != SeverityCleared {
+		// Mint a correlation ID so a later "cleared" event can reference it.
+		event.AlarmID = uuid.New().String()
+	}
+
+	return nil
+}
+
+// topicForSeverity routes events to different Kafka topic families by
+// severity so downstream consumers can subscribe by severity without
+// re-parsing payloads. The family name is then sharded across a pool of
+// partitioned topics by the Service's EndpointManager for that family.
+func topicForSeverity(severity string) string {
+	switch severity {
+	case SeverityCritical, SeverityMajor:
+		return "device-alerts"
+	case SeverityCleared:
+		return "device-events-cleared"
+	default:
+		return "device-events"
+	}
 }
 
 // Metrics
@@ -43,7 +174,7 @@ var (
 			Name: "device_ingest_events_received_total",
 			Help: "Total number of events received",
 		},
-		[]string{"event_type", "device_id"},
+		[]string{"event_type", "device_id", "category", "severity"},
 	)
 	eventsPublished = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -69,10 +200,17 @@ func init() {
 
 // Service handles device data ingestion
 type Service struct {
-	config   *Config
-	producer sarama.SyncProducer
-	router   *mux.Router
-	client   *http.Client
+	config          *Config
+	producer        sarama.AsyncProducer
+	publisher       *AsyncPublisher
+	router          *mux.Router
+	client          *http.Client
+	endpointManager map[string]*kafka.EndpointManager
+	serviceToken    *serviceTokenSource
+	jwks            *jwksCache
+	filters         *FilterStore
+	health          *HealthChecker
+	deviceSvcHealth *consecutiveFailureTracker
 }
 
 func loadConfig() *Config {
@@ -81,11 +219,45 @@ func loadConfig() *Config {
 		brokers = "homeguard-kafka-kafka-bootstrap.homeguard-messaging:9092"
 	}
 
+	poolSize := 8
+	if raw := os.Getenv("KAFKA_TOPIC_POOL_SIZE"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			poolSize = parsed
+		}
+	}
+
 	return &Config{
-		Port:             getEnv("PORT", "8080"),
-		KafkaBrokers:     []string{brokers},
-		DeviceServiceURL: getEnv("DEVICE_SERVICE_URL", "http://device-service:8080"),
+		Port:               getEnv("PORT", "8080"),
+		KafkaBrokers:       []string{brokers},
+		DeviceServiceURL:   getEnv("DEVICE_SERVICE_URL", "http://device-service:8080"),
+		KafkaTopicPoolSize: poolSize,
+		OAuthTokenURL:      os.Getenv("OAUTH_TOKEN_URL"),
+		OAuthClientID:      os.Getenv("OAUTH_CLIENT_ID"),
+		OAuthClientSecret:  os.Getenv("OAUTH_CLIENT_SECRET"),
+		OAuthJWKSURL:       os.Getenv("OAUTH_JWKS_URL"),
+		KafkaSASLMechanism: os.Getenv("KAFKA_SASL_MECHANISM"),
+		PublishBufferSize:  getEnvInt("PUBLISH_BUFFER_SIZE", 10000),
+		AlertReservedSlots: getEnvInt("PUBLISH_ALERT_RESERVED_SLOTS", 1000),
+		PublishMaxRetries:  getEnvInt("PUBLISH_MAX_RETRIES", 3),
+		DLQTopic:           getEnv("DLQ_TOPIC", "device-events-dlq"),
+		WALPath:            getEnv("PUBLISH_WAL_PATH", "/var/lib/device-ingest/publish.wal"),
+		PublishWorkers:     getEnvInt("PUBLISH_WORKERS", 4),
+	}
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if raw := os.Getenv(key); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			return parsed
+		}
 	}
+	return defaultValue
+}
+
+// oauthEnabled reports whether the service should obtain its own token for
+// calls to device-service instead of forwarding the caller's device token.
+func (c *Config) oauthEnabled() bool {
+	return c.OAuthTokenURL != "" && c.OAuthClientID != "" && c.OAuthClientSecret != ""
 }
 
 func getEnv(key, defaultValue string) string {
@@ -102,25 +274,125 @@ func NewService(config *Config) (*Service, error) {
 	kafkaConfig.Producer.RequiredAcks = sarama.WaitForAll
 	kafkaConfig.Producer.Retry.Max = 3
 	kafkaConfig.Producer.Return.Successes = true
+	kafkaConfig.Producer.Return.Errors = true
 	kafkaConfig.Net.DialTimeout = 10 * time.Second
 	kafkaConfig.Net.WriteTimeout = 10 * time.Second
 
-	producer, err := sarama.NewSyncProducer(config.KafkaBrokers, kafkaConfig)
+	var serviceToken *serviceTokenSource
+	if config.oauthEnabled() {
+		serviceToken = newServiceTokenSource(config)
+
+		if config.KafkaSASLMechanism == string(sarama.SASLTypeOAuth) {
+			kafkaConfig.Net.SASL.Enable = true
+			kafkaConfig.Net.SASL.Mechanism = sarama.SASLTypeOAuth
+			kafkaConfig.Net.SASL.TokenProvider = &kafkaOAuthTokenProvider{source: serviceToken}
+		}
+	}
+
+	producer, err := sarama.NewAsyncProducer(config.KafkaBrokers, kafkaConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kafka producer: %w", err)
 	}
 
+	endpointManager := make(map[string]*kafka.EndpointManager)
+	for _, baseTopic := range []string{"device-events", "device-alerts", "device-events-cleared"} {
+		endpointManager[baseTopic] = kafka.NewEndpointManager(baseTopic, config.KafkaTopicPoolSize)
+	}
+
+	var jwks *jwksCache
+	if config.OAuthJWKSURL != "" {
+		jwks = newJWKSCache(config.OAuthJWKSURL)
+	}
+
+	health := NewHealthChecker()
+	health.Register("kafka-producer", true)
+	health.Register("device-service", true)
+	health.Register("jwks-fetcher", false)
+
+	deviceSvcHealth := newConsecutiveFailureTracker(health, "device-service", ReasonConnectionError, 3)
+	health.SetHealthy("kafka-producer")
+
+	publisher := NewAsyncPublisher(producer, health, config.PublishBufferSize, config.AlertReservedSlots,
+		config.PublishMaxRetries, config.DLQTopic, config.WALPath)
+
 	return &Service{
-		config:   config,
-		producer: producer,
-		router:   mux.NewRouter(),
-		client:   &http.Client{Timeout: 5 * time.Second},
+		config:          config,
+		producer:        producer,
+		publisher:       publisher,
+		router:          mux.NewRouter(),
+		client:          &http.Client{Timeout: 5 * time.Second},
+		endpointManager: endpointManager,
+		serviceToken:    serviceToken,
+		jwks:            jwks,
+		filters:         NewFilterStore(),
+		health:          health,
+		deviceSvcHealth: deviceSvcHealth,
 	}, nil
 }
 
+// topicFor resolves the sharded Kafka topic an event should be published to:
+// the severity picks the topic family, and the family's EndpointManager picks
+// the device's shard within it (falling back to the unsharded family name if
+// no manager was configured for it, e.g. the heartbeats topic).
+func (s *Service) topicFor(event DeviceEvent) string {
+	family := topicForSeverity(event.Severity)
+	manager, ok := s.endpointManager[family]
+	if !ok {
+		return family
+	}
+	return manager.TopicForDevice(event.DeviceID)
+}
+
+// refreshTopicOverrides periodically pulls the device-service's pinned
+// device-to-topic override table so high-value devices can be routed off the
+// general-fleet shards without a ring resize.
+func (s *Service) refreshTopicOverrides(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		s.fetchTopicOverrides()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) fetchTopicOverrides() {
+	req, _ := http.NewRequest("GET", s.config.DeviceServiceURL+"/internal/devices/topic-overrides", nil)
+	s.setServiceAuth(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		log.Printf("Error fetching topic overrides: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+
+	var overrides map[string]map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&overrides); err != nil {
+		log.Printf("Error decoding topic overrides: %v", err)
+		return
+	}
+
+	for baseTopic, deviceOverrides := range overrides {
+		if manager, ok := s.endpointManager[baseTopic]; ok {
+			manager.ReplaceOverrides(deviceOverrides)
+		}
+	}
+}
+
 // SetupRoutes configures all HTTP routes
 func (s *Service) SetupRoutes() {
-	s.router.HandleFunc("/health", s.healthCheck).Methods("GET")
+	s.router.HandleFunc("/healthz", s.healthzHandler).Methods("GET")
+	s.router.HandleFunc("/readyz", s.readyzHandler).Methods("GET")
+	s.router.HandleFunc("/health", s.healthHandler).Methods("GET")
 	s.router.Handle("/metrics", promhttp.Handler())
 
 	// Device ingestion endpoints
@@ -128,10 +400,31 @@ func (s *Service) SetupRoutes() {
 	s.router.HandleFunc("/ingest/heartbeat", s.ingestHeartbeat).Methods("POST")
 	s.router.HandleFunc("/ingest/telemetry", s.ingestTelemetry).Methods("POST")
 	s.router.HandleFunc("/ingest/alert", s.ingestAlert).Methods("POST")
+	s.router.HandleFunc("/ingest/batch", s.ingestBatch).Methods("POST")
+	s.router.HandleFunc("/ingest/filters", s.registerFilter).Methods("POST")
+
+	// Internal/debug endpoints
+	s.router.HandleFunc("/internal/routing/{device_id}", s.getDeviceRouting).Methods("GET")
 }
 
-func (s *Service) healthCheck(w http.ResponseWriter, r *http.Request) {
-	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "healthy"})
+func (s *Service) getDeviceRouting(w http.ResponseWriter, r *http.Request) {
+	deviceID := mux.Vars(r)["device_id"]
+
+	assignments := make(map[string]interface{})
+	for baseTopic, manager := range s.endpointManager {
+		replicaBaseTopic, replicas, epoch := manager.Snapshot()
+		assignments[baseTopic] = map[string]interface{}{
+			"topic":    manager.TopicForDevice(deviceID),
+			"replicas": replicas,
+			"epoch":    epoch,
+			"base":     replicaBaseTopic,
+		}
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"device_id": deviceID,
+		"routing":   assignments,
+	})
 }
 
 func (s *Service) ingestEvent(w http.ResponseWriter, r *http.Request) {
@@ -173,19 +466,25 @@ func (s *Service) ingestEvent(w http.ResponseWriter, r *http.Request) {
 		Payload:   payload,
 	}
 
-	// Publish to Kafka
-	if err := s.publishEvent("device-events", event); err != nil {
+	if err := classifyEvent(&event, payload); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Publish to Kafka, routed by severity
+	if err := s.publishEvent(s.topicFor(event), event, false); err != nil {
 		log.Printf("Error publishing event: %v", err)
 		s.errorResponse(w, http.StatusInternalServerError, "Failed to process event")
 		return
 	}
 
-	eventsReceived.WithLabelValues(eventType, event.DeviceID).Inc()
+	eventsReceived.WithLabelValues(eventType, event.DeviceID, event.Category, event.Severity).Inc()
 
 	s.jsonResponse(w, http.StatusAccepted, map[string]interface{}{
-		"id":      event.ID,
-		"status":  "accepted",
-		"message": "Event received and queued for processing",
+		"id":       event.ID,
+		"alarm_id": event.AlarmID,
+		"status":   "accepted",
+		"message":  "Event received and queued for processing",
 	})
 }
 
@@ -218,9 +517,9 @@ func (s *Service) ingestHeartbeat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Publish to heartbeats topic
-	s.publishEvent("device-heartbeats", event)
+	s.publishEvent("device-heartbeats", event, false)
 
-	eventsReceived.WithLabelValues("heartbeat", event.DeviceID).Inc()
+	eventsReceived.WithLabelValues("heartbeat", event.DeviceID, "", "").Inc()
 
 	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "ok"})
 }
@@ -238,6 +537,11 @@ func (s *Service) ingestTelemetry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.publisher.OverCapacity() {
+		s.errorResponse(w, http.StatusTooManyRequests, "Publish buffer under backpressure, retry later")
+		return
+	}
+
 	var payload map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
@@ -253,10 +557,15 @@ func (s *Service) ingestTelemetry(w http.ResponseWriter, r *http.Request) {
 		Payload:   payload,
 	}
 
-	// Publish to events topic
-	s.publishEvent("device-events", event)
+	if err := classifyEvent(&event, payload); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Publish to events topic, routed by severity
+	s.publishEvent(s.topicFor(event), event, false)
 
-	eventsReceived.WithLabelValues("telemetry", event.DeviceID).Inc()
+	eventsReceived.WithLabelValues("telemetry", event.DeviceID, event.Category, event.Severity).Inc()
 
 	s.jsonResponse(w, http.StatusAccepted, map[string]interface{}{
 		"id":     event.ID,
@@ -292,15 +601,26 @@ func (s *Service) ingestAlert(w http.ResponseWriter, r *http.Request) {
 		Payload:   payload,
 	}
 
-	// Publish to alerts topic (higher priority)
-	s.publishEvent("device-alerts", event)
+	if err := classifyEvent(&event, payload); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Alerts default to MAJOR severity when the device didn't specify one.
+	if _, hasSeverity := payload["severity"]; !hasSeverity {
+		event.Severity = SeverityMajor
+	}
+
+	// Publish to the topic for this severity (alerts always at least MAJOR,
+	// so this lands on device-alerts unless explicitly cleared).
+	s.publishEvent(s.topicFor(event), event, true)
 
-	eventsReceived.WithLabelValues("alert", event.DeviceID).Inc()
+	eventsReceived.WithLabelValues("alert", event.DeviceID, event.Category, event.Severity).Inc()
 
 	s.jsonResponse(w, http.StatusAccepted, map[string]interface{}{
-		"id":      event.ID,
-		"status":  "accepted",
-		"message": "Alert received and queued for immediate processing",
+		"id":       event.ID,
+		"alarm_id": event.AlarmID,
+		"status":   "accepted",
+		"message":  "Alert received and queued for immediate processing",
 	})
 }
 
@@ -310,17 +630,31 @@ type DeviceInfo struct {
 }
 
 func (s *Service) validateDeviceToken(token string) (*DeviceInfo, error) {
+	if s.jwks != nil {
+		if info, err := s.validateDeviceJWT(token); err == nil {
+			return info, nil
+		}
+	}
+
 	body, _ := json.Marshal(map[string]string{"token": token})
 	req, _ := http.NewRequest("POST", s.config.DeviceServiceURL+"/internal/devices/validate-token",
 		bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
+	s.setServiceAuth(req)
 
 	resp, err := s.client.Do(req)
 	if err != nil {
+		s.deviceSvcHealth.recordFailure(err.Error())
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= 500 {
+		s.deviceSvcHealth.recordFailure(fmt.Sprintf("status %d", resp.StatusCode))
+		return nil, fmt.Errorf("invalid token")
+	}
+	s.deviceSvcHealth.recordSuccess()
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("invalid token")
 	}
@@ -345,29 +679,46 @@ func (s *Service) validateDeviceToken(token string) (*DeviceInfo, error) {
 func (s *Service) updateDeviceHeartbeat(deviceID string) {
 	req, _ := http.NewRequest("POST",
 		fmt.Sprintf("%s/internal/devices/%s/heartbeat", s.config.DeviceServiceURL, deviceID), nil)
-	s.client.Do(req)
-}
+	s.setServiceAuth(req)
 
-func (s *Service) publishEvent(topic string, event DeviceEvent) error {
-	eventBytes, err := json.Marshal(event)
+	resp, err := s.client.Do(req)
 	if err != nil {
-		return err
+		s.deviceSvcHealth.recordFailure(err.Error())
+		return
 	}
+	defer resp.Body.Close()
 
-	msg := &sarama.ProducerMessage{
-		Topic:     topic,
-		Key:       sarama.StringEncoder(event.DeviceID),
-		Value:     sarama.ByteEncoder(eventBytes),
-		Timestamp: event.Timestamp,
+	if resp.StatusCode >= 500 {
+		s.deviceSvcHealth.recordFailure(fmt.Sprintf("status %d", resp.StatusCode))
+		return
 	}
+	s.deviceSvcHealth.recordSuccess()
+}
 
-	_, _, err = s.producer.SendMessage(msg)
+// setServiceAuth attaches this service's own OAuth2 token to an outbound
+// device-service call, when client-credentials auth is configured.
+func (s *Service) setServiceAuth(req *http.Request) {
+	if s.serviceToken == nil {
+		return
+	}
+	token, err := s.serviceToken.Token()
+	if err != nil {
+		log.Printf("Error obtaining service token: %v", err)
+		return
+	}
+	token.SetAuthHeader(req)
+}
+
+// publishEvent hands event to the async publisher instead of blocking on a
+// Kafka round-trip; isAlert routes it to the reserved alert buffer so it
+// keeps being accepted when the shared buffer is under backpressure.
+func (s *Service) publishEvent(topic string, event DeviceEvent, isAlert bool) error {
+	eventBytes, err := json.Marshal(event)
 	if err != nil {
 		return err
 	}
 
-	eventsPublished.WithLabelValues(topic).Inc()
-	return nil
+	return s.publisher.Enqueue(topic, event.DeviceID, eventBytes, isAlert)
 }
 
 func (s *Service) jsonResponse(w http.ResponseWriter, status int, data interface{}) {
@@ -392,7 +743,14 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to create service: %v", err)
 	}
-	defer service.producer.Close()
+
+	publishCtx, stopPublisher := context.WithCancel(context.Background())
+	defer stopPublisher()
+	service.publisher.Start(publishCtx, config.PublishWorkers)
+
+	overrideCtx, stopOverrideRefresh := context.WithCancel(context.Background())
+	defer stopOverrideRefresh()
+	go service.refreshTopicOverrides(overrideCtx)
 
 	service.SetupRoutes()
 
@@ -416,6 +774,10 @@ func main() {
 		if err := server.Shutdown(ctx); err != nil {
 			log.Printf("Server shutdown error: %v", err)
 		}
+
+		service.publisher.Drain(30 * time.Second)
+		stopPublisher()
+		service.producer.Close()
 	}()
 
 	log.Printf("Device Ingest Service listening on port %s", config.Port)
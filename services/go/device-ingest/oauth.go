@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// OAuth metrics, modeled on the O-RAN pm-rapp's token-lifecycle instrumentation.
+var (
+	tokenRefreshes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "device_ingest_oauth_token_refreshes_total",
+			Help: "Total number of OAuth2 service tokens obtained or refreshed",
+		},
+		[]string{"result"},
+	)
+	jwksMisses = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "device_ingest_jwks_misses_total",
+			Help: "Total number of device JWT validations that required a JWKS refresh",
+		},
+	)
+	deviceTokenValidationFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "device_ingest_device_token_validation_failures_total",
+			Help: "Total number of device bearer token validation failures",
+		},
+		[]string{"reason"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(tokenRefreshes)
+	prometheus.MustRegister(jwksMisses)
+	prometheus.MustRegister(deviceTokenValidationFailures)
+}
+
+// serviceTokenSource wraps an OAuth2 client-credentials flow so the ingest
+// service can authenticate its own calls to device-service, counting each
+// underlying token fetch as a refresh.
+type serviceTokenSource struct {
+	oauth2.TokenSource
+}
+
+func newServiceTokenSource(config *Config) *serviceTokenSource {
+	cc := &clientcredentials.Config{
+		ClientID:     config.OAuthClientID,
+		ClientSecret: config.OAuthClientSecret,
+		TokenURL:     config.OAuthTokenURL,
+	}
+	return &serviceTokenSource{TokenSource: cc.TokenSource(context.Background())}
+}
+
+func (s *serviceTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.TokenSource.Token()
+	if err != nil {
+		tokenRefreshes.WithLabelValues("error").Inc()
+		return nil, err
+	}
+	tokenRefreshes.WithLabelValues("success").Inc()
+	return token, nil
+}
+
+// kafkaOAuthTokenProvider adapts a serviceTokenSource to sarama's
+// AccessTokenProvider interface for SASL/OAUTHBEARER broker authentication.
+type kafkaOAuthTokenProvider struct {
+	source *serviceTokenSource
+}
+
+func (p *kafkaOAuthTokenProvider) Token() (*sarama.AccessToken, error) {
+	token, err := p.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	return &sarama.AccessToken{Token: token.AccessToken}, nil
+}
+
+// jwksCache holds RSA public keys fetched from an OAuth2 authorization
+// server's JWKS endpoint, refreshed lazily on key-ID cache misses and
+// periodically in the background so a key rotation is picked up without
+// every request paying the fetch cost.
+type jwksCache struct {
+	url    string
+	client *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func newJWKSCache(url string) *jwksCache {
+	return &jwksCache{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+}
+
+type jwksDocument struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+func (c *jwksCache) refresh() error {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS endpoint returned status %d", resp.StatusCode)
+	}
+
+	var doc jwksDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("decoding JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		key, err := rsaPublicKeyFromJWK(k.N, k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	c.mu.Unlock()
+
+	return nil
+}
+
+// keyFor returns the public key for kid, refreshing the cache once on a miss
+// in case it belongs to a key that rotated in since the last fetch.
+func (c *jwksCache) keyFor(kid string) (*rsa.PublicKey, error) {
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	c.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	jwksMisses.Inc()
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, ok = c.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+	return key, nil
+}
+
+func rsaPublicKeyFromJWK(nEncoded, eEncoded string) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(nEncoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding modulus: %w", err)
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(eEncoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding exponent: %w", err)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nBytes),
+		E: int(new(big.Int).SetBytes(eBytes).Int64()),
+	}, nil
+}
+
+// DeviceClaims are the claims expected in a device-presented JWT bearer
+// token, validated locally against the JWKS instead of round-tripping to
+// device-service on every request.
+type DeviceClaims struct {
+	DeviceID string `json:"device_id"`
+	UserID   string `json:"user_id"`
+	jwt.RegisteredClaims
+}
+
+// validateDeviceJWT verifies a device bearer token locally using the cached
+// JWKS, falling back to the caller when the token isn't a recognized JWT so
+// callers can still fall back to the remote device-service validation.
+func (s *Service) validateDeviceJWT(tokenString string) (*DeviceInfo, error) {
+	claims := &DeviceClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, fmt.Errorf("token missing kid header")
+		}
+		key, err := s.jwks.keyFor(kid)
+		if err != nil {
+			s.health.SetFailed("jwks-fetcher", ReasonConnectionError, err.Error())
+			return nil, err
+		}
+		s.health.SetHealthy("jwks-fetcher")
+		return key, nil
+	})
+	if err != nil || !token.Valid {
+		deviceTokenValidationFailures.WithLabelValues("invalid_token").Inc()
+		return nil, fmt.Errorf("invalid device token: %w", err)
+	}
+
+	if claims.DeviceID == "" {
+		deviceTokenValidationFailures.WithLabelValues("missing_device_id").Inc()
+		return nil, fmt.Errorf("device token missing device_id claim")
+	}
+
+	return &DeviceInfo{DeviceID: claims.DeviceID, UserID: claims.UserID}, nil
+}
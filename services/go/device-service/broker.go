@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	defaultCommandTimeout = 10 * time.Second
+	maxDeviceQueueDepth   = 50
+
+	// maxPublishAttempts bounds how many times Send retries a failed
+	// transport publish before giving up, with exponential backoff
+	// between attempts.
+	maxPublishAttempts    = 3
+	publishRetryBaseDelay = 200 * time.Millisecond
+)
+
+var (
+	errQueueFull      = errors.New("device command queue is full")
+	errCommandTimeout = errors.New("timed out waiting for device response")
+)
+
+// Command lifecycle states: pending -> dispatched -> acknowledged ->
+// completed | failed | timed_out | cancelled.
+const (
+	CommandStatusPending      = "pending"
+	CommandStatusDispatched   = "dispatched"
+	CommandStatusAcknowledged = "acknowledged"
+	CommandStatusCompleted    = "completed"
+	CommandStatusFailed       = "failed"
+	CommandStatusTimedOut     = "timed_out"
+	CommandStatusCancelled    = "cancelled"
+)
+
+// commandTerminal reports whether status is one a command can no longer
+// transition out of.
+func commandTerminal(status string) bool {
+	switch status {
+	case CommandStatusCompleted, CommandStatusFailed, CommandStatusTimedOut, CommandStatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+var (
+	commandQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "device_command_queue_depth",
+			Help: "Number of in-flight commands queued per device",
+		},
+		[]string{"device_id"},
+	)
+	commandLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "device_command_latency_seconds",
+			Help:    "End-to-end latency of device commands from publish to ack/timeout",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"command", "device_type", "outcome"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(commandQueueDepth)
+	prometheus.MustRegister(commandLatency)
+}
+
+// CommandResult is the payload a device (or its gateway) publishes to the
+// device-responses Kafka topic once it has processed a command.
+type CommandResult struct {
+	CorrelationID string                 `json:"correlation_id"`
+	Status        string                 `json:"status"`
+	Response      map[string]interface{} `json:"response,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+}
+
+// deviceQueue serializes commands for a single device: the mutex enforces
+// FIFO ordering across goroutines sending to the same device, and the
+// buffered channel acts as a non-blocking semaphore that bounds how many
+// commands can be in flight for that device at once.
+type deviceQueue struct {
+	mu   sync.Mutex
+	slot chan struct{}
+}
+
+func newDeviceQueue() *deviceQueue {
+	return &deviceQueue{slot: make(chan struct{}, maxDeviceQueueDepth)}
+}
+
+func (q *deviceQueue) tryAcquire() bool {
+	select {
+	case q.slot <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *deviceQueue) release() {
+	<-q.slot
+}
+
+// CommandBroker implements an async request/response flow over Kafka,
+// modeled on VOLTHA's InterContainerProxy: commands are published to
+// KafkaCommandsTopic keyed by device ID, and responses published to
+// KafkaResponsesTopic are matched back to the waiting caller by
+// correlation ID and delivered through a channel.
+type CommandBroker struct {
+	service *Service
+
+	queuesMu sync.Mutex
+	queues   map[string]*deviceQueue
+
+	pendingMu sync.Mutex
+	pending   map[string]chan *CommandResult
+
+	consumer sarama.Consumer
+}
+
+// NewCommandBroker wires up the response consumer for a service. If Kafka
+// brokers aren't configured it degrades gracefully, matching NewService's
+// handling of Mongo/Redis/Kafka: commands are still accepted and published
+// (publishToKafka itself no-ops without a producer), they just always run
+// out the clock waiting for a response that will never arrive.
+func NewCommandBroker(s *Service) *CommandBroker {
+	b := &CommandBroker{
+		service: s,
+		queues:  make(map[string]*deviceQueue),
+		pending: make(map[string]chan *CommandResult),
+	}
+
+	if len(s.config.KafkaBrokers) == 0 || s.config.KafkaBrokers[0] == "" {
+		log.Printf("Warning: no Kafka brokers configured - command broker will run without response consumption")
+		return b
+	}
+
+	consumer, err := sarama.NewConsumer(s.config.KafkaBrokers, sarama.NewConfig())
+	if err != nil {
+		log.Printf("Warning: failed to create Kafka consumer: %v - command broker will run without response consumption", err)
+		return b
+	}
+
+	b.consumer = consumer
+	go b.consumeResponses()
+
+	return b
+}
+
+func (b *CommandBroker) consumeResponses() {
+	topic := b.service.config.KafkaResponsesTopic
+
+	partitions, err := b.consumer.Partitions(topic)
+	if err != nil {
+		log.Printf("Warning: failed to list partitions for topic %s: %v", topic, err)
+		return
+	}
+
+	for _, partition := range partitions {
+		pc, err := b.consumer.ConsumePartition(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			log.Printf("Warning: failed to consume partition %d of topic %s: %v", partition, topic, err)
+			continue
+		}
+
+		go func(pc sarama.PartitionConsumer) {
+			defer pc.Close()
+			for msg := range pc.Messages() {
+				b.handleResponse(msg.Value)
+			}
+		}(pc)
+	}
+}
+
+func (b *CommandBroker) handleResponse(data []byte) {
+	var result CommandResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		log.Printf("Error unmarshaling device response: %v", err)
+		return
+	}
+
+	b.pendingMu.Lock()
+	ch, ok := b.pending[result.CorrelationID]
+	if ok {
+		delete(b.pending, result.CorrelationID)
+	}
+	b.pendingMu.Unlock()
+
+	if !ok {
+		// No one is waiting - the request already timed out or was never ours.
+		return
+	}
+
+	ch <- &result
+}
+
+func (b *CommandBroker) queueFor(deviceID string) *deviceQueue {
+	b.queuesMu.Lock()
+	defer b.queuesMu.Unlock()
+
+	q, ok := b.queues[deviceID]
+	if !ok {
+		q = newDeviceQueue()
+		b.queues[deviceID] = q
+	}
+	return q
+}
+
+// Send publishes event to KafkaCommandsTopic and blocks until a matching
+// response arrives on KafkaResponsesTopic, ctx is cancelled, or timeout
+// elapses. Commands for the same device are serialized FIFO by the
+// device's queue mutex; a full queue returns errQueueFull immediately.
+//
+// A failed transport publish is retried up to maxPublishAttempts times
+// with exponential backoff before Send gives up; the caller already holds
+// the device's lock for the duration of Send, so these retries stay
+// strictly ordered against any other command for the same device. Once a
+// publish attempt succeeds, onDispatched (if non-nil) is called before
+// Send blocks waiting for the device's response.
+func (b *CommandBroker) Send(ctx context.Context, event *KafkaEvent, timeout time.Duration, onDispatched func()) (*CommandResult, error) {
+	q := b.queueFor(event.DeviceID)
+
+	if !q.tryAcquire() {
+		return nil, errQueueFull
+	}
+	defer q.release()
+	commandQueueDepth.WithLabelValues(event.DeviceID).Inc()
+	defer commandQueueDepth.WithLabelValues(event.DeviceID).Dec()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	deviceType := ""
+	if event.Device != nil {
+		deviceType = event.Device.Type
+	}
+
+	resultCh := make(chan *CommandResult, 1)
+	b.pendingMu.Lock()
+	b.pending[event.ID] = resultCh
+	b.pendingMu.Unlock()
+
+	start := time.Now()
+	cleanup := func() {
+		b.pendingMu.Lock()
+		delete(b.pending, event.ID)
+		b.pendingMu.Unlock()
+	}
+
+	var publishErr error
+	for attempt := 0; attempt < maxPublishAttempts; attempt++ {
+		if attempt > 0 {
+			backoff := publishRetryBaseDelay * time.Duration(1<<uint(attempt-1))
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				cleanup()
+				return nil, ctx.Err()
+			}
+		}
+
+		publishErr = b.publish(ctx, event)
+		if publishErr == nil {
+			break
+		}
+		log.Printf("Warning: publish attempt %d/%d failed for command %s: %v", attempt+1, maxPublishAttempts, event.ID, publishErr)
+	}
+
+	if publishErr != nil {
+		cleanup()
+		commandLatency.WithLabelValues(event.Command, deviceType, "publish_error").Observe(time.Since(start).Seconds())
+		return nil, publishErr
+	}
+
+	if onDispatched != nil {
+		onDispatched()
+	}
+
+	select {
+	case result := <-resultCh:
+		outcome := result.Status
+		if outcome == "" {
+			outcome = "acked"
+		}
+		commandLatency.WithLabelValues(event.Command, deviceType, outcome).Observe(time.Since(start).Seconds())
+		return result, nil
+
+	case <-time.After(timeout):
+		cleanup()
+		commandLatency.WithLabelValues(event.Command, deviceType, "timed_out").Observe(time.Since(start).Seconds())
+		return nil, errCommandTimeout
+
+	case <-ctx.Done():
+		cleanup()
+		commandLatency.WithLabelValues(event.Command, deviceType, "cancelled").Observe(time.Since(start).Seconds())
+		return nil, ctx.Err()
+	}
+}
+
+// Cancel resolves an in-flight Send call for commandID as cancelled, so it
+// returns immediately instead of waiting out its timeout. It reports
+// whether a wait was actually in flight; false means the command had
+// already reached a terminal state (or was never sent) before the cancel
+// arrived.
+func (b *CommandBroker) Cancel(commandID string) bool {
+	b.pendingMu.Lock()
+	ch, ok := b.pending[commandID]
+	if ok {
+		delete(b.pending, commandID)
+	}
+	b.pendingMu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	ch <- &CommandResult{CorrelationID: commandID, Status: CommandStatusCancelled}
+	return true
+}
+
+// publish delivers event over whichever transport(s) the target device is
+// configured for: Kafka by default, MQTT if Device.Transport is "mqtt", or
+// both if it's "both". Devices speaking plain MQTT never see a Kafka
+// publish at all, and vice versa for the default.
+func (b *CommandBroker) publish(ctx context.Context, event *KafkaEvent) error {
+	transport := ""
+	if event.Device != nil {
+		transport = event.Device.Transport
+	}
+
+	if transport != "mqtt" {
+		if err := b.service.publishToKafka(ctx, event); err != nil {
+			return err
+		}
+	}
+	if transport == "mqtt" || transport == "both" {
+		if err := b.service.mqtt.PublishCommand(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the broker's Kafka consumer, if any.
+func (b *CommandBroker) Close() {
+	if b.consumer != nil {
+		b.consumer.Close()
+	}
+}
+
+// updateCommandStatus persists a command's state transition (pending ->
+// sent -> acked/timeout/failed) and, once available, the device's response.
+func (s *Service) updateCommandStatus(ctx context.Context, commandID, status string, response map[string]interface{}) {
+	if s.commands == nil {
+		return
+	}
+
+	update := bson.M{"status": status, "updated_at": time.Now()}
+	if response != nil {
+		update["response"] = response
+	}
+
+	if _, err := s.commands.UpdateOne(ctx, bson.M{"_id": commandID}, bson.M{"$set": update}); err != nil {
+		log.Printf("Error updating command %s status to %s: %v", commandID, status, err)
+	}
+}
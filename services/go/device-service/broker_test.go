@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestBroker() *CommandBroker {
+	return &CommandBroker{
+		service: &Service{},
+		queues:  make(map[string]*deviceQueue),
+		pending: make(map[string]chan *CommandResult),
+	}
+}
+
+func TestCommandBrokerSendReturnsResponseResult(t *testing.T) {
+	b := newTestBroker()
+	event := &KafkaEvent{ID: "cmd-1", DeviceID: "device-1", Command: "set_mode"}
+
+	go func() {
+		// Give Send a moment to register the pending channel before the
+		// response "arrives" on the Kafka consumer goroutine's behalf.
+		time.Sleep(10 * time.Millisecond)
+		b.handleResponse([]byte(`{"correlation_id":"cmd-1","status":"completed"}`))
+	}()
+
+	result, err := b.Send(context.Background(), event, time.Second, nil)
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if result.Status != CommandStatusCompleted {
+		t.Errorf("result.Status = %q, want %q", result.Status, CommandStatusCompleted)
+	}
+}
+
+func TestCommandBrokerSendTimesOut(t *testing.T) {
+	b := newTestBroker()
+	event := &KafkaEvent{ID: "cmd-2", DeviceID: "device-2", Command: "set_mode"}
+
+	_, err := b.Send(context.Background(), event, 20*time.Millisecond, nil)
+	if err != errCommandTimeout {
+		t.Fatalf("Send err = %v, want %v", err, errCommandTimeout)
+	}
+
+	// A response arriving after the timeout must not find a pending waiter.
+	b.pendingMu.Lock()
+	_, stillPending := b.pending[event.ID]
+	b.pendingMu.Unlock()
+	if stillPending {
+		t.Error("pending entry for a timed-out command was not cleaned up")
+	}
+}
+
+func TestCommandBrokerCancelResolvesInFlightSend(t *testing.T) {
+	b := newTestBroker()
+	event := &KafkaEvent{ID: "cmd-3", DeviceID: "device-3", Command: "set_mode"}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		if !b.Cancel(event.ID) {
+			t.Error("Cancel on an in-flight command = false, want true")
+		}
+	}()
+
+	result, err := b.Send(context.Background(), event, time.Second, nil)
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if result.Status != CommandStatusCancelled {
+		t.Errorf("result.Status = %q, want %q", result.Status, CommandStatusCancelled)
+	}
+}
+
+func TestCommandBrokerCancelAfterCompletionReportsFalse(t *testing.T) {
+	b := newTestBroker()
+
+	// Nothing was ever sent under this ID, so Cancel must report false
+	// rather than racing a non-existent waiter.
+	if b.Cancel("never-sent") {
+		t.Error("Cancel on an unknown command ID = true, want false")
+	}
+}
+
+func TestCommandBrokerSendIsSerializedPerDevice(t *testing.T) {
+	b := newTestBroker()
+
+	done := make(chan struct{})
+	go func() {
+		event := &KafkaEvent{ID: "cmd-4", DeviceID: "device-4", Command: "set_mode"}
+		b.Send(context.Background(), event, 30*time.Millisecond, nil)
+		close(done)
+	}()
+
+	// Give the first Send time to acquire device-4's queue lock.
+	time.Sleep(5 * time.Millisecond)
+
+	start := time.Now()
+	event2 := &KafkaEvent{ID: "cmd-5", DeviceID: "device-4", Command: "set_mode"}
+	b.Send(context.Background(), event2, 30*time.Millisecond, nil)
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("second Send for the same device returned after %v, want it to wait for the first to finish (FIFO ordering)", elapsed)
+	}
+
+	<-done
+}
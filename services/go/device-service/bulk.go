@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/homeguard/device-service/devicestate"
+)
+
+// bulkWorkerPoolSize bounds how many devices/commands a bulk endpoint
+// works on concurrently, so a large request can't open thousands of
+// simultaneous Mongo/Kafka operations at once.
+const bulkWorkerPoolSize = 8
+
+// bulkDeviceResult is one device's outcome from POST /devices/bulk.
+type bulkDeviceResult struct {
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// bulkCommandResult is one device's outcome from POST /devices/bulk/command.
+type bulkCommandResult struct {
+	DeviceID      string `json:"device_id"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+}
+
+// bulkDeleteFilter is the set of fields DELETE /devices/bulk can filter
+// on, in addition to the caller's own user_id. At least one must be set -
+// this endpoint is for tagged cleanup, not "delete everything I own".
+type bulkDeleteFilter struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Tag    string `json:"tag"`
+}
+
+// bulkCreateDevices validates and inserts a batch of devices. Validation
+// and defaulting for each device runs on a bounded worker pool, then the
+// devices that passed validation are written with a single unordered
+// InsertMany so one bad document doesn't block the rest, and per-document
+// write errors can be mapped back to their original index.
+func (s *Service) bulkCreateDevices(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Devices []Device `json:"devices"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Devices) == 0 {
+		s.errorResponse(w, http.StatusBadRequest, "devices must be a non-empty array")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(withRequestLogger(r.Context(), r, userID, ""), 30*time.Second)
+	defer cancel()
+
+	prepared := make([]Device, len(req.Devices))
+	results := make([]bulkDeviceResult, len(req.Devices))
+
+	sem := make(chan struct{}, bulkWorkerPoolSize)
+	var wg sync.WaitGroup
+	for i := range req.Devices {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			device := req.Devices[i]
+			if device.Name == "" || device.Type == "" {
+				results[i] = bulkDeviceResult{Name: device.Name, Status: "error", Error: "name and type are required"}
+				return
+			}
+
+			device.ID = uuid.New().String()
+			device.UserID = userID
+			device.Status = "inactive"
+			device.Online = false
+			device.Token = uuid.New().String()
+			device.CreatedAt = time.Now()
+			device.UpdatedAt = time.Now()
+			device.LastSeen = time.Time{}
+			if device.Config == nil {
+				device.Config = make(map[string]interface{})
+			}
+			if device.Metadata == nil {
+				device.Metadata = make(map[string]interface{})
+			}
+
+			prepared[i] = device
+			results[i] = bulkDeviceResult{ID: device.ID, Name: device.Name, Status: "created"}
+		}(i)
+	}
+	wg.Wait()
+
+	// docIndex[j] is the original request index of docs[j], so a bulk
+	// write error's Index (position within docs) can be mapped back to
+	// the result slot the caller sees.
+	docs := make([]interface{}, 0, len(req.Devices))
+	docIndex := make([]int, 0, len(req.Devices))
+	for i, res := range results {
+		if res.Status == "created" {
+			docs = append(docs, prepared[i])
+			docIndex = append(docIndex, i)
+		}
+	}
+
+	if len(docs) > 0 {
+		_, err := s.devices.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		if err != nil {
+			var bwe mongo.BulkWriteException
+			if errors.As(err, &bwe) {
+				for _, we := range bwe.WriteErrors {
+					origIndex := docIndex[we.Index]
+					results[origIndex].Status = "error"
+					results[origIndex].Error = we.Message
+				}
+			} else {
+				log.Printf("Error bulk creating devices: %v", err)
+				for _, origIndex := range docIndex {
+					results[origIndex].Status = "error"
+					results[origIndex].Error = "failed to insert device"
+				}
+				docs = docs[:0]
+			}
+		}
+	}
+
+	created := 0
+	for i, res := range results {
+		if res.Status != "created" {
+			continue
+		}
+		created++
+
+		tok := DeviceToken{
+			ID:        uuid.New().String(),
+			DeviceID:  prepared[i].ID,
+			UserID:    userID,
+			Token:     prepared[i].Token,
+			Label:     "default",
+			CreatedAt: prepared[i].CreatedAt,
+		}
+		if _, err := s.deviceTokens.InsertOne(ctx, tok); err != nil {
+			log.Printf("Warning: failed to persist initial device token for %s: %v", prepared[i].ID, err)
+		}
+	}
+
+	if created > 0 {
+		s.invalidateUserDeviceCache(ctx, userID)
+		deviceOperations.WithLabelValues("bulk_create").Add(float64(created))
+		s.publishActivity(ctx, "mongodb", "\xf0\x9f\x93\xa6", "Bulk Devices Created",
+			fmt.Sprintf("%d of %d devices created in bulk", created, len(req.Devices)),
+			userID, "", "info")
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"results": results,
+		"created": created,
+		"failed":  len(req.Devices) - created,
+	})
+}
+
+// bulkSendCommand fans a single command out to many devices concurrently,
+// reusing CommandBroker so each device gets its own correlation ID and
+// ack/timeout/failure outcome, same as sendCommand does for one device.
+func (s *Service) bulkSendCommand(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		DeviceIDs []string               `json:"device_ids"`
+		Command   string                 `json:"command"`
+		Payload   map[string]interface{} `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.DeviceIDs) == 0 || req.Command == "" {
+		s.errorResponse(w, http.StatusBadRequest, "device_ids and command are required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(withRequestLogger(r.Context(), r, userID, ""), 30*time.Second)
+	defer cancel()
+
+	results := make([]bulkCommandResult, len(req.DeviceIDs))
+	sem := make(chan struct{}, bulkWorkerPoolSize)
+	var wg sync.WaitGroup
+	for i, deviceID := range req.DeviceIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, deviceID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = s.dispatchBulkCommand(ctx, userID, deviceID, req.Command, req.Payload)
+		}(i, deviceID)
+	}
+	wg.Wait()
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{"results": results})
+}
+
+// dispatchBulkCommand sends one command to one device and reports its
+// outcome; it's the per-device unit of work bulkSendCommand fans out.
+func (s *Service) dispatchBulkCommand(ctx context.Context, userID, deviceID, command string, payload map[string]interface{}) bulkCommandResult {
+	var device Device
+	err := s.devices.FindOne(ctx, bson.M{"_id": deviceID, "user_id": userID}).Decode(&device)
+	if err == mongo.ErrNoDocuments {
+		return bulkCommandResult{DeviceID: deviceID, Status: "error", Error: "device not found"}
+	}
+	if err != nil {
+		return bulkCommandResult{DeviceID: deviceID, Status: "error", Error: "failed to find device"}
+	}
+
+	if s.deviceState.Get(deviceID) == devicestate.DeleteRequested {
+		return bulkCommandResult{DeviceID: deviceID, Status: "error", Error: "device is being deleted"}
+	}
+
+	// Hold the device's lock for the rest of the dispatch, same as
+	// sendCommand: this is the shared per-device serialization path for
+	// bulk commands and rule-engine actions, so without it either could
+	// race a concurrent sendCommand (or each other) into an interleaved
+	// Mongo write or Kafka publish for the same device.
+	release, err := s.requestLocks.Acquire(deviceID)
+	if err != nil {
+		return bulkCommandResult{DeviceID: deviceID, Status: "error", Error: "too many pending commands for this device"}
+	}
+	defer release()
+
+	cmd := DeviceCommand{
+		ID:        uuid.New().String(),
+		DeviceID:  deviceID,
+		UserID:    userID,
+		Command:   command,
+		Payload:   payload,
+		Status:    CommandStatusPending,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if _, err := s.commands.InsertOne(ctx, cmd); err != nil {
+		return bulkCommandResult{DeviceID: deviceID, Status: "error", Error: "failed to create command"}
+	}
+
+	kafkaEvent := &KafkaEvent{
+		ID:        cmd.ID,
+		Type:      "device_command",
+		DeviceID:  deviceID,
+		UserID:    userID,
+		Command:   command,
+		Payload:   payload,
+		Device:    &device,
+		Timestamp: time.Now(),
+	}
+
+	onDispatched := func() { s.updateCommandStatus(ctx, cmd.ID, CommandStatusDispatched, nil) }
+
+	s.deviceState.Set(deviceID, devicestate.CommandInProgress)
+	result, err := s.commandBroker.Send(ctx, kafkaEvent, s.config.CommandTimeout, onDispatched)
+	s.deviceState.Clear(deviceID)
+
+	switch {
+	case errors.Is(err, errQueueFull):
+		s.updateCommandStatus(ctx, cmd.ID, CommandStatusFailed, nil)
+		return bulkCommandResult{DeviceID: deviceID, CorrelationID: cmd.ID, Status: "error", Error: "command queue full"}
+	case errors.Is(err, errCommandTimeout):
+		s.updateCommandStatus(ctx, cmd.ID, CommandStatusTimedOut, nil)
+		return bulkCommandResult{DeviceID: deviceID, CorrelationID: cmd.ID, Status: CommandStatusTimedOut}
+	case err != nil:
+		s.updateCommandStatus(ctx, cmd.ID, CommandStatusFailed, nil)
+		return bulkCommandResult{DeviceID: deviceID, CorrelationID: cmd.ID, Status: "error", Error: err.Error()}
+	}
+
+	s.updateCommandStatus(ctx, cmd.ID, CommandStatusAcknowledged, result.Response)
+
+	if result.Status != "acked" && result.Status != CommandStatusCancelled {
+		s.updateCommandStatus(ctx, cmd.ID, CommandStatusFailed, result.Response)
+		return bulkCommandResult{DeviceID: deviceID, CorrelationID: cmd.ID, Status: CommandStatusFailed, Error: result.Error}
+	}
+	if result.Status == CommandStatusCancelled {
+		return bulkCommandResult{DeviceID: deviceID, CorrelationID: cmd.ID, Status: CommandStatusCancelled}
+	}
+
+	s.updateCommandStatus(ctx, cmd.ID, CommandStatusCompleted, result.Response)
+	return bulkCommandResult{DeviceID: deviceID, CorrelationID: cmd.ID, Status: CommandStatusCompleted}
+}
+
+// bulkDeleteDevices deletes every device matching a tag/type/status filter
+// scoped to the caller's own devices.
+func (s *Service) bulkDeleteDevices(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Filter bulkDeleteFilter `json:"filter"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	filter := bson.M{"user_id": userID}
+	if req.Filter.Type != "" {
+		filter["type"] = req.Filter.Type
+	}
+	if req.Filter.Status != "" {
+		filter["status"] = req.Filter.Status
+	}
+	if req.Filter.Tag != "" {
+		filter["metadata.tag"] = req.Filter.Tag
+	}
+	if len(filter) == 1 {
+		s.errorResponse(w, http.StatusBadRequest, "At least one of filter.type, filter.status, or filter.tag is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(withRequestLogger(r.Context(), r, userID, ""), 30*time.Second)
+	defer cancel()
+
+	result, err := s.devices.DeleteMany(ctx, filter)
+	if err != nil {
+		log.Printf("Error bulk deleting devices: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to delete devices")
+		return
+	}
+
+	if result.DeletedCount > 0 {
+		s.invalidateUserDeviceCache(ctx, userID)
+		deviceOperations.WithLabelValues("bulk_delete").Add(float64(result.DeletedCount))
+		s.publishActivity(ctx, "mongodb", "\xf0\x9f\x97\x91\xef\xb8\x8f", "Bulk Devices Removed",
+			fmt.Sprintf("%d devices deleted in bulk", result.DeletedCount),
+			userID, "", "warning")
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{"deleted": result.DeletedCount})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// maxDeviceLockWaiters bounds how many requests can be queued waiting for
+// a single device's lock. Beyond that, new requests are rejected instead
+// of piling up goroutines behind a slow or wedged adapter.
+const maxDeviceLockWaiters = 20
+
+// errDeviceLockQueueFull is returned by DeviceLockManager.Acquire when a
+// device already has maxDeviceLockWaiters requests waiting on it.
+var errDeviceLockQueueFull = errors.New("device request queue is full")
+
+// deviceLock is a per-device mutex with a waiter count and a reference
+// count: waiters bounds the queue, refs tells DeviceLockManager when it's
+// safe to forget the lock because nothing holds or is waiting on it.
+type deviceLock struct {
+	mu      sync.Mutex
+	waiters int
+	refs    int
+}
+
+// DeviceLockManager serializes all Mongo/Redis/Kafka mutation for a given
+// device across concurrent requests - sendCommand, updateHeartbeat, and
+// any future async device-response handler must hold a device's lock for
+// the duration of their read-modify-write, so two requests for the same
+// device can't race each other into an inconsistent config or produce
+// out-of-order Kafka events. Requests against different devices never
+// block each other; this mirrors the per-device ordering guarantee
+// rw-core's device agents provide.
+type DeviceLockManager struct {
+	mu    sync.Mutex
+	locks map[string]*deviceLock
+}
+
+// NewDeviceLockManager creates an empty lock manager; locks are created
+// lazily per device and garbage collected once nothing references them.
+func NewDeviceLockManager() *DeviceLockManager {
+	return &DeviceLockManager{locks: make(map[string]*deviceLock)}
+}
+
+// Acquire blocks until deviceID's lock is free and returns a function the
+// caller must call exactly once to release it. If the device already has
+// maxDeviceLockWaiters requests queued, it returns errDeviceLockQueueFull
+// immediately instead of queueing another one.
+func (m *DeviceLockManager) Acquire(deviceID string) (release func(), err error) {
+	m.mu.Lock()
+	lock, ok := m.locks[deviceID]
+	if !ok {
+		lock = &deviceLock{}
+		m.locks[deviceID] = lock
+	}
+	if lock.waiters >= maxDeviceLockWaiters {
+		m.mu.Unlock()
+		return nil, errDeviceLockQueueFull
+	}
+	lock.waiters++
+	lock.refs++
+	m.mu.Unlock()
+
+	lock.mu.Lock()
+
+	m.mu.Lock()
+	lock.waiters--
+	m.mu.Unlock()
+
+	released := false
+	return func() {
+		if released {
+			return
+		}
+		released = true
+
+		lock.mu.Unlock()
+
+		m.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(m.locks, deviceID)
+		}
+		m.mu.Unlock()
+	}, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeviceLockManagerSerializesSameDevice(t *testing.T) {
+	m := NewDeviceLockManager()
+
+	release1, err := m.Acquire("device-1")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		release2, err := m.Acquire("device-1")
+		if err != nil {
+			t.Errorf("second Acquire: %v", err)
+			return
+		}
+		close(acquired)
+		release2()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second Acquire returned before the first lock was released")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release1()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second Acquire never completed after the first lock was released")
+	}
+}
+
+func TestDeviceLockManagerIndependentDevices(t *testing.T) {
+	m := NewDeviceLockManager()
+
+	releaseA, err := m.Acquire("device-a")
+	if err != nil {
+		t.Fatalf("Acquire(device-a): %v", err)
+	}
+	defer releaseA()
+
+	done := make(chan struct{})
+	go func() {
+		releaseB, err := m.Acquire("device-b")
+		if err != nil {
+			t.Errorf("Acquire(device-b): %v", err)
+			return
+		}
+		releaseB()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Acquire for an unrelated device blocked behind device-a's lock")
+	}
+}
+
+func TestDeviceLockManagerReleaseIsIdempotent(t *testing.T) {
+	m := NewDeviceLockManager()
+
+	release, err := m.Acquire("device-1")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	release()
+	release() // must not panic or double-unlock
+
+	// The lock should be usable again afterward.
+	release2, err := m.Acquire("device-1")
+	if err != nil {
+		t.Fatalf("Acquire after release: %v", err)
+	}
+	release2()
+}
+
+func TestDeviceLockManagerQueueFull(t *testing.T) {
+	m := NewDeviceLockManager()
+
+	release, err := m.Acquire("device-1")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < maxDeviceLockWaiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := m.Acquire("device-1")
+			if err != nil {
+				return
+			}
+			r()
+		}()
+	}
+
+	// Give the waiters a moment to queue up behind the held lock.
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := m.Acquire("device-1"); err != errDeviceLockQueueFull {
+		t.Fatalf("Acquire with a full waiter queue: got err %v, want errDeviceLockQueueFull", err)
+	}
+
+	// Release the held lock so the queued waiters can drain.
+	release()
+	wg.Wait()
+}
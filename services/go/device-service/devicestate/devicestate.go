@@ -0,0 +1,183 @@
+// Package devicestate models a device's persisted status as an explicit
+// state machine, and tracks short-lived transient states (an operation
+// in flight against a device) separately from that persisted status.
+// The split follows the pattern voltha's rw_core device agent uses to
+// keep long-lived state and in-flight bookkeeping from fighting each other.
+package devicestate
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// State is a device's persisted lifecycle state.
+type State string
+
+const (
+	Inactive     State = "inactive"
+	Provisioning State = "provisioning"
+	Active       State = "active"
+	Degraded     State = "degraded"
+	Deleting     State = "deleting"
+)
+
+// Transient marks an in-flight operation against a device that hasn't
+// resolved to a persisted state change yet.
+type Transient string
+
+const (
+	// None means no operation is currently in flight.
+	None              Transient = ""
+	CommandInProgress Transient = "COMMAND_IN_PROGRESS"
+	DeleteRequested   Transient = "DELETE_REQUESTED"
+	Reprovisioning    Transient = "REPROVISIONING"
+)
+
+var allowedTransitions = map[State][]State{
+	Inactive:     {Provisioning},
+	Provisioning: {Active, Inactive, Degraded},
+	Active:       {Degraded, Deleting, Provisioning},
+	Degraded:     {Active, Provisioning, Deleting},
+	Deleting:     {},
+}
+
+// CanTransition reports whether a device may move from one persisted
+// state to another.
+func CanTransition(from, to State) bool {
+	for _, s := range allowedTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+type entry struct {
+	mu    sync.RWMutex
+	state Transient
+	setAt time.Time
+}
+
+// Tracker holds the current transient state of every device the service
+// knows about, and periodically clears entries that have been stuck in a
+// transient state for longer than ttl (e.g. a goroutine that crashed
+// before clearing its own state).
+type Tracker struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	ttl     time.Duration
+}
+
+// NewTracker creates a Tracker and starts its background reaper, which
+// clears transient states older than ttl. A non-positive ttl disables
+// reaping.
+func NewTracker(ttl time.Duration) *Tracker {
+	t := &Tracker{
+		entries: make(map[string]*entry),
+		ttl:     ttl,
+	}
+	if ttl > 0 {
+		go t.reapLoop()
+	}
+	return t
+}
+
+func (t *Tracker) entryFor(deviceID string) *entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.entries[deviceID]
+	if !ok {
+		e = &entry{}
+		t.entries[deviceID] = e
+	}
+	return e
+}
+
+// Get returns the device's current transient state, or None if it has
+// none (or is unknown to the tracker).
+func (t *Tracker) Get(deviceID string) Transient {
+	t.mu.Lock()
+	e, ok := t.entries[deviceID]
+	t.mu.Unlock()
+	if !ok {
+		return None
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.state
+}
+
+// Set records the device's transient state, overwriting whatever was
+// there before. Passing None clears it.
+func (t *Tracker) Set(deviceID string, state Transient) {
+	e := t.entryFor(deviceID)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.state = state
+	e.setAt = time.Now()
+}
+
+// Clear removes the device's transient state.
+func (t *Tracker) Clear(deviceID string) {
+	t.Set(deviceID, None)
+}
+
+// TryBegin atomically records state for deviceID if it currently has no
+// transient state, and reports whether it did so. Use it to reject an
+// operation that would conflict with one already in flight.
+func (t *Tracker) TryBegin(deviceID string, state Transient) bool {
+	e := t.entryFor(deviceID)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.state != None {
+		return false
+	}
+	e.state = state
+	e.setAt = time.Now()
+	return true
+}
+
+// ReapStale clears every transient state last set more than ttl ago and
+// returns how many it cleared.
+func (t *Tracker) ReapStale() int {
+	cutoff := time.Now().Add(-t.ttl)
+
+	t.mu.Lock()
+	ids := make([]string, 0, len(t.entries))
+	for id := range t.entries {
+		ids = append(ids, id)
+	}
+	t.mu.Unlock()
+
+	cleared := 0
+	for _, id := range ids {
+		e := t.entryFor(id)
+		e.mu.Lock()
+		if e.state != None && e.setAt.Before(cutoff) {
+			e.state = None
+			cleared++
+		}
+		e.mu.Unlock()
+	}
+	return cleared
+}
+
+func (t *Tracker) reapLoop() {
+	interval := t.ttl / 2
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if n := t.ReapStale(); n > 0 {
+			log.Printf("devicestate: cleared %d stale transient state(s)", n)
+		}
+	}
+}
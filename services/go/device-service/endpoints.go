@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// partitionsPerTopic is the assumed partition count of each topic in the
+// pool. The service has no admin client to ask Kafka for the real number,
+// so this mirrors the fixed topic-count/partition-count the pool is
+// provisioned with; it only needs to be consistent, not authoritative.
+const partitionsPerTopic = 4
+
+var deviceTopicAssignments = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "device_topic_assignments",
+		Help: "Number of devices currently assigned to each Kafka topic",
+	},
+	[]string{"topic"},
+)
+
+func init() {
+	prometheus.MustRegister(deviceTopicAssignments)
+}
+
+// EndpointManager maps a device ID to one of a fixed pool of Kafka topics
+// and a partition within it, using consistent hashing over a ring of
+// virtual nodes - the same scheme voltha uses to shard per-device topics
+// (VOL-2835/VOL-3507). Because the mapping is a pure function of the
+// device ID, the same device always lands on the same topic/partition
+// across restarts and across every instance of this service, which lets
+// downstream adapters shard their consumers by topic instead of all
+// competing for a single ordered device-events topic.
+type EndpointManager struct {
+	topicPrefix string
+	poolSize    int
+	replicas    int
+
+	ring     []uint32
+	ringNode map[uint32]string
+
+	mu          sync.Mutex
+	assignments map[string]string // deviceID -> topic, for the rebalance endpoint
+}
+
+// NewEndpointManager builds the consistent-hash ring for a pool of
+// poolSize topics named "<topicPrefix>-0".."<topicPrefix>-(poolSize-1)",
+// each represented by hashReplicas virtual nodes on the ring.
+func NewEndpointManager(topicPrefix string, poolSize, hashReplicas int) *EndpointManager {
+	if poolSize < 1 {
+		poolSize = 1
+	}
+	if hashReplicas < 1 {
+		hashReplicas = 1
+	}
+
+	em := &EndpointManager{
+		topicPrefix: topicPrefix,
+		poolSize:    poolSize,
+		replicas:    hashReplicas,
+		ringNode:    make(map[uint32]string),
+		assignments: make(map[string]string),
+	}
+	em.buildRing()
+	return em
+}
+
+func (em *EndpointManager) buildRing() {
+	ring := make([]uint32, 0, em.poolSize*em.replicas)
+	for i := 0; i < em.poolSize; i++ {
+		topic := fmt.Sprintf("%s-%d", em.topicPrefix, i)
+		for r := 0; r < em.replicas; r++ {
+			h := hashKey(fmt.Sprintf("%s#%d", topic, r))
+			ring = append(ring, h)
+			em.ringNode[h] = topic
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i] < ring[j] })
+	em.ring = ring
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+func (em *EndpointManager) topicForHash(h uint32) string {
+	idx := sort.Search(len(em.ring), func(i int) bool { return em.ring[i] >= h })
+	if idx == len(em.ring) {
+		idx = 0
+	}
+	return em.ringNode[em.ring[idx]]
+}
+
+// TopicForDevice returns the topic and partition a device's events and
+// commands should be published to.
+func (em *EndpointManager) TopicForDevice(deviceID string) (topic string, partition int32) {
+	h := hashKey(deviceID)
+	topic = em.topicForHash(h)
+	partition = int32(hashKey(deviceID+"#partition") % uint32(partitionsPerTopic))
+
+	em.mu.Lock()
+	prev, known := em.assignments[deviceID]
+	em.assignments[deviceID] = topic
+	em.mu.Unlock()
+
+	if !known {
+		deviceTopicAssignments.WithLabelValues(topic).Inc()
+	} else if prev != topic {
+		deviceTopicAssignments.WithLabelValues(prev).Dec()
+		deviceTopicAssignments.WithLabelValues(topic).Inc()
+	}
+
+	return topic, partition
+}
+
+// Assignments returns a snapshot of every device-to-topic mapping this
+// manager has handed out since it started.
+func (em *EndpointManager) Assignments() map[string]string {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	out := make(map[string]string, len(em.assignments))
+	for deviceID, topic := range em.assignments {
+		out[deviceID] = topic
+	}
+	return out
+}
+
+// Topics returns the full pool of topic names this manager routes across.
+func (em *EndpointManager) Topics() []string {
+	topics := make([]string, em.poolSize)
+	for i := 0; i < em.poolSize; i++ {
+		topics[i] = fmt.Sprintf("%s-%d", em.topicPrefix, i)
+	}
+	return topics
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type loggerCtxKey struct{}
+
+// withRequestLogger attaches a structured logger carrying the request's
+// correlation ID (set by api-gateway's X-Request-ID header) and, once
+// known, the acting user and device, so every log line for a request can
+// be correlated across services without threading those fields through
+// every function signature.
+func withRequestLogger(ctx context.Context, r *http.Request, userID, deviceID string) context.Context {
+	logger := slog.Default().With(
+		"request_id", r.Header.Get("X-Request-ID"),
+		"user_id", userID,
+		"device_id", deviceID,
+	)
+	return context.WithValue(ctx, loggerCtxKey{}, logger)
+}
+
+// loggerFrom returns the request-scoped logger carried on ctx, or the
+// default logger if none was attached.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerCtxKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
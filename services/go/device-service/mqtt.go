@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// mqttPublishTimeout bounds how long a command publish waits for the
+// broker to acknowledge the PUBLISH, so a wedged MQTT connection behaves
+// like a Kafka publish error instead of hanging the request.
+const mqttPublishTimeout = 5 * time.Second
+
+var (
+	mqttPublishTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "device_mqtt_publish_total",
+			Help: "Total number of commands published to the MQTT broker, by outcome",
+		},
+		[]string{"outcome"},
+	)
+	mqttReceiveTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "device_mqtt_receive_total",
+			Help: "Total number of messages received from the MQTT broker, by topic kind",
+		},
+		[]string{"topic_kind"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(mqttPublishTotal)
+	prometheus.MustRegister(mqttReceiveTotal)
+}
+
+// MQTTBridge is the southbound bridge to devices that speak MQTT instead of
+// (or in addition to) Kafka. It subscribes to every device's telemetry and
+// state topics to feed the same heartbeat and command-response paths Kafka
+// feeds, and publishes commands to a per-device command topic for devices
+// whose Device.Transport selects "mqtt" or "both".
+//
+// Device connections to the broker itself are authenticated by the broker's
+// own auth plugin calling back to POST /internal/devices/validate-token
+// (which accepts {username, password} as well as {token}) - this bridge's
+// client only needs its own service-level credentials to connect.
+type MQTTBridge struct {
+	service *Service
+	client  mqtt.Client
+}
+
+// NewMQTTBridge connects to config.MQTTBrokerURL and subscribes to the
+// device telemetry/state topics. With no broker configured it degrades the
+// same way this service's other optional backends do: commands for
+// MQTT-transport devices will fail to publish, and no telemetry is
+// consumed, but everything else keeps working.
+func NewMQTTBridge(s *Service) *MQTTBridge {
+	b := &MQTTBridge{service: s}
+
+	if s.config.MQTTBrokerURL == "" {
+		log.Printf("Warning: no MQTT broker configured - MQTT bridge will run without a connection")
+		return b
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(s.config.MQTTBrokerURL).
+		SetClientID("device-service-" + s.config.InstanceID).
+		SetAutoReconnect(true).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(b.onConnectionLost)
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		log.Printf("Warning: failed to connect to MQTT broker: %v - MQTT bridge will run without a connection", token.Error())
+		return b
+	}
+
+	b.client = client
+	return b
+}
+
+func (b *MQTTBridge) onConnect(client mqtt.Client) {
+	log.Println("Connected to MQTT broker")
+	b.service.publishActivity(context.Background(), "mqtt", "\xf0\x9f\x93\xa1", "MQTT Connected",
+		"Device service connected to the MQTT broker", "", "", "info")
+
+	for _, topic := range []string{"homeguard/devices/+/telemetry", "homeguard/devices/+/state"} {
+		if token := client.Subscribe(topic, 1, b.handleMessage); token.Wait() && token.Error() != nil {
+			log.Printf("Warning: failed to subscribe to %s: %v", topic, token.Error())
+		}
+	}
+}
+
+func (b *MQTTBridge) onConnectionLost(client mqtt.Client, err error) {
+	log.Printf("Warning: lost connection to MQTT broker: %v", err)
+	b.service.publishActivity(context.Background(), "mqtt", "\xf0\x9f\x93\xa1", "MQTT Disconnected",
+		fmt.Sprintf("Device service lost its MQTT broker connection: %v", err), "", "", "warning")
+}
+
+// handleMessage routes an incoming telemetry or state message to the
+// matching device. Topics are of the form
+// "homeguard/devices/<deviceID>/<telemetry|state>".
+func (b *MQTTBridge) handleMessage(client mqtt.Client, msg mqtt.Message) {
+	parts := strings.Split(msg.Topic(), "/")
+	if len(parts) != 4 {
+		log.Printf("Warning: ignoring MQTT message on unexpected topic %q", msg.Topic())
+		return
+	}
+	deviceID, kind := parts[2], parts[3]
+	mqttReceiveTotal.WithLabelValues(kind).Inc()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	switch kind {
+	case "telemetry":
+		if err := b.service.recordHeartbeat(ctx, deviceID); err != nil {
+			log.Printf("Error recording heartbeat from MQTT telemetry for device %s: %v", deviceID, err)
+		}
+
+	case "state":
+		var result CommandResult
+		if err := json.Unmarshal(msg.Payload(), &result); err == nil && result.CorrelationID != "" {
+			// This is a response to an in-flight command - feed it
+			// through the same correlation-ID matching Kafka responses
+			// use, rather than a second response path.
+			b.service.commandBroker.handleResponse(msg.Payload())
+			return
+		}
+
+		// No correlation ID: an unsolicited state report, treated like a
+		// heartbeat with a state report attached.
+		if err := b.service.recordHeartbeat(ctx, deviceID); err != nil {
+			log.Printf("Error recording state report from MQTT for device %s: %v", deviceID, err)
+		}
+	}
+}
+
+// PublishCommand publishes event to the device's MQTT command topic. With
+// no broker connection it logs and returns nil, the same degrade-gracefully
+// behavior publishToKafka has without a Kafka producer.
+func (b *MQTTBridge) PublishCommand(event *KafkaEvent) error {
+	if b == nil || b.client == nil {
+		log.Printf("MQTT bridge not connected, skipping publish for event %s", event.ID)
+		return nil
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	topic := fmt.Sprintf("homeguard/devices/%s/cmd", event.DeviceID)
+	token := b.client.Publish(topic, 1, false, data)
+	if !token.WaitTimeout(mqttPublishTimeout) {
+		mqttPublishTotal.WithLabelValues("timed_out").Inc()
+		return fmt.Errorf("timed out publishing command to MQTT topic %s", topic)
+	}
+	if err := token.Error(); err != nil {
+		mqttPublishTotal.WithLabelValues("error").Inc()
+		return fmt.Errorf("failed to publish command to MQTT topic %s: %w", topic, err)
+	}
+
+	mqttPublishTotal.WithLabelValues("success").Inc()
+	return nil
+}
+
+// Close disconnects from the MQTT broker, if connected.
+func (b *MQTTBridge) Close() {
+	if b.client != nil {
+		b.client.Disconnect(250)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// instanceLeaseKeyPrefix namespaces each instance's Redis lease key. The
+// key's value is the instance's advertise address, so a non-owner can look
+// up where to send a device command without a separate registry.
+const instanceLeaseKeyPrefix = "instances:lease:"
+
+// OwnershipManager assigns each device to exactly one live instance of this
+// service, using consistent hashing over the set of instances holding a
+// live lease in Redis - the same per-core-pair device ownership voltha's
+// rw-core uses (VOL-1512), adapted to a Redis lease instead of etcd. Every
+// instance registers itself with a TTL'd lease and refreshes it on a
+// fraction of that TTL; a background loop rebuilds the hash ring from
+// whichever leases are currently live, so a dead instance's devices are
+// picked up by the next instance the ring hashes them to as soon as its
+// lease expires - no explicit reclaim step is needed.
+type OwnershipManager struct {
+	redis         *redis.Client
+	instanceID    string
+	advertiseAddr string
+	leaseTTL      time.Duration
+
+	mu       sync.RWMutex
+	ring     []uint32
+	ringID   map[uint32]string // virtual node hash -> owning instance's ID
+	ringAddr map[uint32]string // virtual node hash -> owning instance's advertise address
+}
+
+// NewOwnershipManager creates a manager for this instance and, if redis is
+// non-nil, starts the lease heartbeat and ring-reconciliation loops. With a
+// nil redis client it degrades like the rest of this service's Redis-backed
+// features: IsOwner always reports true, since an unclustered instance owns
+// every device by definition.
+func NewOwnershipManager(redis *redis.Client, instanceID, advertiseAddr string, leaseTTL time.Duration) *OwnershipManager {
+	om := &OwnershipManager{
+		redis:         redis,
+		instanceID:    instanceID,
+		advertiseAddr: advertiseAddr,
+		leaseTTL:      leaseTTL,
+		ringID:        make(map[uint32]string),
+		ringAddr:      make(map[uint32]string),
+	}
+
+	if redis == nil {
+		return om
+	}
+
+	if err := om.renewLease(context.Background()); err != nil {
+		log.Printf("Warning: failed to register instance lease: %v", err)
+	}
+	om.reconcile(context.Background())
+
+	go om.heartbeatLoop()
+	go om.reconcileLoop()
+
+	return om
+}
+
+func (om *OwnershipManager) leaseKey() string {
+	return instanceLeaseKeyPrefix + om.instanceID
+}
+
+func (om *OwnershipManager) renewLease(ctx context.Context) error {
+	return om.redis.Set(ctx, om.leaseKey(), om.advertiseAddr, om.leaseTTL).Err()
+}
+
+func (om *OwnershipManager) heartbeatLoop() {
+	interval := om.leaseTTL / 3
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), om.leaseTTL)
+		if err := om.renewLease(ctx); err != nil {
+			log.Printf("Warning: failed to renew instance lease: %v", err)
+		}
+		cancel()
+	}
+}
+
+func (om *OwnershipManager) reconcileLoop() {
+	interval := om.leaseTTL / 3
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), om.leaseTTL)
+		om.reconcile(ctx)
+		cancel()
+	}
+}
+
+// reconcile rebuilds the hash ring from whichever instance leases are
+// currently live in Redis. Instances whose lease expired simply stop
+// appearing in the scan, so their devices fall to whichever live instance
+// the ring now hashes them to - no explicit orphan reclaim is needed.
+func (om *OwnershipManager) reconcile(ctx context.Context) {
+	members, err := om.liveInstances(ctx)
+	if err != nil {
+		log.Printf("Warning: failed to list live instance leases: %v", err)
+		return
+	}
+
+	// Always include ourselves, even if our own lease hasn't been
+	// observed by this scan yet (e.g. the very first reconcile, racing
+	// the initial renewLease call).
+	if _, ok := members[om.instanceID]; !ok {
+		members[om.instanceID] = om.advertiseAddr
+	}
+
+	ring, ringID, ringAddr := buildHashRing(members)
+
+	om.mu.Lock()
+	om.ring = ring
+	om.ringID = ringID
+	om.ringAddr = ringAddr
+	om.mu.Unlock()
+}
+
+// ownershipRingReplicas is the number of virtual nodes each instance gets on
+// the hash ring, which smooths out how evenly devices spread across
+// instances of very different counts.
+const ownershipRingReplicas = 100
+
+// buildHashRing lays out a consistent-hash ring from a set of instance IDs
+// mapped to their advertise address, returning the sorted virtual node
+// hashes alongside lookup maps back to each node's owning instance ID and
+// address.
+func buildHashRing(members map[string]string) (ring []uint32, ringID, ringAddr map[uint32]string) {
+	ring = make([]uint32, 0, len(members)*ownershipRingReplicas)
+	ringID = make(map[uint32]string, len(members)*ownershipRingReplicas)
+	ringAddr = make(map[uint32]string, len(members)*ownershipRingReplicas)
+	for id, addr := range members {
+		for r := 0; r < ownershipRingReplicas; r++ {
+			h := ownershipHashKey(fmt.Sprintf("%s#%d", id, r))
+			ring = append(ring, h)
+			ringID[h] = id
+			ringAddr[h] = addr
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i] < ring[j] })
+	return ring, ringID, ringAddr
+}
+
+// liveInstances scans Redis for every instance lease key and returns the
+// live instance IDs mapped to their advertise address.
+func (om *OwnershipManager) liveInstances(ctx context.Context) (map[string]string, error) {
+	members := make(map[string]string)
+
+	var cursor uint64
+	for {
+		keys, next, err := om.redis.Scan(ctx, cursor, instanceLeaseKeyPrefix+"*", 100).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			addr, err := om.redis.Get(ctx, key).Result()
+			if err != nil {
+				// Lease expired between the scan and the get - treat it
+				// as not live rather than failing the whole reconcile.
+				continue
+			}
+			members[key[len(instanceLeaseKeyPrefix):]] = addr
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return members, nil
+}
+
+func ownershipHashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// ringIndex returns the ring position whichever instance deviceID currently
+// hashes to, or -1 if the ring is empty.
+func (om *OwnershipManager) ringIndex(deviceID string) int {
+	if len(om.ring) == 0 {
+		return -1
+	}
+
+	h := ownershipHashKey(deviceID)
+	idx := sort.Search(len(om.ring), func(i int) bool { return om.ring[i] >= h })
+	if idx == len(om.ring) {
+		idx = 0
+	}
+	return idx
+}
+
+// ownerID returns the instance ID of whichever instance the ring currently
+// assigns deviceID to.
+func (om *OwnershipManager) ownerID(deviceID string) string {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+
+	idx := om.ringIndex(deviceID)
+	if idx < 0 {
+		return om.instanceID
+	}
+	return om.ringID[om.ring[idx]]
+}
+
+// ownerAddr returns the advertise address of whichever instance the ring
+// currently assigns deviceID to.
+func (om *OwnershipManager) ownerAddr(deviceID string) string {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+
+	idx := om.ringIndex(deviceID)
+	if idx < 0 {
+		return om.advertiseAddr
+	}
+	return om.ringAddr[om.ring[idx]]
+}
+
+// IsOwner reports whether this instance is the current owner of deviceID.
+// With no redis client configured, every device is owned locally. This
+// compares instance IDs rather than advertise addresses - replicas that
+// were deployed without a distinct ADVERTISE_ADDR per instance would
+// otherwise all resolve to the same default address and every instance
+// would wrongly believe itself the owner of every device.
+func (om *OwnershipManager) IsOwner(deviceID string) bool {
+	if om.redis == nil {
+		return true
+	}
+	return om.ownerID(deviceID) == om.instanceID
+}
+
+// OwnerAddr returns the advertise address of deviceID's current owner, for
+// redirecting a request that landed on the wrong instance.
+func (om *OwnershipManager) OwnerAddr(deviceID string) string {
+	return om.ownerAddr(deviceID)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestOwnershipManagerNoRedisAlwaysOwner(t *testing.T) {
+	om := NewOwnershipManager(nil, "instance-1", "http://localhost:8080", 0)
+
+	for _, deviceID := range []string{"device-1", "device-2", "device-3"} {
+		if !om.IsOwner(deviceID) {
+			t.Errorf("IsOwner(%q) = false, want true with no redis client configured", deviceID)
+		}
+	}
+}
+
+func TestOwnershipManagerComparesByInstanceID(t *testing.T) {
+	// Two instances sharing the same advertise address, as happens when
+	// every replica is left on ADVERTISE_ADDR's localhost default. IsOwner
+	// must still only report true for whichever instance the ring actually
+	// assigned the device to.
+	members := map[string]string{
+		"instance-1": "http://localhost:8080",
+		"instance-2": "http://localhost:8080",
+	}
+	ring, ringID, ringAddr := buildHashRing(members)
+
+	// IsOwner only checks whether redis is non-nil to decide it's running
+	// clustered; it never issues a command on it in this path, so an
+	// unconnected client is enough to exercise the ID-comparison logic.
+	clusteredRedis := redis.NewClient(&redis.Options{Addr: "unused:0"})
+	om1 := &OwnershipManager{redis: clusteredRedis, instanceID: "instance-1", advertiseAddr: "http://localhost:8080", ring: ring, ringID: ringID, ringAddr: ringAddr}
+	om2 := &OwnershipManager{redis: clusteredRedis, instanceID: "instance-2", advertiseAddr: "http://localhost:8080", ring: ring, ringID: ringID, ringAddr: ringAddr}
+
+	found1, found2 := false, false
+	for i := 0; i < 200; i++ {
+		deviceID := deviceIDForTest(i)
+		owner := om1.ownerID(deviceID)
+		if owner != "instance-1" && owner != "instance-2" {
+			t.Fatalf("ownerID(%q) = %q, want instance-1 or instance-2", deviceID, owner)
+		}
+
+		// Exactly one of the two instances should claim ownership, never
+		// both and never neither.
+		is1 := om1.IsOwner(deviceID)
+		is2 := om2.IsOwner(deviceID)
+		if is1 == is2 {
+			t.Fatalf("IsOwner(%q): instance-1=%v instance-2=%v, want exactly one owner", deviceID, is1, is2)
+		}
+		if is1 {
+			found1 = true
+		} else {
+			found2 = true
+		}
+	}
+	if !found1 || !found2 {
+		t.Fatalf("expected devices to spread across both instances, got instance-1=%v instance-2=%v", found1, found2)
+	}
+}
+
+func TestOwnershipManagerStableMapping(t *testing.T) {
+	ring, ringID, ringAddr := buildHashRing(map[string]string{
+		"instance-1": "http://10.0.0.1:8080",
+		"instance-2": "http://10.0.0.2:8080",
+		"instance-3": "http://10.0.0.3:8080",
+	})
+	om := &OwnershipManager{ring: ring, ringID: ringID, ringAddr: ringAddr}
+
+	for i := 0; i < 50; i++ {
+		deviceID := deviceIDForTest(i)
+		first := om.ownerID(deviceID)
+		for j := 0; j < 5; j++ {
+			if got := om.ownerID(deviceID); got != first {
+				t.Fatalf("ownerID(%q) is not stable across repeated lookups: got %q, want %q", deviceID, got, first)
+			}
+		}
+
+		addr := om.ownerAddr(deviceID)
+		wantAddr := map[string]string{
+			"instance-1": "http://10.0.0.1:8080",
+			"instance-2": "http://10.0.0.2:8080",
+			"instance-3": "http://10.0.0.3:8080",
+		}[first]
+		if addr != wantAddr {
+			t.Errorf("ownerAddr(%q) = %q, want %q (for owner %q)", deviceID, addr, wantAddr, first)
+		}
+	}
+}
+
+func TestOwnershipManagerEmptyRingFallsBackToSelf(t *testing.T) {
+	om := &OwnershipManager{instanceID: "instance-1", advertiseAddr: "http://localhost:8080"}
+
+	if got := om.ownerID("device-1"); got != "instance-1" {
+		t.Errorf("ownerID with an empty ring = %q, want own instanceID", got)
+	}
+	if got := om.ownerAddr("device-1"); got != "http://localhost:8080" {
+		t.Errorf("ownerAddr with an empty ring = %q, want own advertiseAddr", got)
+	}
+}
+
+func TestOwnershipHashKeyDeterministic(t *testing.T) {
+	a := ownershipHashKey("device-1")
+	b := ownershipHashKey("device-1")
+	if a != b {
+		t.Errorf("ownershipHashKey(%q) is not deterministic: got %d and %d", "device-1", a, b)
+	}
+	if ownershipHashKey("device-1") == ownershipHashKey("device-2") {
+		t.Error("ownershipHashKey produced the same hash for two different keys")
+	}
+}
+
+func deviceIDForTest(i int) string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, 8)
+	for j := range b {
+		b[j] = alphabet[(i*7+j*13)%len(alphabet)]
+	}
+	return "device-" + string(b)
+}
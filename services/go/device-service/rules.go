@@ -0,0 +1,820 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Expression AST -------------------------------------------------------
+//
+// Rules are written against device properties, e.g.
+//   light.living_room.state == "on" AND thermostat.hall.target_temperature > 72
+// and compiled into this small tree of Expression nodes, following the
+// HAS/NOT/property/binary pattern canopy-style device query languages use.
+
+// Expression is one node of a compiled rule. Evaluate resolves any
+// PropertyExpression leaves via lookup and returns the node's value.
+type Expression interface {
+	Evaluate(ctx context.Context, lookup DeviceLookup) (interface{}, error)
+	// deviceIDs appends every device ID this expression (and its
+	// children) references, so the rule engine can index which rules
+	// need re-evaluating when a given device changes.
+	deviceIDs(out map[string]struct{})
+}
+
+// DeviceLookup resolves a device's properties (its raw Config merged with
+// deviceStateView's derived fields) by ID, for PropertyExpression to read.
+type DeviceLookup func(ctx context.Context, deviceID string) (map[string]interface{}, error)
+
+// LiteralExpression is a constant string, number, or bool.
+type LiteralExpression struct {
+	Value interface{}
+}
+
+func (e *LiteralExpression) Evaluate(ctx context.Context, lookup DeviceLookup) (interface{}, error) {
+	return e.Value, nil
+}
+func (e *LiteralExpression) deviceIDs(out map[string]struct{}) {}
+
+// PropertyExpression reads a single property off a device, e.g.
+// "light.living_room.state" is DeviceID: "light.living_room", Property: "state".
+type PropertyExpression struct {
+	DeviceID string
+	Property string
+}
+
+func (e *PropertyExpression) Evaluate(ctx context.Context, lookup DeviceLookup) (interface{}, error) {
+	props, err := lookup(ctx, e.DeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s.%s: %w", e.DeviceID, e.Property, err)
+	}
+	return props[e.Property], nil
+}
+func (e *PropertyExpression) deviceIDs(out map[string]struct{}) {
+	out[e.DeviceID] = struct{}{}
+}
+
+// BinaryOpExpression is a two-operand comparison or boolean combinator:
+// AND, OR, ==, !=, <>, <, <=, >, >=.
+type BinaryOpExpression struct {
+	Op    string
+	Left  Expression
+	Right Expression
+}
+
+func (e *BinaryOpExpression) deviceIDs(out map[string]struct{}) {
+	e.Left.deviceIDs(out)
+	e.Right.deviceIDs(out)
+}
+
+func (e *BinaryOpExpression) Evaluate(ctx context.Context, lookup DeviceLookup) (interface{}, error) {
+	if e.Op == "AND" || e.Op == "OR" {
+		left, err := e.Left.Evaluate(ctx, lookup)
+		if err != nil {
+			return nil, err
+		}
+		lb := truthy(left)
+		if e.Op == "AND" && !lb {
+			return false, nil
+		}
+		if e.Op == "OR" && lb {
+			return true, nil
+		}
+		right, err := e.Right.Evaluate(ctx, lookup)
+		if err != nil {
+			return nil, err
+		}
+		return truthy(right), nil
+	}
+
+	left, err := e.Left.Evaluate(ctx, lookup)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.Right.Evaluate(ctx, lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.Op {
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=", "<>":
+		return !valuesEqual(left, right), nil
+	case "<", "<=", ">", ">=":
+		lf, lok := asFloat(left)
+		rf, rok := asFloat(right)
+		if !lok || !rok {
+			return false, nil
+		}
+		switch e.Op {
+		case "<":
+			return lf < rf, nil
+		case "<=":
+			return lf <= rf, nil
+		case ">":
+			return lf > rf, nil
+		default:
+			return lf >= rf, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown operator %q", e.Op)
+	}
+}
+
+// UnaryOpExpression is a single-operand NOT (boolean negation) or HAS
+// (whether the device's property is present at all).
+type UnaryOpExpression struct {
+	Op      string
+	Operand Expression
+}
+
+func (e *UnaryOpExpression) deviceIDs(out map[string]struct{}) {
+	e.Operand.deviceIDs(out)
+}
+
+func (e *UnaryOpExpression) Evaluate(ctx context.Context, lookup DeviceLookup) (interface{}, error) {
+	switch e.Op {
+	case "NOT":
+		v, err := e.Operand.Evaluate(ctx, lookup)
+		if err != nil {
+			return nil, err
+		}
+		return !truthy(v), nil
+	case "HAS":
+		prop, ok := e.Operand.(*PropertyExpression)
+		if !ok {
+			return nil, fmt.Errorf("HAS requires a device property operand")
+		}
+		props, err := lookup(ctx, prop.DeviceID)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s.%s: %w", prop.DeviceID, prop.Property, err)
+		}
+		_, present := props[prop.Property]
+		return present, nil
+	default:
+		return nil, fmt.Errorf("unknown unary operator %q", e.Op)
+	}
+}
+
+func truthy(v interface{}) bool {
+	b, ok := v.(bool)
+	return ok && b
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if af, aok := asFloat(a); aok {
+		if bf, bok := asFloat(b); bok {
+			return af == bf
+		}
+	}
+	return fmt.Sprintf("%v", a) == fmt.Sprintf("%v", b)
+}
+
+func asFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// --- Parser ---------------------------------------------------------------
+//
+// A small recursive-descent parser over a hand-rolled tokenizer. Precedence,
+// loosest to tightest: OR, AND, comparison, NOT/HAS, literal/property/paren.
+
+type ruleToken struct {
+	kind string // "ident", "string", "number", "op", "lparen", "rparen", "eof"
+	text string
+}
+
+func tokenizeRule(expr string) ([]ruleToken, error) {
+	var tokens []ruleToken
+	i := 0
+	for i < len(expr) {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, ruleToken{kind: "lparen"})
+			i++
+		case c == ')':
+			tokens = append(tokens, ruleToken{kind: "rparen"})
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(expr) && expr[j] != '"' {
+				j++
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("unterminated string literal at position %d", i)
+			}
+			tokens = append(tokens, ruleToken{kind: "string", text: expr[i+1 : j]})
+			i = j + 1
+		case strings.ContainsRune("=!<>", rune(c)):
+			j := i + 1
+			for j < len(expr) && strings.ContainsRune("=!<>", rune(expr[j])) {
+				j++
+			}
+			tokens = append(tokens, ruleToken{kind: "op", text: expr[i:j]})
+			i = j
+		case isIdentByte(c):
+			j := i
+			for j < len(expr) && isIdentByte(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, ruleToken{kind: "ident", text: expr[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+		}
+	}
+	tokens = append(tokens, ruleToken{kind: "eof"})
+	return tokens, nil
+}
+
+func isIdentByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-'
+}
+
+type ruleParser struct {
+	tokens []ruleToken
+	pos    int
+}
+
+func parseRuleExpression(expr string) (Expression, error) {
+	tokens, err := tokenizeRule(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &ruleParser{tokens: tokens}
+	ast, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != "eof" {
+		return nil, fmt.Errorf("unexpected trailing token %q", p.peek().text)
+	}
+	return ast, nil
+}
+
+func (p *ruleParser) peek() ruleToken { return p.tokens[p.pos] }
+
+func (p *ruleParser) next() ruleToken {
+	t := p.tokens[p.pos]
+	if p.pos < len(p.tokens)-1 {
+		p.pos++
+	}
+	return t
+}
+
+func (p *ruleParser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == "ident" && strings.EqualFold(p.peek().text, "OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryOpExpression{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *ruleParser) parseAnd() (Expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == "ident" && strings.EqualFold(p.peek().text, "AND") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryOpExpression{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *ruleParser) parseUnary() (Expression, error) {
+	if p.peek().kind == "ident" && strings.EqualFold(p.peek().text, "NOT") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryOpExpression{Op: "NOT", Operand: operand}, nil
+	}
+	if p.peek().kind == "ident" && strings.EqualFold(p.peek().text, "HAS") {
+		p.next()
+		operand, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryOpExpression{Op: "HAS", Operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *ruleParser) parseComparison() (Expression, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind == "op" {
+		op := strings.ToUpper(p.next().text)
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryOpExpression{Op: op, Left: left, Right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *ruleParser) parseOperand() (Expression, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case "lparen":
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != "rparen" {
+			return nil, fmt.Errorf("expected ')'")
+		}
+		p.next()
+		return inner, nil
+	case "string":
+		p.next()
+		return &LiteralExpression{Value: tok.text}, nil
+	case "ident":
+		p.next()
+		if n, err := strconv.ParseFloat(tok.text, 64); err == nil {
+			return &LiteralExpression{Value: n}, nil
+		}
+		if strings.EqualFold(tok.text, "true") {
+			return &LiteralExpression{Value: true}, nil
+		}
+		if strings.EqualFold(tok.text, "false") {
+			return &LiteralExpression{Value: false}, nil
+		}
+		idx := strings.LastIndex(tok.text, ".")
+		if idx <= 0 || idx == len(tok.text)-1 {
+			return nil, fmt.Errorf("expected a device_id.property reference, got %q", tok.text)
+		}
+		return &PropertyExpression{DeviceID: tok.text[:idx], Property: tok.text[idx+1:]}, nil
+	default:
+		return nil, fmt.Errorf("unexpected token %q", tok.text)
+	}
+}
+
+// --- Rule model -------------------------------------------------------------
+
+// RuleAction is a command this rule triggers on a device when its
+// expression evaluates true.
+type RuleAction struct {
+	DeviceID string                 `json:"device_id" bson:"device_id"`
+	Command  string                 `json:"command" bson:"command"`
+	Payload  map[string]interface{} `json:"payload,omitempty" bson:"payload,omitempty"`
+}
+
+// Rule is a user-defined automation: when Expression evaluates true,
+// every Actions entry is dispatched as a command.
+type Rule struct {
+	ID         string       `json:"id" bson:"_id"`
+	UserID     string       `json:"user_id" bson:"user_id"`
+	Name       string       `json:"name" bson:"name"`
+	Expression string       `json:"expression" bson:"expression"`
+	Actions    []RuleAction `json:"actions" bson:"actions"`
+	Enabled    bool         `json:"enabled" bson:"enabled"`
+	CreatedAt  time.Time    `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at" bson:"updated_at"`
+}
+
+// --- Rule engine ------------------------------------------------------------
+
+type compiledRule struct {
+	rule Rule
+	ast  Expression
+}
+
+// RuleEngine holds a compiled, in-memory view of every enabled rule,
+// indexed by the devices it references, so a state change only
+// re-evaluates the rules it could possibly affect instead of all of them.
+// It's rebuilt from Mongo on every rule CRUD write and on a periodic
+// interval, the same reconcile-from-source-of-truth pattern
+// OwnershipManager uses for its membership ring.
+type RuleEngine struct {
+	service *Service
+
+	mu       sync.RWMutex
+	byDevice map[string][]*compiledRule
+}
+
+// NewRuleEngine creates an engine for service and, if it has a rules
+// collection, loads the current rule set and starts the periodic reload
+// loop. With no Mongo connection it degrades like the rest of this
+// service's backends: OnDeviceChanged becomes a no-op.
+func NewRuleEngine(s *Service) *RuleEngine {
+	re := &RuleEngine{service: s, byDevice: make(map[string][]*compiledRule)}
+	if s.rules == nil {
+		return re
+	}
+
+	re.Reload(context.Background())
+	go re.reloadLoop()
+	return re
+}
+
+func (re *RuleEngine) reloadLoop() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		re.Reload(context.Background())
+	}
+}
+
+// Reload recompiles every enabled rule from Mongo and rebuilds the
+// device->rules index. Rules that fail to compile are skipped and logged,
+// rather than failing the whole reload.
+func (re *RuleEngine) Reload(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := re.service.rules.Find(ctx, bson.M{"enabled": true})
+	if err != nil {
+		log.Printf("Warning: failed to load rules: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var rules []Rule
+	if err := cursor.All(ctx, &rules); err != nil {
+		log.Printf("Warning: failed to decode rules: %v", err)
+		return
+	}
+
+	byDevice := make(map[string][]*compiledRule)
+	for _, rule := range rules {
+		ast, err := parseRuleExpression(rule.Expression)
+		if err != nil {
+			log.Printf("Warning: skipping rule %s (%s): failed to compile expression: %v", rule.ID, rule.Name, err)
+			continue
+		}
+		cr := &compiledRule{rule: rule, ast: ast}
+
+		ids := make(map[string]struct{})
+		ast.deviceIDs(ids)
+		for _, action := range rule.Actions {
+			ids[action.DeviceID] = struct{}{}
+		}
+		for id := range ids {
+			byDevice[id] = append(byDevice[id], cr)
+		}
+	}
+
+	re.mu.Lock()
+	re.byDevice = byDevice
+	re.mu.Unlock()
+}
+
+// lookup resolves a device's properties from Mongo: its raw Config merged
+// with deviceStateView's derived fields, plus a few base fields rules
+// commonly reference.
+func (re *RuleEngine) lookup(ctx context.Context, deviceID string) (map[string]interface{}, error) {
+	var device Device
+	if err := re.service.devices.FindOne(ctx, bson.M{"_id": deviceID}).Decode(&device); err != nil {
+		return nil, err
+	}
+
+	props := map[string]interface{}{
+		"online": time.Since(device.LastSeen) < 2*time.Minute,
+		"status": device.Status,
+		"type":   device.Type,
+	}
+	for k, v := range device.Config {
+		props[k] = v
+	}
+	for k, v := range deviceStateView(device) {
+		props[k] = v
+	}
+	return props, nil
+}
+
+// OnDeviceChanged re-evaluates, in the background, every rule that
+// references deviceID, and dispatches any rule whose expression now
+// evaluates true. It's a no-op if the engine has no rules loaded
+// (including when rules are disabled entirely by a missing Mongo
+// connection).
+func (re *RuleEngine) OnDeviceChanged(deviceID string) {
+	re.mu.RLock()
+	affected := re.byDevice[deviceID]
+	re.mu.RUnlock()
+
+	if len(affected) == 0 {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		for _, cr := range affected {
+			result, err := cr.ast.Evaluate(ctx, re.lookup)
+			if err != nil {
+				log.Printf("Warning: rule %s (%s) failed to evaluate: %v", cr.rule.ID, cr.rule.Name, err)
+				continue
+			}
+			if !truthy(result) {
+				continue
+			}
+
+			for _, action := range cr.rule.Actions {
+				if err := re.service.enqueueRuleAction(ctx, cr.rule.UserID, action.DeviceID, action.Command, action.Payload); err != nil {
+					log.Printf("Warning: rule %s (%s) failed to dispatch %s to %s: %v",
+						cr.rule.ID, cr.rule.Name, action.Command, action.DeviceID, err)
+				}
+			}
+
+			re.service.publishActivity(ctx, "rules", "\xf0\x9f\xa4\x96", "Rule Triggered",
+				fmt.Sprintf("Rule '%s' fired %d action(s)", cr.rule.Name, len(cr.rule.Actions)),
+				cr.rule.UserID, deviceID, "info")
+		}
+	}()
+}
+
+// enqueueRuleAction dispatches a single follow-up command on behalf of a
+// triggered rule, reusing the same per-device command queue and Kafka/MQTT
+// publish path sendCommand and the bulk command endpoint use.
+func (s *Service) enqueueRuleAction(ctx context.Context, userID, deviceID, command string, payload map[string]interface{}) error {
+	result := s.dispatchBulkCommand(ctx, userID, deviceID, command, payload)
+	if result.Error != "" {
+		return fmt.Errorf(result.Error)
+	}
+	return nil
+}
+
+// --- HTTP handlers ----------------------------------------------------------
+
+func (s *Service) createRule(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Name       string       `json:"name"`
+		Expression string       `json:"expression"`
+		Actions    []RuleAction `json:"actions"`
+		Enabled    *bool        `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Name == "" || req.Expression == "" {
+		s.errorResponse(w, http.StatusBadRequest, "name and expression are required")
+		return
+	}
+	if _, err := parseRuleExpression(req.Expression); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid expression: "+err.Error())
+		return
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	ctx, cancel := context.WithTimeout(withRequestLogger(r.Context(), r, userID, ""), 5*time.Second)
+	defer cancel()
+
+	rule := Rule{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		Name:       req.Name,
+		Expression: req.Expression,
+		Actions:    req.Actions,
+		Enabled:    enabled,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if _, err := s.rules.InsertOne(ctx, rule); err != nil {
+		log.Printf("Error creating rule: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to create rule")
+		return
+	}
+
+	s.ruleEngine.Reload(ctx)
+	s.jsonResponse(w, http.StatusCreated, rule)
+}
+
+func (s *Service) listRules(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(withRequestLogger(r.Context(), r, userID, ""), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.rules.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		log.Printf("Error listing rules: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to list rules")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	rules := []Rule{}
+	if err := cursor.All(ctx, &rules); err != nil {
+		log.Printf("Error decoding rules: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to list rules")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{"rules": rules})
+}
+
+func (s *Service) getRule(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	ruleID := mux.Vars(r)["id"]
+	ctx, cancel := context.WithTimeout(withRequestLogger(r.Context(), r, userID, ""), 5*time.Second)
+	defer cancel()
+
+	var rule Rule
+	err := s.rules.FindOne(ctx, bson.M{"_id": ruleID, "user_id": userID}).Decode(&rule)
+	if err == mongo.ErrNoDocuments {
+		s.errorResponse(w, http.StatusNotFound, "Rule not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting rule: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to get rule")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, rule)
+}
+
+func (s *Service) updateRule(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	ruleID := mux.Vars(r)["id"]
+	var req struct {
+		Name       string       `json:"name"`
+		Expression string       `json:"expression"`
+		Actions    []RuleAction `json:"actions"`
+		Enabled    *bool        `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Expression != "" {
+		if _, err := parseRuleExpression(req.Expression); err != nil {
+			s.errorResponse(w, http.StatusBadRequest, "Invalid expression: "+err.Error())
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(withRequestLogger(r.Context(), r, userID, ""), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"updated_at": time.Now()}
+	if req.Name != "" {
+		update["name"] = req.Name
+	}
+	if req.Expression != "" {
+		update["expression"] = req.Expression
+	}
+	if req.Actions != nil {
+		update["actions"] = req.Actions
+	}
+	if req.Enabled != nil {
+		update["enabled"] = *req.Enabled
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var rule Rule
+	err := s.rules.FindOneAndUpdate(ctx, bson.M{"_id": ruleID, "user_id": userID}, bson.M{"$set": update}, opts).Decode(&rule)
+	if err == mongo.ErrNoDocuments {
+		s.errorResponse(w, http.StatusNotFound, "Rule not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating rule: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to update rule")
+		return
+	}
+
+	s.ruleEngine.Reload(ctx)
+	s.jsonResponse(w, http.StatusOK, rule)
+}
+
+func (s *Service) deleteRule(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	ruleID := mux.Vars(r)["id"]
+	ctx, cancel := context.WithTimeout(withRequestLogger(r.Context(), r, userID, ""), 5*time.Second)
+	defer cancel()
+
+	res, err := s.rules.DeleteOne(ctx, bson.M{"_id": ruleID, "user_id": userID})
+	if err != nil {
+		log.Printf("Error deleting rule: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to delete rule")
+		return
+	}
+	if res.DeletedCount == 0 {
+		s.errorResponse(w, http.StatusNotFound, "Rule not found")
+		return
+	}
+
+	s.ruleEngine.Reload(ctx)
+	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// dryRunRule evaluates a rule's current expression against live device
+// state without dispatching its actions, so a user can debug why a rule
+// did or didn't fire.
+func (s *Service) dryRunRule(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	ruleID := mux.Vars(r)["id"]
+	ctx, cancel := context.WithTimeout(withRequestLogger(r.Context(), r, userID, ""), 5*time.Second)
+	defer cancel()
+
+	var rule Rule
+	err := s.rules.FindOne(ctx, bson.M{"_id": ruleID, "user_id": userID}).Decode(&rule)
+	if err == mongo.ErrNoDocuments {
+		s.errorResponse(w, http.StatusNotFound, "Rule not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting rule: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to get rule")
+		return
+	}
+
+	ast, err := parseRuleExpression(rule.Expression)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid expression: "+err.Error())
+		return
+	}
+
+	result, err := ast.Evaluate(ctx, s.ruleEngine.lookup)
+	if err != nil {
+		s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"matched": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"matched": truthy(result),
+		"result":  result,
+	})
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// revokedTokensSetKey is the Redis set revoked device tokens are added to,
+// so validateDeviceToken can reject a just-revoked token with a single
+// SISMEMBER instead of waiting on Mongo's view of revoked_at.
+const revokedTokensSetKey = "device_tokens:revoked"
+
+// DeviceToken is one credential a device can authenticate with. A device
+// can hold several active tokens at once so it can rotate without
+// downtime: mint the replacement, switch the device over, then revoke the
+// old one once it's no longer in use.
+type DeviceToken struct {
+	ID         string     `json:"id" bson:"_id"`
+	DeviceID   string     `json:"device_id" bson:"device_id"`
+	UserID     string     `json:"user_id" bson:"user_id"`
+	Token      string     `json:"-" bson:"token"`
+	Label      string     `json:"label,omitempty" bson:"label,omitempty"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+func tokenLabel(tok DeviceToken) string {
+	if tok.Label != "" {
+		return tok.Label
+	}
+	return tok.ID
+}
+
+// isTokenRevoked checks the Redis revocation set. It fails open (reports
+// not-revoked) if Redis is unavailable, the same as this service's other
+// caches - Mongo's revoked_at field is still checked by the caller and
+// remains authoritative.
+func (s *Service) isTokenRevoked(ctx context.Context, token string) bool {
+	if s.redis == nil {
+		return false
+	}
+	revoked, err := s.redis.SIsMember(ctx, revokedTokensSetKey, token).Result()
+	if err != nil {
+		log.Printf("Warning: failed to check token revocation set: %v", err)
+		return false
+	}
+	return revoked
+}
+
+func (s *Service) mintDeviceTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	deviceID := vars["id"]
+
+	var req struct {
+		Label     string `json:"label"`
+		ExpiresIn string `json:"expires_in"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil {
+			s.errorResponse(w, http.StatusBadRequest, "Invalid expires_in duration")
+			return
+		}
+		t := time.Now().Add(d)
+		expiresAt = &t
+	}
+
+	ctx, cancel := context.WithTimeout(withRequestLogger(r.Context(), r, userID, deviceID), 5*time.Second)
+	defer cancel()
+
+	var device Device
+	err := s.devices.FindOne(ctx, bson.M{"_id": deviceID, "user_id": userID}).Decode(&device)
+	if err == mongo.ErrNoDocuments {
+		s.errorResponse(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error finding device: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to find device")
+		return
+	}
+
+	tok := DeviceToken{
+		ID:        uuid.New().String(),
+		DeviceID:  deviceID,
+		UserID:    userID,
+		Token:     uuid.New().String(),
+		Label:     req.Label,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if _, err := s.deviceTokens.InsertOne(ctx, tok); err != nil {
+		log.Printf("Error minting device token: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to mint device token")
+		return
+	}
+
+	s.publishActivity(ctx, "mongodb", "\xf0\x9f\x94\x91", "Token Minted",
+		fmt.Sprintf("New token '%s' minted for device '%s'", tokenLabel(tok), device.Name),
+		userID, deviceID, "info")
+
+	s.jsonResponse(w, http.StatusCreated, map[string]interface{}{
+		"id":         tok.ID,
+		"token":      tok.Token,
+		"label":      tok.Label,
+		"created_at": tok.CreatedAt,
+		"expires_at": tok.ExpiresAt,
+	})
+}
+
+func (s *Service) listDeviceTokensHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	deviceID := vars["id"]
+
+	ctx, cancel := context.WithTimeout(withRequestLogger(r.Context(), r, userID, deviceID), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"device_id": deviceID, "user_id": userID, "revoked_at": nil}
+	opts := options.Find().SetProjection(bson.M{"token": 0}).SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := s.deviceTokens.Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Error listing device tokens: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to list device tokens")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	tokens := []DeviceToken{}
+	if err := cursor.All(ctx, &tokens); err != nil {
+		log.Printf("Error decoding device tokens: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to list device tokens")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{"tokens": tokens})
+}
+
+func (s *Service) revokeDeviceTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	deviceID := vars["id"]
+	tokenID := vars["tokenID"]
+
+	ctx, cancel := context.WithTimeout(withRequestLogger(r.Context(), r, userID, deviceID), 5*time.Second)
+	defer cancel()
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	filter := bson.M{"_id": tokenID, "device_id": deviceID, "user_id": userID, "revoked_at": nil}
+
+	var tok DeviceToken
+	err := s.deviceTokens.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}}, opts).Decode(&tok)
+	if err == mongo.ErrNoDocuments {
+		s.errorResponse(w, http.StatusNotFound, "Token not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking device token: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to revoke device token")
+		return
+	}
+
+	if s.redis != nil {
+		if err := s.redis.SAdd(ctx, revokedTokensSetKey, tok.Token).Err(); err != nil {
+			log.Printf("Warning: failed to add token to revocation set: %v", err)
+		}
+	}
+
+	s.publishActivity(ctx, "mongodb", "\xf0\x9f\x9a\xab", "Token Revoked",
+		fmt.Sprintf("Token '%s' revoked for device '%s'", tokenLabel(tok), deviceID),
+		userID, deviceID, "info")
+
+	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTokenLabelPrefersExplicitLabel(t *testing.T) {
+	tok := DeviceToken{ID: "tok-1", Label: "kitchen sensor"}
+	if got := tokenLabel(tok); got != "kitchen sensor" {
+		t.Errorf("tokenLabel = %q, want %q", got, "kitchen sensor")
+	}
+}
+
+func TestTokenLabelFallsBackToID(t *testing.T) {
+	tok := DeviceToken{ID: "tok-1"}
+	if got := tokenLabel(tok); got != "tok-1" {
+		t.Errorf("tokenLabel = %q, want the token ID %q", got, "tok-1")
+	}
+}
+
+func TestIsTokenRevokedFailsOpenWithNoRedis(t *testing.T) {
+	s := &Service{}
+	if s.isTokenRevoked(context.Background(), "some-token") {
+		t.Error("isTokenRevoked with no redis client = true, want false (fail open)")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// outboundTask is one unit of outbound work (an HTTP side effect) submitted
+// to an OutboundPool, carrying the context it should run under.
+type outboundTask struct {
+	ctx context.Context
+	fn  func(ctx context.Context)
+}
+
+// OutboundPool runs outbound HTTP side effects (N8N webhooks, activity/
+// notification posts) on a bounded set of workers fed by a buffered
+// channel, so a burst of events can't spawn an unbounded number of
+// goroutines and so Stop can drain what's in flight instead of letting it
+// leak past shutdown.
+type OutboundPool struct {
+	tasks        chan outboundTask
+	wg           sync.WaitGroup
+	drainTimeout time.Duration
+}
+
+// newOutboundPool starts workers goroutines pulling from a channel buffered
+// to queueSize. drainTimeout bounds how long Close waits for in-flight work
+// to finish before giving up.
+func newOutboundPool(workers, queueSize int, drainTimeout time.Duration) *OutboundPool {
+	p := &OutboundPool{
+		tasks:        make(chan outboundTask, queueSize),
+		drainTimeout: drainTimeout,
+	}
+
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+
+	return p
+}
+
+func (p *OutboundPool) worker() {
+	defer p.wg.Done()
+	for task := range p.tasks {
+		if task.ctx.Err() != nil {
+			continue
+		}
+		task.fn(task.ctx)
+		outboundQueueDepth.Set(float64(len(p.tasks)))
+	}
+}
+
+// Submit enqueues fn to run on a worker with ctx. If the queue is full, the
+// submission is dropped (and outboundDroppedTotal incremented) rather than
+// blocking the caller - callers run on the Kafka consume loop and must not
+// stall waiting for a slow downstream peer.
+func (p *OutboundPool) Submit(ctx context.Context, fn func(ctx context.Context)) bool {
+	select {
+	case p.tasks <- outboundTask{ctx: ctx, fn: fn}:
+		outboundQueueDepth.Set(float64(len(p.tasks)))
+		return true
+	default:
+		outboundDroppedTotal.Inc()
+		return false
+	}
+}
+
+// Close stops accepting submissions and waits up to drainTimeout for
+// workers to finish the queue. Callers should cancel the context shared by
+// in-flight tasks once Close returns, aborting anything still running.
+func (p *OutboundPool) Close() bool {
+	close(p.tasks)
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(p.drainTimeout):
+		return false
+	}
+}
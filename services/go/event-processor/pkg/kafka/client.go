@@ -0,0 +1,64 @@
+// Package kafka defines a broker-agnostic Client interface for the event
+// processor, modeled after the voltha-lib-go kafka client: callers subscribe
+// to a topic and get back a channel of Messages, rather than reaching for a
+// broker-specific consumer group API directly. This lets the service select
+// its Kafka client implementation (sarama or franz-go) via config without
+// touching call sites, and lets liveness/healthiness be probed the same way
+// regardless of backend.
+package kafka
+
+import "context"
+
+// Message is one consumed record, translated from whichever broker client
+// produced it.
+type Message struct {
+	Topic     string
+	Key       string
+	Value     []byte
+	Headers   map[string][]byte
+	Partition int32
+	Offset    int64
+}
+
+// KVArg is an optional, named argument to Subscribe/Send - e.g. consumer
+// group name or initial offset - kept as a loose key/value pair (rather
+// than a growing list of parameters) since different backends accept
+// different knobs.
+type KVArg struct {
+	Key   string
+	Value interface{}
+}
+
+// Client is a broker-agnostic Kafka client. Implementations: SaramaClient,
+// FranzClient.
+type Client interface {
+	// Start connects the client to the broker(s) and begins any background
+	// processing (e.g. liveness probes) it needs.
+	Start(ctx context.Context) error
+	// Stop disconnects the client, closing every channel handed out by
+	// Subscribe/EnableLivenessChannel/EnableHealthinessChannel.
+	Stop(ctx context.Context) error
+
+	// Subscribe starts consuming topic and returns a channel of Messages.
+	// args configures backend-specific behavior (e.g. consumer group name).
+	Subscribe(ctx context.Context, topic string, args ...*KVArg) (<-chan *Message, error)
+	// UnSubscribe stops consuming topic on the channel returned by a prior
+	// Subscribe call and closes it.
+	UnSubscribe(ctx context.Context, topic string, ch <-chan *Message) error
+
+	// Send publishes msg to topic, optionally keyed.
+	Send(ctx context.Context, msg []byte, topic string, keys ...string) error
+
+	// SendLiveness probes broker connectivity and, if a liveness channel is
+	// enabled, reports the result on it.
+	SendLiveness(ctx context.Context) error
+	// EnableLivenessChannel turns liveness reporting on or off, returning
+	// the channel results are sent on (created on first enable, reused
+	// after). Readiness probes should treat "no message yet" as unknown,
+	// not unhealthy.
+	EnableLivenessChannel(ctx context.Context, enable bool) chan bool
+	// EnableHealthinessChannel is the same as EnableLivenessChannel but
+	// reports broker health (e.g. can still produce/consume) rather than
+	// raw connectivity.
+	EnableHealthinessChannel(ctx context.Context, enable bool) chan bool
+}
@@ -0,0 +1,242 @@
+package kafka
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Endpoint identifies a topic/partition that an event for a given device
+// should be produced to or owned by.
+type Endpoint struct {
+	Topic     string
+	Partition int32
+}
+
+type owner struct {
+	topic     string
+	partition int32
+}
+
+func (o owner) String() string {
+	return fmt.Sprintf("%s:%d", o.topic, o.partition)
+}
+
+type ringPoint struct {
+	hash  uint64
+	owner owner
+}
+
+// virtualPointsPerOwner controls how many points each topic/partition gets
+// on the device ring - more points spread devices across owners more
+// evenly, at the cost of a larger ring to search.
+const virtualPointsPerOwner = 100
+
+// nodePointsPerNode is the same idea for the node ring used to assign
+// owners to event-processor replicas: more points per node mean adding or
+// removing a node reshuffles a smaller, more evenly-sized slice of owners.
+const nodePointsPerNode = 64
+
+func hashKey(key string) uint64 {
+	sum := sha1.Sum([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// EndpointManager maps (UserID, DeviceID) pairs onto a topic/partition in a
+// fixed topic pool via a consistent-hash ring over the pool's
+// topic:partition pairs ("owners"). A second consistent-hash ring assigns
+// each owner to one of the currently known event-processor replicas
+// ("nodes"), so Reshard only moves roughly 1/N of owners when a node joins
+// or leaves rather than remapping everything. Per-tenant replication
+// widens how many distinct owners a tenant's devices are spread across, so
+// a single noisy tenant doesn't concentrate traffic on one partition.
+type EndpointManager struct {
+	mu sync.RWMutex
+
+	deviceRing []ringPoint
+
+	defaultReplication int
+	tenantReplication  map[string]int
+
+	nodes    []string
+	nodeRing []struct {
+		hash uint64
+		node string
+	}
+}
+
+// NewEndpointManager builds a ring over partitionsPerTopic partitions of
+// each of topics. defaultReplication is the number of distinct owners a
+// device maps to when no tenant-specific override is set (minimum 1).
+func NewEndpointManager(topics []string, partitionsPerTopic int32, defaultReplication int) *EndpointManager {
+	em := &EndpointManager{
+		defaultReplication: defaultReplication,
+		tenantReplication:  make(map[string]int),
+	}
+	em.buildDeviceRing(topics, partitionsPerTopic)
+	return em
+}
+
+func (em *EndpointManager) buildDeviceRing(topics []string, partitionsPerTopic int32) {
+	ring := make([]ringPoint, 0, len(topics)*int(partitionsPerTopic)*virtualPointsPerOwner)
+	for _, topic := range topics {
+		for p := int32(0); p < partitionsPerTopic; p++ {
+			o := owner{topic: topic, partition: p}
+			for v := 0; v < virtualPointsPerOwner; v++ {
+				ring = append(ring, ringPoint{hash: hashKey(fmt.Sprintf("%s#%d", o, v)), owner: o})
+			}
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	em.deviceRing = ring
+}
+
+// SetTenantReplication overrides the replication factor for userID.
+func (em *EndpointManager) SetTenantReplication(userID string, replicationFactor int) {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	em.tenantReplication[userID] = replicationFactor
+}
+
+func (em *EndpointManager) replicationFor(userID string) int {
+	if rf, ok := em.tenantReplication[userID]; ok && rf > 0 {
+		return rf
+	}
+	if em.defaultReplication > 0 {
+		return em.defaultReplication
+	}
+	return 1
+}
+
+// GetEndpoint returns the primary endpoint (userID, deviceID) maps to.
+func (em *EndpointManager) GetEndpoint(userID, deviceID string) (Endpoint, error) {
+	endpoints, err := em.GetEndpoints(userID, deviceID)
+	if err != nil {
+		return Endpoint{}, err
+	}
+	return endpoints[0], nil
+}
+
+// GetEndpoints returns the tenant's replication-factor-many distinct owners
+// (userID, deviceID) maps to, walking the device ring clockwise from the
+// device's hash.
+func (em *EndpointManager) GetEndpoints(userID, deviceID string) ([]Endpoint, error) {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+
+	if len(em.deviceRing) == 0 {
+		return nil, fmt.Errorf("endpoint manager has an empty ring")
+	}
+
+	replicas := em.replicationFor(userID)
+	h := hashKey(userID + "/" + deviceID)
+	start := sort.Search(len(em.deviceRing), func(i int) bool { return em.deviceRing[i].hash >= h })
+
+	seen := make(map[owner]bool, replicas)
+	endpoints := make([]Endpoint, 0, replicas)
+	for i := 0; i < len(em.deviceRing) && len(endpoints) < replicas; i++ {
+		point := em.deviceRing[(start+i)%len(em.deviceRing)]
+		if seen[point.owner] {
+			continue
+		}
+		seen[point.owner] = true
+		endpoints = append(endpoints, Endpoint{Topic: point.owner.topic, Partition: point.owner.partition})
+	}
+	return endpoints, nil
+}
+
+// nodeFor returns the node that owns o, per the current node ring. Returns
+// "" if no nodes have been assigned yet.
+func (em *EndpointManager) nodeFor(o owner) string {
+	if len(em.nodeRing) == 0 {
+		return ""
+	}
+	h := hashKey(o.String())
+	idx := sort.Search(len(em.nodeRing), func(i int) bool { return em.nodeRing[i].hash >= h })
+	if idx == len(em.nodeRing) {
+		idx = 0
+	}
+	return em.nodeRing[idx].node
+}
+
+// IsLocal reports whether owner (the primary endpoint for userID/deviceID)
+// is currently assigned to nodeID.
+func (em *EndpointManager) IsLocal(nodeID, userID, deviceID string) (bool, error) {
+	endpoint, err := em.GetEndpoint(userID, deviceID)
+	if err != nil {
+		return false, err
+	}
+
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	owned := em.nodeFor(owner{topic: endpoint.Topic, partition: endpoint.Partition})
+	return owned == "" || owned == nodeID, nil
+}
+
+// Reshard rebuilds the node ring from nodes, reassigning owners to nodes.
+// Consistent hashing means this moves roughly a 1/len(nodes) share of
+// owners on each join/leave rather than remapping everything, so it's safe
+// to call whenever the replica set changes.
+func (em *EndpointManager) Reshard(nodes []string) error {
+	if len(nodes) == 0 {
+		return fmt.Errorf("reshard requires at least one node")
+	}
+
+	ring := make([]struct {
+		hash uint64
+		node string
+	}, 0, len(nodes)*nodePointsPerNode)
+	for _, node := range nodes {
+		for v := 0; v < nodePointsPerNode; v++ {
+			ring = append(ring, struct {
+				hash uint64
+				node string
+			}{hash: hashKey(fmt.Sprintf("%s#%d", node, v)), node: node})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	em.nodes = append([]string(nil), nodes...)
+	em.nodeRing = ring
+	return nil
+}
+
+// ShardAssignment is one topic/partition owner's current node, as reported
+// by /shards.
+type ShardAssignment struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Node      string `json:"node"`
+}
+
+// Assignments returns every owner's current node assignment, for the
+// /shards admin endpoint.
+func (em *EndpointManager) Assignments() (nodes []string, assignments []ShardAssignment) {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+
+	seen := make(map[owner]bool)
+	for _, point := range em.deviceRing {
+		if seen[point.owner] {
+			continue
+		}
+		seen[point.owner] = true
+		assignments = append(assignments, ShardAssignment{
+			Topic:     point.owner.topic,
+			Partition: point.owner.partition,
+			Node:      em.nodeFor(point.owner),
+		})
+	}
+	sort.Slice(assignments, func(i, j int) bool {
+		if assignments[i].Topic != assignments[j].Topic {
+			return assignments[i].Topic < assignments[j].Topic
+		}
+		return assignments[i].Partition < assignments[j].Partition
+	})
+
+	return append([]string(nil), em.nodes...), assignments
+}
@@ -0,0 +1,210 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+type franzSubscription struct {
+	ch     chan *Message
+	cancel context.CancelFunc
+}
+
+// FranzClient is a franz-go-backed Client implementation - a lower-overhead
+// alternative to SaramaClient, since franz-go speaks the consumer group
+// protocol directly rather than through a separate coordinator goroutine
+// per topic.
+type FranzClient struct {
+	brokers       []string
+	consumerGroup string
+
+	client *kgo.Client
+
+	mu            sync.Mutex
+	subscriptions map[string]*franzSubscription
+
+	livenessMu    sync.Mutex
+	livenessCh    chan bool
+	healthinessCh chan bool
+
+	wg sync.WaitGroup
+}
+
+// NewFranzClient builds a FranzClient. Call Start before Subscribe/Send.
+func NewFranzClient(brokers []string, consumerGroup string) *FranzClient {
+	return &FranzClient{
+		brokers:       brokers,
+		consumerGroup: consumerGroup,
+		subscriptions: make(map[string]*franzSubscription),
+	}
+}
+
+func (c *FranzClient) Start(ctx context.Context) error {
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(c.brokers...),
+		kgo.ConsumerGroup(c.consumerGroup),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtEnd()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create franz-go client: %w", err)
+	}
+	c.client = client
+	return nil
+}
+
+func (c *FranzClient) Subscribe(ctx context.Context, topic string, args ...*KVArg) (<-chan *Message, error) {
+	subCtx, cancel := context.WithCancel(ctx)
+	ch := make(chan *Message, 256)
+
+	c.mu.Lock()
+	c.subscriptions[topic] = &franzSubscription{ch: ch, cancel: cancel}
+	c.mu.Unlock()
+
+	c.client.AddConsumeTopics(topic)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer close(ch)
+		for {
+			fetches := c.client.PollFetches(subCtx)
+			if subCtx.Err() != nil {
+				return
+			}
+
+			fetches.EachError(func(t string, p int32, err error) {
+				logger.Error("fetch error", "topic", t, "partition", p, "error", err)
+			})
+
+			fetches.EachRecord(func(r *kgo.Record) {
+				if r.Topic != topic {
+					return
+				}
+
+				headers := make(map[string][]byte, len(r.Headers))
+				for _, header := range r.Headers {
+					headers[header.Key] = header.Value
+				}
+
+				select {
+				case ch <- &Message{
+					Topic:     r.Topic,
+					Key:       string(r.Key),
+					Value:     r.Value,
+					Headers:   headers,
+					Partition: r.Partition,
+					Offset:    r.Offset,
+				}:
+				case <-subCtx.Done():
+				}
+			})
+
+			c.client.AllowRebalance()
+		}
+	}()
+
+	return ch, nil
+}
+
+func (c *FranzClient) UnSubscribe(ctx context.Context, topic string, ch <-chan *Message) error {
+	c.mu.Lock()
+	sub, ok := c.subscriptions[topic]
+	if ok {
+		delete(c.subscriptions, topic)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("not subscribed to topic %s", topic)
+	}
+	sub.cancel()
+	c.client.RemoveConsumeTopics(topic)
+	return nil
+}
+
+func (c *FranzClient) Send(ctx context.Context, msg []byte, topic string, keys ...string) error {
+	record := &kgo.Record{Topic: topic, Value: msg}
+	if len(keys) > 0 && keys[0] != "" {
+		record.Key = []byte(keys[0])
+	}
+
+	result := c.client.ProduceSync(ctx, record)
+	return result.FirstErr()
+}
+
+func (c *FranzClient) SendLiveness(ctx context.Context) error {
+	err := c.client.Ping(ctx)
+	c.reportLiveness(err == nil)
+	return err
+}
+
+func (c *FranzClient) EnableLivenessChannel(ctx context.Context, enable bool) chan bool {
+	c.livenessMu.Lock()
+	defer c.livenessMu.Unlock()
+
+	if enable {
+		if c.livenessCh == nil {
+			c.livenessCh = make(chan bool, 10)
+		}
+		return c.livenessCh
+	}
+
+	if c.livenessCh != nil {
+		close(c.livenessCh)
+		c.livenessCh = nil
+	}
+	return nil
+}
+
+func (c *FranzClient) EnableHealthinessChannel(ctx context.Context, enable bool) chan bool {
+	c.livenessMu.Lock()
+	defer c.livenessMu.Unlock()
+
+	if enable {
+		if c.healthinessCh == nil {
+			c.healthinessCh = make(chan bool, 10)
+		}
+		return c.healthinessCh
+	}
+
+	if c.healthinessCh != nil {
+		close(c.healthinessCh)
+		c.healthinessCh = nil
+	}
+	return nil
+}
+
+func (c *FranzClient) reportLiveness(live bool) {
+	c.livenessMu.Lock()
+	ch := c.livenessCh
+	c.livenessMu.Unlock()
+	if ch == nil {
+		return
+	}
+	select {
+	case ch <- live:
+	default:
+	}
+}
+
+func (c *FranzClient) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	for _, sub := range c.subscriptions {
+		sub.cancel()
+	}
+	c.subscriptions = make(map[string]*franzSubscription)
+	c.mu.Unlock()
+
+	c.wg.Wait()
+
+	if c.client != nil {
+		c.client.Close()
+	}
+
+	c.EnableLivenessChannel(ctx, false)
+	c.EnableHealthinessChannel(ctx, false)
+	return nil
+}
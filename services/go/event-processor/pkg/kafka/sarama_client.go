@@ -0,0 +1,300 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/homeguard/event-processor/pkg/logging"
+)
+
+var logger = logging.Get("kafka")
+
+type saramaSubscription struct {
+	ch     chan *Message
+	cancel context.CancelFunc
+}
+
+// SaramaClient is the sarama-backed Client implementation.
+type SaramaClient struct {
+	brokers       []string
+	consumerGroup string
+	config        *sarama.Config
+
+	baseCtx  context.Context
+	group    sarama.ConsumerGroup
+	producer sarama.SyncProducer
+	metadata sarama.Client
+
+	mu            sync.Mutex
+	subscriptions map[string]*saramaSubscription
+
+	livenessMu    sync.Mutex
+	livenessCh    chan bool
+	healthinessCh chan bool
+
+	wg sync.WaitGroup
+}
+
+// NewSaramaClient builds a SaramaClient. Call Start before Subscribe/Send.
+func NewSaramaClient(brokers []string, consumerGroup string) *SaramaClient {
+	cfg := sarama.NewConfig()
+	cfg.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
+	cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+	cfg.Consumer.Return.Errors = true
+	cfg.Net.DialTimeout = 10 * time.Second
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.RequiredAcks = sarama.WaitForAll
+
+	return &SaramaClient{
+		brokers:       brokers,
+		consumerGroup: consumerGroup,
+		config:        cfg,
+		subscriptions: make(map[string]*saramaSubscription),
+	}
+}
+
+func (c *SaramaClient) Start(ctx context.Context) error {
+	c.baseCtx = ctx
+
+	group, err := sarama.NewConsumerGroup(c.brokers, c.consumerGroup, c.config)
+	if err != nil {
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+	c.group = group
+
+	producer, err := sarama.NewSyncProducer(c.brokers, c.config)
+	if err != nil {
+		group.Close()
+		return fmt.Errorf("failed to create producer: %w", err)
+	}
+	c.producer = producer
+
+	metadata, err := sarama.NewClient(c.brokers, c.config)
+	if err != nil {
+		producer.Close()
+		group.Close()
+		return fmt.Errorf("failed to create metadata client: %w", err)
+	}
+	c.metadata = metadata
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for err := range c.group.Errors() {
+			logger.Error("consumer group error", "error", err)
+			c.reportHealthiness(false)
+		}
+	}()
+
+	return nil
+}
+
+type saramaHandler struct {
+	ch chan *Message
+}
+
+func (h *saramaHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (h *saramaHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *saramaHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+
+			headers := make(map[string][]byte, len(msg.Headers))
+			for _, header := range msg.Headers {
+				headers[string(header.Key)] = header.Value
+			}
+
+			select {
+			case h.ch <- &Message{
+				Topic:     msg.Topic,
+				Key:       string(msg.Key),
+				Value:     msg.Value,
+				Headers:   headers,
+				Partition: msg.Partition,
+				Offset:    msg.Offset,
+			}:
+			case <-session.Context().Done():
+				return nil
+			}
+
+			session.MarkMessage(msg, "")
+
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Subscribe starts consuming topic in its own goroutine and returns a
+// channel of Messages. args is currently unused by the sarama backend (the
+// consumer group and offset reset policy are fixed at NewSaramaClient time).
+func (c *SaramaClient) Subscribe(ctx context.Context, topic string, args ...*KVArg) (<-chan *Message, error) {
+	subCtx, cancel := context.WithCancel(c.baseCtx)
+	ch := make(chan *Message, 256)
+
+	c.mu.Lock()
+	c.subscriptions[topic] = &saramaSubscription{ch: ch, cancel: cancel}
+	c.mu.Unlock()
+
+	handler := &saramaHandler{ch: ch}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer close(ch)
+		for {
+			if err := c.group.Consume(subCtx, []string{topic}, handler); err != nil {
+				if err == sarama.ErrClosedConsumerGroup {
+					return
+				}
+				logger.Error("error consuming topic", "topic", topic, "error", err)
+			}
+			if subCtx.Err() != nil {
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (c *SaramaClient) UnSubscribe(ctx context.Context, topic string, ch <-chan *Message) error {
+	c.mu.Lock()
+	sub, ok := c.subscriptions[topic]
+	if ok {
+		delete(c.subscriptions, topic)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("not subscribed to topic %s", topic)
+	}
+	sub.cancel()
+	return nil
+}
+
+func (c *SaramaClient) Send(ctx context.Context, msg []byte, topic string, keys ...string) error {
+	producerMsg := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(msg),
+	}
+	if len(keys) > 0 && keys[0] != "" {
+		producerMsg.Key = sarama.StringEncoder(keys[0])
+	}
+
+	_, _, err := c.producer.SendMessage(producerMsg)
+	return err
+}
+
+func (c *SaramaClient) SendLiveness(ctx context.Context) error {
+	if c.metadata == nil {
+		c.reportLiveness(false)
+		return fmt.Errorf("kafka client not started")
+	}
+
+	err := c.metadata.RefreshMetadata()
+	c.reportLiveness(err == nil)
+	return err
+}
+
+func (c *SaramaClient) EnableLivenessChannel(ctx context.Context, enable bool) chan bool {
+	c.livenessMu.Lock()
+	defer c.livenessMu.Unlock()
+
+	if enable {
+		if c.livenessCh == nil {
+			c.livenessCh = make(chan bool, 10)
+		}
+		return c.livenessCh
+	}
+
+	if c.livenessCh != nil {
+		close(c.livenessCh)
+		c.livenessCh = nil
+	}
+	return nil
+}
+
+func (c *SaramaClient) EnableHealthinessChannel(ctx context.Context, enable bool) chan bool {
+	c.livenessMu.Lock()
+	defer c.livenessMu.Unlock()
+
+	if enable {
+		if c.healthinessCh == nil {
+			c.healthinessCh = make(chan bool, 10)
+		}
+		return c.healthinessCh
+	}
+
+	if c.healthinessCh != nil {
+		close(c.healthinessCh)
+		c.healthinessCh = nil
+	}
+	return nil
+}
+
+func (c *SaramaClient) reportLiveness(live bool) {
+	c.livenessMu.Lock()
+	ch := c.livenessCh
+	c.livenessMu.Unlock()
+	if ch == nil {
+		return
+	}
+	select {
+	case ch <- live:
+	default:
+	}
+}
+
+func (c *SaramaClient) reportHealthiness(healthy bool) {
+	c.livenessMu.Lock()
+	ch := c.healthinessCh
+	c.livenessMu.Unlock()
+	if ch == nil {
+		return
+	}
+	select {
+	case ch <- healthy:
+	default:
+	}
+}
+
+func (c *SaramaClient) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	for _, sub := range c.subscriptions {
+		sub.cancel()
+	}
+	c.subscriptions = make(map[string]*saramaSubscription)
+	c.mu.Unlock()
+
+	c.wg.Wait()
+
+	var err error
+	if c.group != nil {
+		err = c.group.Close()
+	}
+	if c.producer != nil {
+		if perr := c.producer.Close(); perr != nil && err == nil {
+			err = perr
+		}
+	}
+	if c.metadata != nil {
+		if merr := c.metadata.Close(); merr != nil && err == nil {
+			err = merr
+		}
+	}
+
+	c.EnableLivenessChannel(ctx, false)
+	c.EnableHealthinessChannel(ctx, false)
+
+	return err
+}
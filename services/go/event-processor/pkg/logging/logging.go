@@ -0,0 +1,75 @@
+// Package logging is a small per-package structured logger registry on top
+// of log/slog: each package (main, kafka, ...) gets its own *slog.Logger
+// carrying a "package" field, with a level that can be raised or lowered at
+// runtime via SetLevel without restarting the process.
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	mu     sync.RWMutex
+	levels = make(map[string]*slog.LevelVar)
+	output = os.Stdout
+)
+
+// Get returns the logger for pkg, registering it at the default Info level
+// on first use. Intended to be called once per package, into a package-level
+// "logger" variable initialized in that package's init().
+func Get(pkg string) *slog.Logger {
+	mu.Lock()
+	lv, ok := levels[pkg]
+	if !ok {
+		lv = new(slog.LevelVar)
+		levels[pkg] = lv
+	}
+	mu.Unlock()
+
+	handler := slog.NewJSONHandler(output, &slog.HandlerOptions{Level: lv})
+	return slog.New(handler).With("package", pkg)
+}
+
+// SetLevel changes the level of a previously-registered package's logger at
+// runtime. Valid levels are "debug", "info", "warn", and "error".
+func SetLevel(pkg, level string) error {
+	var parsed slog.Level
+	switch strings.ToLower(level) {
+	case "debug":
+		parsed = slog.LevelDebug
+	case "info":
+		parsed = slog.LevelInfo
+	case "warn", "warning":
+		parsed = slog.LevelWarn
+	case "error":
+		parsed = slog.LevelError
+	default:
+		return fmt.Errorf("unknown log level %q", level)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	lv, ok := levels[pkg]
+	if !ok {
+		return fmt.Errorf("unknown package %q", pkg)
+	}
+	lv.Set(parsed)
+	return nil
+}
+
+// Levels returns the current level of every registered package, keyed by
+// package name, for the /loglevel endpoint's GET response.
+func Levels() map[string]string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	out := make(map[string]string, len(levels))
+	for pkg, lv := range levels {
+		out[pkg] = lv.Level().String()
+	}
+	return out
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TimescaleSink batches DeviceEvents and writes them to a TimescaleDB
+// hypertable partitioned by (user_id, time) using a multi-row COPY. Enqueue
+// blocks once the sink's buffered channel is full, so a slow or unreachable
+// database backpressures the caller instead of dropping events.
+type TimescaleSink struct {
+	pool       *pgxpool.Pool
+	queue      chan DeviceEvent
+	batchSize  int
+	flushEvery time.Duration
+	wg         sync.WaitGroup
+}
+
+func newTimescaleSink(ctx context.Context, dsn string, batchSize, queueSize int, flushEvery time.Duration) (*TimescaleSink, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to timescaledb: %w", err)
+	}
+
+	s := &TimescaleSink{
+		pool:       pool,
+		queue:      make(chan DeviceEvent, queueSize),
+		batchSize:  batchSize,
+		flushEvery: flushEvery,
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// Enqueue blocks if the sink's queue is full, so Kafka backpressures rather
+// than events being silently dropped.
+func (s *TimescaleSink) Enqueue(event DeviceEvent) {
+	s.queue <- event
+	sinkQueueDepth.WithLabelValues("timescaledb").Set(float64(len(s.queue)))
+}
+
+func (s *TimescaleSink) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.flushEvery)
+	defer ticker.Stop()
+
+	batch := make([]DeviceEvent, 0, s.batchSize)
+	for {
+		select {
+		case event, ok := <-s.queue:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= s.batchSize {
+				s.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (s *TimescaleSink) flush(batch []DeviceEvent) {
+	if len(batch) == 0 {
+		return
+	}
+	start := time.Now()
+
+	rows := make([][]interface{}, len(batch))
+	for i, event := range batch {
+		payload, _ := json.Marshal(event.Payload)
+		rows[i] = []interface{}{event.UserID, event.Timestamp, event.ID, event.DeviceID, event.EventType, payload}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := s.pool.CopyFrom(ctx,
+		pgx.Identifier{"device_events"},
+		[]string{"user_id", "time", "id", "device_id", "event_type", "payload"},
+		pgx.CopyFromRows(rows),
+	); err != nil {
+		logger.Error("failed to flush events to timescaledb", "count", len(batch), "error", err)
+	}
+
+	sinkBatchSize.WithLabelValues("timescaledb").Observe(float64(len(batch)))
+	sinkFlushDuration.WithLabelValues("timescaledb").Observe(time.Since(start).Seconds())
+	sinkQueueDepth.WithLabelValues("timescaledb").Set(float64(len(s.queue)))
+}
+
+func (s *TimescaleSink) Close() {
+	close(s.queue)
+	s.wg.Wait()
+	s.pool.Close()
+}
+
+// ScyllaSink batches DeviceEvents and writes them to ScyllaDB using unlogged
+// batches keyed by device_id. Enqueue blocks once the sink's buffered
+// channel is full, for the same backpressure reason as TimescaleSink.
+type ScyllaSink struct {
+	session    *gocql.Session
+	queue      chan DeviceEvent
+	batchSize  int
+	flushEvery time.Duration
+	wg         sync.WaitGroup
+}
+
+func newScyllaSink(hosts []string, batchSize, queueSize int, flushEvery time.Duration) (*ScyllaSink, error) {
+	cluster := gocql.NewCluster(hosts...)
+	cluster.Consistency = gocql.Quorum
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to scylladb: %w", err)
+	}
+
+	s := &ScyllaSink{
+		session:    session,
+		queue:      make(chan DeviceEvent, queueSize),
+		batchSize:  batchSize,
+		flushEvery: flushEvery,
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+func (s *ScyllaSink) Enqueue(event DeviceEvent) {
+	s.queue <- event
+	sinkQueueDepth.WithLabelValues("scylladb").Set(float64(len(s.queue)))
+}
+
+func (s *ScyllaSink) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.flushEvery)
+	defer ticker.Stop()
+
+	batch := make([]DeviceEvent, 0, s.batchSize)
+	for {
+		select {
+		case event, ok := <-s.queue:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= s.batchSize {
+				s.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (s *ScyllaSink) flush(batch []DeviceEvent) {
+	if len(batch) == 0 {
+		return
+	}
+	start := time.Now()
+
+	b := s.session.NewBatch(gocql.UnloggedBatch)
+	for _, event := range batch {
+		payload, _ := json.Marshal(event.Payload)
+		b.Query(
+			`INSERT INTO device_events (device_id, time, id, user_id, event_type, payload) VALUES (?, ?, ?, ?, ?, ?)`,
+			event.DeviceID, event.Timestamp, event.ID, event.UserID, event.EventType, payload,
+		)
+	}
+
+	if err := s.session.ExecuteBatch(b); err != nil {
+		logger.Error("failed to flush events to scylladb", "count", len(batch), "error", err)
+	}
+
+	sinkBatchSize.WithLabelValues("scylladb").Observe(float64(len(batch)))
+	sinkFlushDuration.WithLabelValues("scylladb").Observe(time.Since(start).Seconds())
+	sinkQueueDepth.WithLabelValues("scylladb").Set(float64(len(s.queue)))
+}
+
+func (s *ScyllaSink) Close() {
+	close(s.queue)
+	s.wg.Wait()
+	s.session.Close()
+}
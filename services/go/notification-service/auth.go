@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var authFailures = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "notification_service_auth_failures_total",
+		Help: "Total number of rejected authentication attempts, by reason",
+	},
+	[]string{"reason"},
+)
+
+func init() {
+	prometheus.MustRegister(authFailures)
+}
+
+// authClaims are the claims expected in a bearer token: either a user's JWT
+// (subject is the user_id) or a shared HMAC service token minted with the
+// same secret for service-to-service calls (e.g. postActivity).
+type authClaims struct {
+	UserID string `json:"user_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// principal returns the token's subject, falling back to the user_id claim
+// for tokens that set one instead of (or in addition to) "sub".
+func (c *authClaims) principal() string {
+	if c.Subject != "" {
+		return c.Subject
+	}
+	return c.UserID
+}
+
+func bearerToken(r *http.Request) string {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return ""
+	}
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return ""
+	}
+	return tokenString
+}
+
+// authMiddleware validates a bearer JWT or shared HMAC token against the
+// configured secret (and issuer, if one is set) and stores the resolved
+// principal and client IP on the request context for handlers and access
+// logs to use.
+func (s *Service) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "client_ip", realClientIP(r, s.trustedProxies))
+
+		tokenString := bearerToken(r)
+		if tokenString == "" {
+			authFailures.WithLabelValues("missing_token").Inc()
+			s.errorResponse(w, http.StatusUnauthorized, "Missing authorization header")
+			return
+		}
+
+		claims := &authClaims{}
+		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(s.config.JWTSecret), nil
+		})
+		if err != nil || !token.Valid {
+			authFailures.WithLabelValues("invalid_token").Inc()
+			s.errorResponse(w, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+
+		if s.config.JWTIssuer != "" && claims.Issuer != s.config.JWTIssuer {
+			authFailures.WithLabelValues("wrong_issuer").Inc()
+			s.errorResponse(w, http.StatusUnauthorized, "Invalid token issuer")
+			return
+		}
+
+		ctx = context.WithValue(ctx, "principal", claims.principal())
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// requireUserMatch rejects requests whose authenticated principal doesn't
+// match the {user_id} path parameter, so one user's token can't be used to
+// read or stream another's notifications or activity.
+func (s *Service) requireUserMatch(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := r.Context().Value("principal").(string)
+		userID := mux.Vars(r)["user_id"]
+
+		if principal == "" || principal != userID {
+			authFailures.WithLabelValues("subject_mismatch").Inc()
+			s.errorResponse(w, http.StatusForbidden, "Token subject does not match user_id")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// checkOrigin restricts WebSocket upgrades to the configured allow-list,
+// except in dev mode where every origin is accepted. Requests without an
+// Origin header (non-browser clients) are always allowed.
+func (s *Service) checkOrigin(r *http.Request) bool {
+	if s.config.DevMode {
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	for _, allowed := range s.config.AllowedOrigins {
+		if allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// realClientIP resolves the caller's real IP. X-Forwarded-For/X-Real-IP are
+// only honored when RemoteAddr belongs to a configured trusted proxy CIDR;
+// otherwise a client could simply forge the header to impersonate anyone.
+func realClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	remote := net.ParseIP(host)
+	if remote == nil || !ipTrusted(remote, trustedProxies) {
+		return host
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		if first := strings.TrimSpace(strings.Split(xff, ",")[0]); first != "" {
+			return first
+		}
+	}
+	if xri := r.Header.Get("X-Real-IP"); xri != "" {
+		return xri
+	}
+
+	return host
+}
+
+func ipTrusted(ip net.IP, trustedProxies []*net.IPNet) bool {
+	for _, cidr := range trustedProxies {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTrustedProxies(cidrs []string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, raw := range cidrs {
+		_, network, err := net.ParseCIDR(raw)
+		if err != nil {
+			log.Printf("Ignoring invalid trusted proxy CIDR %q: %v", raw, err)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func splitCSV(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			out = append(out, trimmed)
+		}
+	}
+	return out
+}
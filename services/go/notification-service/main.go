@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -18,12 +21,26 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/time/rate"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Port     string
-	RedisURL string
+	Port          string
+	RedisURL      string
+	BusStreamTTL  time.Duration
+	BusStreamSize int64
+
+	JWTSecret         string
+	JWTIssuer         string
+	TrustedProxyCIDRs []string
+	AllowedOrigins    []string
+	DevMode           bool
+
+	WSMaxMessageSize int64
+	WSOverflowPolicy string
+	IngressRateLimit float64
+	IngressRateBurst int
 }
 
 // Notification represents a notification to be sent
@@ -105,44 +122,43 @@ func init() {
 	prometheus.MustRegister(activityEventsBroadcast)
 }
 
-// WebSocket upgrader
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for development
-	},
-}
+// Service handles notifications
+type Service struct {
+	config   *Config
+	redis    *redis.Client
+	router   *mux.Router
+	bus      *TopicBus
+	upgrader websocket.Upgrader
 
-// Client represents a WebSocket client
-type Client struct {
-	conn   *websocket.Conn
-	userID string
-	send   chan []byte
-}
+	trustedProxies  []*net.IPNet
+	ipRateLimiter   *RateLimiter
+	userRateLimiter *RateLimiter
 
-// ActivityClient represents a WebSocket client for activity stream
-type ActivityClient struct {
-	conn   *websocket.Conn
-	userID string
-	send   chan []byte
-}
+	shuttingDown int32
 
-// Service handles notifications
-type Service struct {
-	config          *Config
-	redis           *redis.Client
-	router          *mux.Router
-	clients         map[string]*Client
-	activityClients map[string]*ActivityClient
-	mu              sync.RWMutex
-	activityMu      sync.RWMutex
+	sessionsMu sync.Mutex
+	sessions   map[string]*wsSession
+
+	busCancel context.CancelFunc
 }
 
 func loadConfig() *Config {
 	return &Config{
-		Port:     getEnv("PORT", "8080"),
-		RedisURL: getEnv("REDIS_URL", "redis://redis.homeguard-data:6379"),
+		Port:          getEnv("PORT", "8080"),
+		RedisURL:      getEnv("REDIS_URL", "redis://redis.homeguard-data:6379"),
+		BusStreamTTL:  time.Duration(getEnvInt("BUS_STREAM_TTL_SECONDS", 3600)) * time.Second,
+		BusStreamSize: int64(getEnvInt("BUS_STREAM_SIZE", 500)),
+
+		JWTSecret:         getEnv("JWT_SECRET", "homeguard-jwt-secret-change-in-production-2024-very-long-key"),
+		JWTIssuer:         getEnv("JWT_ISSUER", ""),
+		TrustedProxyCIDRs: splitCSV(getEnv("TRUSTED_PROXY_CIDRS", "10.0.0.0/8,172.16.0.0/12,192.168.0.0/16")),
+		AllowedOrigins:    splitCSV(getEnv("ALLOWED_ORIGINS", "")),
+		DevMode:           getEnv("DEV_MODE", "false") == "true",
+
+		WSMaxMessageSize: int64(getEnvInt("WS_MAX_MESSAGE_SIZE", 4096)),
+		WSOverflowPolicy: getEnv("WS_OVERFLOW_POLICY", OverflowDropNewest),
+		IngressRateLimit: getEnvFloat("INGRESS_RATE_LIMIT", 20),
+		IngressRateBurst: getEnvInt("INGRESS_RATE_BURST", 40),
 	}
 }
 
@@ -153,6 +169,24 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
 // NewService creates a new notification service
 func NewService(config *Config) (*Service, error) {
 	opt, err := redis.ParseURL(config.RedisURL)
@@ -169,13 +203,51 @@ func NewService(config *Config) (*Service, error) {
 		log.Printf("Warning: Redis connection failed: %v", err)
 	}
 
-	return &Service{
+	svc := &Service{
 		config:          config,
 		redis:           redisClient,
 		router:          mux.NewRouter(),
-		clients:         make(map[string]*Client),
-		activityClients: make(map[string]*ActivityClient),
-	}, nil
+		bus:             NewTopicBus(redisClient, config.BusStreamTTL, config.BusStreamSize),
+		sessions:        make(map[string]*wsSession),
+		trustedProxies:  parseTrustedProxies(config.TrustedProxyCIDRs),
+		ipRateLimiter:   NewRateLimiter(rate.Limit(config.IngressRateLimit), config.IngressRateBurst),
+		userRateLimiter: NewRateLimiter(rate.Limit(config.IngressRateLimit), config.IngressRateBurst),
+	}
+
+	// Subprotocols advertises homeguard.v1 so gorilla negotiates and echoes
+	// it back during the handshake; handlers still check negotiateSubprotocol
+	// themselves first so an unrecognized protocol can be rejected with a
+	// plain 400 instead of failing the handshake. CheckOrigin defers to the
+	// configured allow-list rather than accepting every origin.
+	svc.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    []string{wsSubprotocol},
+		CheckOrigin:     svc.checkOrigin,
+	}
+
+	return svc, nil
+}
+
+// Start begins background processing tied to the service's lifetime (the
+// bus's cross-instance fanout subscriber). Call it once before serving
+// traffic; Shutdown cancels the context it creates.
+func (s *Service) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.busCancel = cancel
+	s.bus.Start(ctx)
+}
+
+func (s *Service) registerSession(sess *wsSession) {
+	s.sessionsMu.Lock()
+	s.sessions[sess.listenerID] = sess
+	s.sessionsMu.Unlock()
+}
+
+func (s *Service) unregisterSession(sess *wsSession) {
+	s.sessionsMu.Lock()
+	delete(s.sessions, sess.listenerID)
+	s.sessionsMu.Unlock()
 }
 
 // SetupRoutes configures HTTP routes
@@ -183,19 +255,22 @@ func (s *Service) SetupRoutes() {
 	s.router.HandleFunc("/health", s.healthCheck).Methods("GET")
 	s.router.Handle("/metrics", promhttp.Handler())
 
-	// Notification endpoints
-	s.router.HandleFunc("/notify", s.sendNotification).Methods("POST")
-	s.router.HandleFunc("/notifications/{user_id}", s.getUserNotifications).Methods("GET")
-	s.router.HandleFunc("/notifications/{user_id}/{notification_id}/read", s.markAsRead).Methods("POST")
-	s.router.HandleFunc("/notifications/{user_id}/read-all", s.markAllAsRead).Methods("POST")
+	// Notification endpoints. The {user_id}-scoped ones additionally require
+	// the authenticated principal to match the path parameter.
+	s.router.HandleFunc("/notify", s.authMiddleware(s.ingressRateLimitMiddleware(s.sendNotification))).Methods("POST")
+	s.router.HandleFunc("/notifications/{user_id}", s.authMiddleware(s.requireUserMatch(s.getUserNotifications))).Methods("GET")
+	s.router.HandleFunc("/notifications/{user_id}/{notification_id}/read", s.authMiddleware(s.requireUserMatch(s.markAsRead))).Methods("POST")
+	s.router.HandleFunc("/notifications/{user_id}/read-all", s.authMiddleware(s.requireUserMatch(s.markAllAsRead))).Methods("POST")
 
 	// WebSocket endpoint for notifications
-	s.router.HandleFunc("/ws/{user_id}", s.handleWebSocket)
-
-	// Activity stream endpoints
-	s.router.HandleFunc("/activity", s.postActivity).Methods("POST")
-	s.router.HandleFunc("/activity/stream/{user_id}", s.handleActivityWebSocket)
-	s.router.HandleFunc("/activity/recent/{user_id}", s.getRecentActivity).Methods("GET")
+	s.router.HandleFunc("/ws/{user_id}", s.authMiddleware(s.requireUserMatch(s.handleWebSocket)))
+
+	// Activity stream endpoints. The activity firehose isn't user-scoped, so
+	// only sendNotification-style callers need a valid token, not a matching
+	// subject.
+	s.router.HandleFunc("/activity", s.authMiddleware(s.ingressRateLimitMiddleware(s.postActivity))).Methods("POST")
+	s.router.HandleFunc("/activity/stream/{user_id}", s.authMiddleware(s.handleActivityWebSocket))
+	s.router.HandleFunc("/activity/recent/{user_id}", s.authMiddleware(s.requireUserMatch(s.getRecentActivity))).Methods("GET")
 }
 
 func (s *Service) healthCheck(w http.ResponseWriter, r *http.Request) {
@@ -260,6 +335,10 @@ func (s *Service) sendNotification(w http.ResponseWriter, r *http.Request) {
 	// Send via WebSocket if client is connected
 	s.sendToClient(req.UserID, notification)
 
+	principal, _ := r.Context().Value("principal").(string)
+	clientIP, _ := r.Context().Value("client_ip").(string)
+	log.Printf("Notification %s sent for user=%s by principal=%s ip=%s", notification.ID, req.UserID, principal, clientIP)
+
 	notificationsSent.WithLabelValues(req.Type, req.Priority).Inc()
 
 	s.jsonResponse(w, http.StatusAccepted, map[string]interface{}{
@@ -352,103 +431,73 @@ func (s *Service) markAllAsRead(w http.ResponseWriter, r *http.Request) {
 	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "all marked as read"})
 }
 
+func notificationTopic(userID string) string {
+	return fmt.Sprintf("user:%s", userID)
+}
+
+// parseSince reads the ?since=<seq> query parameter a reconnecting client
+// sends to ask for everything it missed from a topic's replay stream.
+func parseSince(r *http.Request) (uint64, bool) {
+	raw := r.URL.Query().Get("since")
+	if raw == "" {
+		return 0, false
+	}
+	since, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return since, true
+}
+
+// handleWebSocket upgrades to a homeguard.v1 session subscribed by default
+// to the path's user_id topic; subscribe/unsubscribe frames can broaden or
+// narrow that afterward.
 func (s *Service) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["user_id"]
 
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+	if atomic.LoadInt32(&s.shuttingDown) == 1 {
+		http.Error(w, "service is shutting down", http.StatusServiceUnavailable)
 		return
 	}
 
-	client := &Client{
-		conn:   conn,
-		userID: userID,
-		send:   make(chan []byte, 256),
+	if !negotiateSubprotocol(r) {
+		http.Error(w, fmt.Sprintf("missing or unsupported Sec-WebSocket-Protocol, expected %s", wsSubprotocol), http.StatusBadRequest)
+		return
 	}
 
-	s.mu.Lock()
-	s.clients[userID] = client
-	s.mu.Unlock()
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
 
+	sess := newWSSession(conn, userID, fmt.Sprintf("notification:%s", userID), activeConnections, s.config.WSMaxMessageSize, s.config.WSOverflowPolicy)
+	topics := s.applySubscription(sess, []string{notificationTopic(userID)}, nil)
 	activeConnections.Inc()
 
-	go s.writePump(client)
-	s.readPump(client)
-}
-
-func (s *Service) readPump(client *Client) {
-	defer func() {
-		s.mu.Lock()
-		delete(s.clients, client.userID)
-		s.mu.Unlock()
-		client.conn.Close()
-		activeConnections.Dec()
-	}()
+	sess.writeFrame(serverFrame{Type: "hello", Proto: wsSubprotocol, Topics: topics})
 
-	client.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	client.conn.SetPongHandler(func(string) error {
-		client.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		return nil
-	})
-
-	for {
-		_, _, err := client.conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
-			}
-			break
-		}
+	if since, ok := parseSince(r); ok {
+		s.replayTopics(sess, topics, since)
 	}
-}
-
-func (s *Service) writePump(client *Client) {
-	ticker := time.NewTicker(30 * time.Second)
-	defer func() {
-		ticker.Stop()
-		client.conn.Close()
-	}()
 
-	for {
-		select {
-		case message, ok := <-client.send:
-			client.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				client.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
+	s.runWSSession(sess)
+}
 
-			if err := client.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				return
-			}
+// sendToClient publishes notification onto the recipient's topic; whether
+// anyone is subscribed right now is the bus's concern, not this handler's.
+func (s *Service) sendToClient(userID string, notification Notification) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
 
-		case <-ticker.C:
-			client.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				return
-			}
-		}
+	envelope := map[string]interface{}{
+		"type":         "notification",
+		"notification": notification,
 	}
-}
 
-func (s *Service) sendToClient(userID string, notification Notification) {
-	s.mu.RLock()
-	client, exists := s.clients[userID]
-	s.mu.RUnlock()
-
-	if exists {
-		message, _ := json.Marshal(map[string]interface{}{
-			"type":         "notification",
-			"notification": notification,
-		})
-
-		select {
-		case client.send <- message:
-		default:
-			log.Printf("Client %s send buffer full", userID)
-		}
+	if _, err := s.bus.Publish(ctx, notificationTopic(userID), envelope); err != nil {
+		log.Printf("Error publishing notification for %s: %v", userID, err)
 	}
 }
 
@@ -490,8 +539,10 @@ func (s *Service) postActivity(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Log for debugging and Grafana/Loki
-	log.Printf("[ACTIVITY] source=%s action=%s details=%s user=%s device=%s severity=%s",
-		event.Source, event.Action, event.Details, event.UserID, event.DeviceID, event.Severity)
+	principal, _ := r.Context().Value("principal").(string)
+	clientIP, _ := r.Context().Value("client_ip").(string)
+	log.Printf("[ACTIVITY] source=%s action=%s details=%s user=%s device=%s severity=%s principal=%s ip=%s",
+		event.Source, event.Action, event.Details, event.UserID, event.DeviceID, event.Severity, principal, clientIP)
 
 	// Store in Redis for recent activity history
 	ctx := context.Background()
@@ -518,109 +569,80 @@ func (s *Service) postActivity(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// broadcastActivity sends activity event to all connected clients (or specific user)
+// activityTopics returns the bus topics an activity event fans out to: a
+// global firehose plus per-user/per-device/per-severity/per-source topics
+// so a client can subscribe to just the slice it cares about.
+func activityTopics(event ActivityEvent) []string {
+	topics := []string{
+		"activity:all",
+		fmt.Sprintf("activity:severity:%s", event.Severity),
+		fmt.Sprintf("activity:source:%s", event.Source),
+	}
+	if event.UserID != "" {
+		topics = append(topics, fmt.Sprintf("activity:user:%s", event.UserID))
+	}
+	if event.DeviceID != "" {
+		topics = append(topics, fmt.Sprintf("activity:device:%s", event.DeviceID))
+	}
+	return topics
+}
+
+// broadcastActivity publishes event onto every topic it matches.
 func (s *Service) broadcastActivity(event ActivityEvent) {
-	s.activityMu.RLock()
-	defer s.activityMu.RUnlock()
-
-	// Send the event directly, not wrapped
-	message, _ := json.Marshal(event)
-
-	// Broadcast to matching user or all if no user specified
-	for userID, client := range s.activityClients {
-		if event.UserID == "" || event.UserID == userID {
-			select {
-			case client.send <- message:
-				activityEventsBroadcast.Inc()
-			default:
-				log.Printf("Activity client %s send buffer full", userID)
-			}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	for _, topic := range activityTopics(event) {
+		if _, err := s.bus.Publish(ctx, topic, event); err != nil {
+			log.Printf("Error publishing activity event to %s: %v", topic, err)
+			continue
 		}
+		activityEventsBroadcast.Inc()
 	}
 }
 
-// handleActivityWebSocket handles WebSocket connections for activity stream
+// handleActivityWebSocket upgrades to a homeguard.v1 session subscribed by
+// default to the global activity firehose plus the path's user_id topic
+// (when one other than "all" is given); subscribe/unsubscribe frames can
+// narrow that to just a device or severity afterward.
 func (s *Service) handleActivityWebSocket(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["user_id"]
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	if atomic.LoadInt32(&s.shuttingDown) == 1 {
+		http.Error(w, "service is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	if !negotiateSubprotocol(r) {
+		http.Error(w, fmt.Sprintf("missing or unsupported Sec-WebSocket-Protocol, expected %s", wsSubprotocol), http.StatusBadRequest)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Activity WebSocket upgrade error: %v", err)
 		return
 	}
 
-	client := &ActivityClient{
-		conn:   conn,
-		userID: userID,
-		send:   make(chan []byte, 256),
+	defaultTopics := []string{"activity:all"}
+	if userID != "" && userID != "all" {
+		defaultTopics = append(defaultTopics, fmt.Sprintf("activity:user:%s", userID))
 	}
 
-	s.activityMu.Lock()
-	s.activityClients[userID] = client
-	s.activityMu.Unlock()
-
+	listenerID := uuid.New().String()
+	sess := newWSSession(conn, listenerID, fmt.Sprintf("activity:%s", userID), activityConnections, s.config.WSMaxMessageSize, s.config.WSOverflowPolicy)
+	topics := s.applySubscription(sess, defaultTopics, nil)
 	activityConnections.Inc()
 	log.Printf("Activity client connected: %s", userID)
 
-	go s.activityWritePump(client)
-	s.activityReadPump(client)
-}
-
-func (s *Service) activityReadPump(client *ActivityClient) {
-	defer func() {
-		s.activityMu.Lock()
-		delete(s.activityClients, client.userID)
-		s.activityMu.Unlock()
-		client.conn.Close()
-		activityConnections.Dec()
-		log.Printf("Activity client disconnected: %s", client.userID)
-	}()
+	sess.writeFrame(serverFrame{Type: "hello", Proto: wsSubprotocol, Topics: topics})
 
-	client.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	client.conn.SetPongHandler(func(string) error {
-		client.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		return nil
-	})
-
-	for {
-		_, _, err := client.conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("Activity WebSocket error: %v", err)
-			}
-			break
-		}
+	if since, ok := parseSince(r); ok {
+		s.replayTopics(sess, topics, since)
 	}
-}
-
-func (s *Service) activityWritePump(client *ActivityClient) {
-	ticker := time.NewTicker(30 * time.Second)
-	defer func() {
-		ticker.Stop()
-		client.conn.Close()
-	}()
-
-	for {
-		select {
-		case message, ok := <-client.send:
-			client.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				client.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
 
-			if err := client.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				return
-			}
-
-		case <-ticker.C:
-			client.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				return
-			}
-		}
-	}
+	s.runWSSession(sess)
 }
 
 // getRecentActivity returns recent activity events from Redis
@@ -659,7 +681,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to create service: %v", err)
 	}
-	defer service.redis.Close()
+	service.Start()
 
 	service.SetupRoutes()
 
@@ -683,6 +705,8 @@ func main() {
 		if err := server.Shutdown(ctx); err != nil {
 			log.Printf("Server shutdown error: %v", err)
 		}
+
+		service.Shutdown(ctx)
 	}()
 
 	log.Printf("Notification Service listening on port %s", config.Port)
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// retryAfterSeconds is the value sent in the Retry-After header when a
+// request is rejected for exceeding its token bucket.
+const retryAfterSeconds = 1
+
+// RateLimiter hands out a token-bucket limiter per key (a client IP or an
+// authenticated principal), lazily creating one on first use and sharing it
+// across requests for that key afterward.
+type RateLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	r        rate.Limit
+	b        int
+}
+
+// NewRateLimiter creates a limiter allowing r requests/sec with burst b for
+// each distinct key.
+func NewRateLimiter(r rate.Limit, b int) *RateLimiter {
+	return &RateLimiter{
+		limiters: make(map[string]*rate.Limiter),
+		r:        r,
+		b:        b,
+	}
+}
+
+// GetLimiter returns key's limiter, creating it on first use.
+func (rl *RateLimiter) GetLimiter(key string) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	limiter, ok := rl.limiters[key]
+	if !ok {
+		limiter = rate.NewLimiter(rl.r, rl.b)
+		rl.limiters[key] = limiter
+	}
+	return limiter
+}
+
+// ingressRateLimitMiddleware enforces a token bucket per client IP and,
+// once authMiddleware has resolved one, per authenticated principal — both
+// must allow the request through. Run it after authMiddleware so the
+// context values it keys off are already populated.
+func (s *Service) ingressRateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientIP, _ := r.Context().Value("client_ip").(string)
+		if clientIP == "" {
+			clientIP = r.RemoteAddr
+		}
+		if !s.ipRateLimiter.GetLimiter(clientIP).Allow() {
+			s.tooManyRequests(w)
+			return
+		}
+
+		principal, _ := r.Context().Value("principal").(string)
+		if principal != "" && !s.userRateLimiter.GetLimiter(principal).Allow() {
+			s.tooManyRequests(w)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *Service) tooManyRequests(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+	s.errorResponse(w, http.StatusTooManyRequests, "Rate limit exceeded")
+}
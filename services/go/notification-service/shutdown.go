@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Shutdown stops accepting new WebSocket upgrades, asks every connected
+// client to close with code 1001, waits up to ctx's deadline for their
+// pumps to drain, cancels the bus's cross-instance subscriber, and finally
+// closes Redis. Call it after server.Shutdown(ctx) returns so in-flight
+// HTTP requests have already finished.
+func (s *Service) Shutdown(ctx context.Context) {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+
+	s.sessionsMu.Lock()
+	sessions := make([]*wsSession, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.sessionsMu.Unlock()
+
+	closeDeadline := time.Now().Add(5 * time.Second)
+	for _, sess := range sessions {
+		closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+		if err := sess.conn.WriteControl(websocket.CloseMessage, closeMsg, closeDeadline); err != nil {
+			log.Printf("Error sending close frame to %s: %v", sess.label, err)
+		}
+	}
+
+	var drained int32
+	var wg sync.WaitGroup
+	for _, sess := range sessions {
+		wg.Add(1)
+		go func(sess *wsSession) {
+			defer wg.Done()
+			select {
+			case <-sess.done:
+				atomic.AddInt32(&drained, 1)
+			case <-ctx.Done():
+			}
+		}(sess)
+	}
+	wg.Wait()
+
+	if s.busCancel != nil {
+		s.busCancel()
+	}
+
+	if err := s.redis.Close(); err != nil {
+		log.Printf("Error closing Redis: %v", err)
+	}
+
+	log.Printf("Shutdown drained %d/%d WebSocket connections", drained, len(sessions))
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fanoutChannel is the single Redis Pub/Sub channel every instance
+// publishes cross-instance deliveries onto and subscribes to, so the bus
+// stays safe to run behind a Deployment with N replicas instead of only
+// fanning out to whichever instance a client happened to land on.
+const fanoutChannel = "bus:fanout"
+
+// subscriberBufferSize bounds how many undelivered messages a subscriber's
+// channel can hold before the overflow policy kicks in.
+const subscriberBufferSize = 256
+
+// Overflow policies applied once a subscriber's channel is full.
+const (
+	OverflowDropOldest = "drop_oldest"
+	OverflowDropNewest = "drop_newest"
+	OverflowDisconnect = "disconnect"
+)
+
+// fanoutEnvelope wraps a Message with the publishing instance's node ID so
+// every other instance can tell a message it sees on the shared channel was
+// its own and skip re-delivering it locally.
+type fanoutEnvelope struct {
+	NodeID string  `json:"node_id"`
+	Msg    Message `json:"msg"`
+}
+
+var (
+	crossInstanceReceived = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "notification_service_cross_instance_received_total",
+			Help: "Total number of bus messages received from other instances over the Redis fanout channel",
+		},
+	)
+	crossInstanceDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_service_cross_instance_dropped_total",
+			Help: "Total number of cross-instance bus messages dropped without being delivered locally",
+		},
+		[]string{"reason"},
+	)
+	sendChannelDepth = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "notification_service_send_channel_depth",
+			Help:    "Depth of a subscriber's send channel observed at delivery time",
+			Buckets: prometheus.LinearBuckets(0, 32, 9),
+		},
+	)
+	droppedMessages = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_service_dropped_messages_total",
+			Help: "Total number of messages dropped because a subscriber's send channel was full, by overflow policy",
+		},
+		[]string{"policy"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(crossInstanceReceived)
+	prometheus.MustRegister(crossInstanceDropped)
+	prometheus.MustRegister(sendChannelDepth)
+	prometheus.MustRegister(droppedMessages)
+}
+
+// Message is a single event on the bus: a topic, a monotonically increasing
+// sequence number (so a reconnecting subscriber can ask for everything
+// since the last one it saw), and the raw event payload.
+type Message struct {
+	Seq   uint64          `json:"seq"`
+	Topic string          `json:"topic"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// busSubscriber is one listener's view onto the bus: the set of topics it
+// cares about, the channel events matching any of them land on, and what to
+// do if it can't keep up.
+type busSubscriber struct {
+	id     string
+	topics map[string]bool
+	ch     chan Message
+	policy string
+
+	disconnect     chan struct{}
+	disconnectOnce sync.Once
+}
+
+// Subscription is what Subscribe hands back to a listener: the channel
+// matching messages arrive on, and a signal channel the bus closes if the
+// subscriber overflows under the "disconnect" policy.
+type Subscription struct {
+	Ch         <-chan Message
+	Disconnect <-chan struct{}
+}
+
+// TopicBus is a general pub/sub fanout keyed by topic string (e.g.
+// "user:42", "device:17", "severity:alert") instead of the single user_id
+// the old clients/activityClients maps were keyed on. Published messages
+// are also appended to a bounded Redis stream per topic with a configurable
+// TTL, so a reconnecting client can replay what it missed via Replay.
+type TopicBus struct {
+	mu          sync.RWMutex
+	subscribers map[string]*busSubscriber
+	seq         uint64
+
+	redis      *redis.Client
+	streamTTL  time.Duration
+	streamSize int64
+
+	nodeID string
+}
+
+// NewTopicBus creates a bus backed by redisClient. streamTTL is refreshed on
+// every publish to a topic's stream; streamSize bounds how many messages
+// per topic are retained for replay. Call Start once the bus is wired into
+// a Service to begin receiving cross-instance deliveries.
+func NewTopicBus(redisClient *redis.Client, streamTTL time.Duration, streamSize int64) *TopicBus {
+	return &TopicBus{
+		subscribers: make(map[string]*busSubscriber),
+		redis:       redisClient,
+		streamTTL:   streamTTL,
+		streamSize:  streamSize,
+		nodeID:      uuid.New().String(),
+	}
+}
+
+// Start subscribes to the cross-instance fanout channel so events published
+// by other replicas of this service reach this instance's locally-connected
+// WebSocket clients too. It returns once the subscription is established;
+// delivery happens in a background goroutine until ctx is canceled.
+func (b *TopicBus) Start(ctx context.Context) {
+	pubsub := b.redis.Subscribe(ctx, fanoutChannel)
+	go b.consumeFanout(ctx, pubsub)
+}
+
+func (b *TopicBus) consumeFanout(ctx context.Context, pubsub *redis.PubSub) {
+	defer pubsub.Close()
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case redisMsg, ok := <-ch:
+			if !ok {
+				return
+			}
+			b.handleFanoutMessage(redisMsg.Payload)
+		}
+	}
+}
+
+func (b *TopicBus) handleFanoutMessage(payload string) {
+	var envelope fanoutEnvelope
+	if err := json.Unmarshal([]byte(payload), &envelope); err != nil {
+		crossInstanceDropped.WithLabelValues("decode_error").Inc()
+		return
+	}
+	if envelope.NodeID == b.nodeID {
+		return // self-echo: we already fanned this out locally when we published it
+	}
+
+	crossInstanceReceived.Inc()
+	if b.localFanout(envelope.Msg.Topic, envelope.Msg) == 0 {
+		crossInstanceDropped.WithLabelValues("no_local_subscriber").Inc()
+	}
+}
+
+// Subscribe registers listenerID for the given topics and returns the
+// Subscription it will receive matching messages on. policy controls what
+// happens once its channel fills up (see OverflowDropOldest/DropNewest/
+// Disconnect); an empty policy defaults to OverflowDropNewest. A second
+// Subscribe call for the same listenerID replaces its topic set and channel
+// — callers that resubscribe a live connection to a new topic set (rather
+// than reconnecting from scratch) are expected to switch over to the new
+// channel themselves; the old one is simply abandoned rather than closed,
+// since a session still mid-select on it must be able to tell "topics
+// changed" apart from "this connection is done" without racing a spurious
+// close.
+func (b *TopicBus) Subscribe(listenerID string, topics []string, policy string) Subscription {
+	if policy == "" {
+		policy = OverflowDropNewest
+	}
+
+	sub := &busSubscriber{
+		id:         listenerID,
+		topics:     make(map[string]bool, len(topics)),
+		ch:         make(chan Message, subscriberBufferSize),
+		policy:     policy,
+		disconnect: make(chan struct{}),
+	}
+	for _, t := range topics {
+		sub.topics[t] = true
+	}
+
+	b.mu.Lock()
+	b.subscribers[listenerID] = sub
+	b.mu.Unlock()
+
+	return Subscription{Ch: sub.ch, Disconnect: sub.disconnect}
+}
+
+// Unsubscribe removes listenerID from the bus and closes its channel.
+func (b *TopicBus) Unsubscribe(listenerID string) {
+	b.mu.Lock()
+	sub, ok := b.subscribers[listenerID]
+	if ok {
+		delete(b.subscribers, listenerID)
+	}
+	b.mu.Unlock()
+
+	if ok {
+		close(sub.ch)
+	}
+}
+
+// streamKey returns the Redis key a topic's bounded replay stream lives
+// under.
+func streamKey(topic string) string {
+	return fmt.Sprintf("bus:stream:%s", topic)
+}
+
+// Publish fans data out to every local subscriber of topic, appends it to
+// that topic's bounded Redis stream for replay, and broadcasts it to other
+// instances over the fanout channel, stamping it with the next sequence
+// number.
+func (b *TopicBus) Publish(ctx context.Context, topic string, data interface{}) (uint64, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+
+	seq := atomic.AddUint64(&b.seq, 1)
+	msg := Message{Seq: seq, Topic: topic, Data: payload}
+
+	if err := b.appendToStream(ctx, topic, msg); err != nil {
+		log.Printf("Error appending to bus stream %s: %v", topic, err)
+	}
+
+	b.localFanout(topic, msg)
+	b.publishCrossInstance(ctx, msg)
+
+	return seq, nil
+}
+
+// localFanout delivers msg to every subscriber of topic on this instance
+// and reports how many received it.
+func (b *TopicBus) localFanout(topic string, msg Message) int {
+	delivered := 0
+	b.mu.RLock()
+	for _, sub := range b.subscribers {
+		if !sub.topics[topic] {
+			continue
+		}
+		if deliverToSubscriber(sub, msg) {
+			delivered++
+		}
+	}
+	b.mu.RUnlock()
+	return delivered
+}
+
+// deliverToSubscriber sends msg to sub's channel, applying sub's overflow
+// policy if the channel is already full.
+func deliverToSubscriber(sub *busSubscriber, msg Message) bool {
+	select {
+	case sub.ch <- msg:
+		sendChannelDepth.Observe(float64(len(sub.ch)))
+		return true
+	default:
+	}
+
+	switch sub.policy {
+	case OverflowDropOldest:
+		select {
+		case <-sub.ch:
+		default:
+		}
+		select {
+		case sub.ch <- msg:
+			sendChannelDepth.Observe(float64(len(sub.ch)))
+			return true
+		default:
+		}
+		droppedMessages.WithLabelValues(OverflowDropOldest).Inc()
+		return false
+
+	case OverflowDisconnect:
+		droppedMessages.WithLabelValues(OverflowDisconnect).Inc()
+		sub.disconnectOnce.Do(func() { close(sub.disconnect) })
+		return false
+
+	default:
+		droppedMessages.WithLabelValues(OverflowDropNewest).Inc()
+		log.Printf("Subscriber %s topic %s buffer full, dropping message", sub.id, msg.Topic)
+		return false
+	}
+}
+
+func (b *TopicBus) publishCrossInstance(ctx context.Context, msg Message) {
+	encoded, err := json.Marshal(fanoutEnvelope{NodeID: b.nodeID, Msg: msg})
+	if err != nil {
+		log.Printf("Error encoding cross-instance fanout envelope: %v", err)
+		return
+	}
+	if err := b.redis.Publish(ctx, fanoutChannel, encoded).Err(); err != nil {
+		log.Printf("Error publishing cross-instance fanout: %v", err)
+	}
+}
+
+func (b *TopicBus) appendToStream(ctx context.Context, topic string, msg Message) error {
+	encoded, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	key := streamKey(topic)
+	if err := b.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: b.streamSize,
+		Approx: true,
+		Values: map[string]interface{}{"payload": string(encoded)},
+	}).Err(); err != nil {
+		return err
+	}
+
+	return b.redis.Expire(ctx, key, b.streamTTL).Err()
+}
+
+// Replay returns every message published to topic since sequence number
+// since, in ascending sequence order, from the topic's bounded stream.
+func (b *TopicBus) Replay(ctx context.Context, topic string, since uint64) ([]Message, error) {
+	entries, err := b.redis.XRange(ctx, streamKey(topic), "-", "+").Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	var messages []Message
+	for _, entry := range entries {
+		raw, ok := entry.Values["payload"].(string)
+		if !ok {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			continue
+		}
+		if msg.Seq > since {
+			messages = append(messages, msg)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Seq < messages[j].Seq })
+	return messages, nil
+}
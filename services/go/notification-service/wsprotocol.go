@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// wsSubprotocol is the only WebSocket subprotocol this version of the
+// service speaks. Bumping the protocol (homeguard.v2, ...) means adding a
+// new subprotocol rather than changing the frame shapes underneath this
+// one, so existing clients keep working unmodified.
+const wsSubprotocol = "homeguard.v1"
+
+// Connection timing, matching the usual Gorilla chat-example defaults:
+// writes must complete within wsWriteWait, a client is considered dead if no
+// pong arrives within wsPongWait, and pings go out often enough (comfortably
+// inside that window) to keep it alive.
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = (wsPongWait * 9) / 10
+)
+
+// clientFrame is a message sent by the client over the subprotocol: a
+// dynamic subscribe/unsubscribe, an ack of a delivered event, or a resume
+// request after a reconnect.
+type clientFrame struct {
+	Op      string   `json:"op"`
+	Topics  []string `json:"topics,omitempty"`
+	ID      uint64   `json:"id,omitempty"`
+	LastSeq uint64   `json:"last_seq,omitempty"`
+}
+
+// serverFrame is a typed message sent to the client: "hello" on connect,
+// "event" for a bus delivery, "ack" acknowledging a subscribe/unsubscribe,
+// or "error" when a frame couldn't be handled.
+type serverFrame struct {
+	Type    string          `json:"type"`
+	Proto   string          `json:"proto,omitempty"`
+	Op      string          `json:"op,omitempty"`
+	Topics  []string        `json:"topics,omitempty"`
+	Topic   string          `json:"topic,omitempty"`
+	Seq     uint64          `json:"seq,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+var (
+	wsFramesReceived = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_service_ws_frames_received_total",
+			Help: "Total number of client WebSocket frames received, by op",
+		},
+		[]string{"op"},
+	)
+	wsFrameErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "notification_service_ws_frame_errors_total",
+			Help: "Total number of client WebSocket frames that failed to parse or handle",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(wsFramesReceived)
+	prometheus.MustRegister(wsFrameErrors)
+}
+
+// negotiateSubprotocol reports whether the request offered wsSubprotocol in
+// its Sec-WebSocket-Protocol header.
+func negotiateSubprotocol(r *http.Request) bool {
+	for _, p := range websocket.Subprotocols(r) {
+		if p == wsSubprotocol {
+			return true
+		}
+	}
+	return false
+}
+
+// wsSession is one negotiated homeguard.v1 connection: a set of topics it is
+// currently subscribed to on the bus and the channel currently delivering
+// them. Topics can change over the session's lifetime via subscribe/
+// unsubscribe frames, so the channel is swapped out rather than fixed at
+// connect time.
+type wsSession struct {
+	conn           *websocket.Conn
+	listenerID     string
+	label          string
+	gauge          prometheus.Gauge
+	maxMessageSize int64
+	overflowPolicy string
+
+	mu         sync.Mutex
+	topics     map[string]bool
+	ch         <-chan Message
+	disconnect <-chan struct{}
+
+	resubscribe chan struct{}
+	done        chan struct{}
+}
+
+func newWSSession(conn *websocket.Conn, listenerID, label string, gauge prometheus.Gauge, maxMessageSize int64, overflowPolicy string) *wsSession {
+	return &wsSession{
+		conn:           conn,
+		listenerID:     listenerID,
+		label:          label,
+		gauge:          gauge,
+		maxMessageSize: maxMessageSize,
+		overflowPolicy: overflowPolicy,
+		topics:         make(map[string]bool),
+		resubscribe:    make(chan struct{}, 1),
+		done:           make(chan struct{}),
+	}
+}
+
+func (sess *wsSession) channel() <-chan Message {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.ch
+}
+
+func (sess *wsSession) disconnectChannel() <-chan struct{} {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.disconnect
+}
+
+func (sess *wsSession) topicList() []string {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	topics := make([]string, 0, len(sess.topics))
+	for t := range sess.topics {
+		topics = append(topics, t)
+	}
+	return topics
+}
+
+func (sess *wsSession) writeFrame(frame serverFrame) error {
+	sess.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return sess.conn.WriteJSON(frame)
+}
+
+// applySubscription merges add/remove into the session's topic set, asks
+// the bus for a channel matching the new set, and wakes the write pump so
+// it starts reading from it. It returns the resulting topic list.
+func (s *Service) applySubscription(sess *wsSession, add, remove []string) []string {
+	sess.mu.Lock()
+	for _, t := range add {
+		sess.topics[t] = true
+	}
+	for _, t := range remove {
+		delete(sess.topics, t)
+	}
+	topics := make([]string, 0, len(sess.topics))
+	for t := range sess.topics {
+		topics = append(topics, t)
+	}
+	sess.mu.Unlock()
+
+	sub := s.bus.Subscribe(sess.listenerID, topics, sess.overflowPolicy)
+
+	sess.mu.Lock()
+	sess.ch = sub.Ch
+	sess.disconnect = sub.Disconnect
+	sess.mu.Unlock()
+
+	select {
+	case sess.resubscribe <- struct{}{}:
+	default:
+	}
+
+	return topics
+}
+
+// replayTopics sends everything published since sequence number since on
+// any of topics, so a client that just subscribed or sent a resume frame
+// catches up on what it missed.
+func (s *Service) replayTopics(sess *wsSession, topics []string, since uint64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, topic := range topics {
+		messages, err := s.bus.Replay(ctx, topic, since)
+		if err != nil {
+			log.Printf("Error replaying %s for %s: %v", topic, sess.label, err)
+			continue
+		}
+		for _, msg := range messages {
+			if err := sess.writeFrame(serverFrame{Type: "event", Topic: msg.Topic, Seq: msg.Seq, Data: msg.Data}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// runWSSession drives a negotiated homeguard.v1 connection: a write pump
+// delivering bus events and pings, and a read loop parsing client frames,
+// until the connection closes.
+func (s *Service) runWSSession(sess *wsSession) {
+	s.registerSession(sess)
+	defer func() {
+		s.unregisterSession(sess)
+		close(sess.done)
+		s.bus.Unsubscribe(sess.listenerID)
+		sess.conn.Close()
+		sess.gauge.Dec()
+	}()
+
+	go s.wsWritePump(sess)
+	s.wsReadPump(sess)
+}
+
+func (s *Service) wsWritePump(sess *wsSession) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		ch := sess.channel()
+		select {
+		case <-sess.done:
+			return
+		case <-sess.disconnectChannel():
+			log.Printf("Disconnecting %s: send buffer overflow", sess.label)
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				// The bus subscription was replaced (a subscribe/unsubscribe
+				// frame changed the topic set) rather than the connection
+				// closing; loop back and pick up the fresh channel.
+				continue
+			}
+			if err := sess.writeFrame(serverFrame{Type: "event", Topic: msg.Topic, Seq: msg.Seq, Data: msg.Data}); err != nil {
+				return
+			}
+		case <-sess.resubscribe:
+			continue
+		case <-ticker.C:
+			sess.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := sess.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Service) wsReadPump(sess *wsSession) {
+	sess.conn.SetReadLimit(sess.maxMessageSize)
+	sess.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	sess.conn.SetPongHandler(func(string) error {
+		sess.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		return nil
+	})
+
+	for {
+		_, raw, err := sess.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error on %s: %v", sess.label, err)
+			}
+			return
+		}
+		s.handleClientFrame(sess, raw)
+	}
+}
+
+func (s *Service) handleClientFrame(sess *wsSession, raw []byte) {
+	var frame clientFrame
+	if err := json.Unmarshal(raw, &frame); err != nil {
+		wsFrameErrors.Inc()
+		sess.writeFrame(serverFrame{Type: "error", Message: "invalid frame: " + err.Error()})
+		return
+	}
+
+	wsFramesReceived.WithLabelValues(frame.Op).Inc()
+
+	switch frame.Op {
+	case "subscribe":
+		topics := s.applySubscription(sess, frame.Topics, nil)
+		sess.writeFrame(serverFrame{Type: "ack", Op: "subscribe", Topics: topics})
+
+	case "unsubscribe":
+		topics := s.applySubscription(sess, nil, frame.Topics)
+		sess.writeFrame(serverFrame{Type: "ack", Op: "unsubscribe", Topics: topics})
+
+	case "ack":
+		// Client-side delivery acknowledgment; at-least-once delivery and
+		// dedup are handled client-side against the event seq, so there is
+		// nothing further to reconcile server-side.
+
+	case "resume":
+		s.replayTopics(sess, sess.topicList(), frame.LastSeq)
+		sess.writeFrame(serverFrame{Type: "ack", Op: "resume", Seq: frame.LastSeq})
+
+	default:
+		wsFrameErrors.Inc()
+		sess.writeFrame(serverFrame{Type: "error", Message: fmt.Sprintf("unknown op: %q", frame.Op)})
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// starterRegistryPublicKey is the base64 Ed25519 public key that signs the
+// in-tree starter templates below. It's the default for HUB_TRUSTED_KEYS so
+// the starter registry verifies out of the box; deployments that configure
+// their own hub index should set HUB_TRUSTED_KEYS to their own key(s)
+// instead (or in addition, comma-separated).
+const starterRegistryPublicKey = "+/mcEO96hY/6BYkVdTIGq4Q3AbHUTs5FwyHXvL6bH4Y="
+
+// TemplateVariable documents one placeholder a Template's scenario body
+// references (e.g. `{{ .device_id }}`). Type controls how materializeTemplate
+// treats the substituted value: "string" (the default) JSON-escapes it for
+// the placeholder's surrounding quotes; "number" requires it to already be a
+// bare JSON number, since those placeholders sit outside any quotes.
+type TemplateVariable struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Type        string `json:"type,omitempty"`
+}
+
+// Template is a signed, importable scenario blueprint, borrowed from
+// crowdsec's hub model: a versioned document with placeholder variables that
+// POST /scenarios/{user_id}/from_template fills in to materialize a concrete
+// Scenario. Scenario is Go text/template source rather than raw JSON, since
+// its placeholders (e.g. `{{ .threshold_seconds }}`) aren't valid JSON until
+// substituted.
+type Template struct {
+	SchemaVersion        int                `json:"schema_version"`
+	ID                   string             `json:"id"`
+	Version              string             `json:"version"`
+	Author               string             `json:"author,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Tags                 []string           `json:"tags,omitempty"`
+	RequiredCapabilities []string           `json:"required_capabilities,omitempty"`
+	Variables            []TemplateVariable `json:"variables,omitempty"`
+	Scenario             string             `json:"scenario"`
+	// Signature is a base64 Ed25519 signature over the JSON encoding of
+	// every field above, computed with Signature itself absent (see
+	// templateSigningPayload).
+	Signature string `json:"signature"`
+}
+
+// signableTemplate mirrors Template minus Signature - the exact bytes an
+// Ed25519 signature is computed over.
+type signableTemplate struct {
+	SchemaVersion        int                `json:"schema_version"`
+	ID                   string             `json:"id"`
+	Version              string             `json:"version"`
+	Author               string             `json:"author,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Tags                 []string           `json:"tags,omitempty"`
+	RequiredCapabilities []string           `json:"required_capabilities,omitempty"`
+	Variables            []TemplateVariable `json:"variables,omitempty"`
+	Scenario             string             `json:"scenario"`
+}
+
+// templateSigningPayload returns the bytes a Template's signature is
+// computed over: the JSON encoding of every field except Signature.
+func templateSigningPayload(tpl Template) ([]byte, error) {
+	return json.Marshal(signableTemplate{
+		SchemaVersion:        tpl.SchemaVersion,
+		ID:                   tpl.ID,
+		Version:              tpl.Version,
+		Author:               tpl.Author,
+		Description:          tpl.Description,
+		Tags:                 tpl.Tags,
+		RequiredCapabilities: tpl.RequiredCapabilities,
+		Variables:            tpl.Variables,
+		Scenario:             tpl.Scenario,
+	})
+}
+
+// verifyTemplateSignature reports whether tpl's signature validates against
+// any of trustedKeys.
+func verifyTemplateSignature(tpl Template, trustedKeys []ed25519.PublicKey) bool {
+	sig, err := base64.StdEncoding.DecodeString(tpl.Signature)
+	if err != nil {
+		return false
+	}
+
+	payload, err := templateSigningPayload(tpl)
+	if err != nil {
+		return false
+	}
+
+	for _, key := range trustedKeys {
+		if ed25519.Verify(key, payload, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedKeys parses a comma-separated list of base64 Ed25519 public
+// keys, as configured via HUB_TRUSTED_KEYS. Malformed entries are logged and
+// skipped rather than failing startup.
+func parseTrustedKeys(raw string) []ed25519.PublicKey {
+	var keys []ed25519.PublicKey
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(part)
+		if err != nil || len(decoded) != ed25519.PublicKeySize {
+			log.Printf("Skipping invalid hub trusted key: %v", err)
+			continue
+		}
+		keys = append(keys, ed25519.PublicKey(decoded))
+	}
+	return keys
+}
+
+const hubIndexCacheKey = "hub:templates"
+
+// fetchTemplateIndex returns the hub's template list, preferring a cached
+// copy of the configured Git-backed index and falling back to the in-tree
+// starter registry when no index is configured or the cache is cold.
+func (s *Service) fetchTemplateIndex(ctx context.Context) ([]Template, error) {
+	if cached, err := s.redis.Get(ctx, hubIndexCacheKey).Result(); err == nil {
+		var templates []Template
+		if err := json.Unmarshal([]byte(cached), &templates); err == nil {
+			return templates, nil
+		}
+	}
+
+	if s.config.HubIndexURL == "" {
+		return starterTemplates, nil
+	}
+
+	templates, err := s.fetchRemoteTemplateIndex(ctx)
+	if err != nil {
+		log.Printf("Failed to fetch hub index, falling back to starter registry: %v", err)
+		return starterTemplates, nil
+	}
+
+	if data, err := json.Marshal(templates); err == nil {
+		s.redis.Set(ctx, hubIndexCacheKey, data, 10*time.Minute)
+	}
+	return templates, nil
+}
+
+func (s *Service) fetchRemoteTemplateIndex(ctx context.Context) ([]Template, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.config.HubIndexURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("hub index request to %s failed with status %d", s.config.HubIndexURL, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []Template
+	if err := json.Unmarshal(body, &templates); err != nil {
+		return nil, fmt.Errorf("invalid hub index: %w", err)
+	}
+	return templates, nil
+}
+
+// numericLiteral matches a bare JSON number, used to validate "number"-typed
+// template variables that are substituted outside any quotes.
+var numericLiteral = regexp.MustCompile(`^-?(0|[1-9]\d*)(\.\d+)?$`)
+
+// materializeTemplate substitutes variables into tpl's scenario template and
+// decodes the result into a Scenario. Missing required variables are an
+// error; missing optional variables fall back to their declared default.
+//
+// tpl.Scenario is trusted template source (it only reaches here after
+// verifyTemplateSignature), but variables comes straight from the caller, so
+// each value is made safe for the JSON context its placeholder sits in
+// before substitution: string variables are JSON-escaped (the template
+// supplies the surrounding quotes), and number variables must already be a
+// bare JSON number, since their placeholders have no quotes to escape into.
+// Either way, a value can't introduce JSON the declared variables didn't
+// already make room for - e.g. a stray `"` or `}` ends up as inert literal
+// content instead of closing a string or object early.
+func materializeTemplate(tpl Template, variables map[string]string) (Scenario, error) {
+	values := make(map[string]string, len(tpl.Variables))
+	for _, v := range tpl.Variables {
+		value, ok := variables[v.Name]
+		if !ok || value == "" {
+			if v.Required {
+				return Scenario{}, fmt.Errorf("missing required variable %q", v.Name)
+			}
+			value = v.Default
+		}
+
+		switch v.Type {
+		case "number":
+			if !numericLiteral.MatchString(value) {
+				return Scenario{}, fmt.Errorf("variable %q must be a number", v.Name)
+			}
+			values[v.Name] = value
+		default:
+			escaped, err := json.Marshal(value)
+			if err != nil {
+				return Scenario{}, fmt.Errorf("variable %q is not valid: %w", v.Name, err)
+			}
+			values[v.Name] = string(escaped[1 : len(escaped)-1])
+		}
+	}
+
+	tmpl, err := template.New(tpl.ID).Parse(tpl.Scenario)
+	if err != nil {
+		return Scenario{}, fmt.Errorf("invalid template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return Scenario{}, fmt.Errorf("failed to render template: %w", err)
+	}
+
+	var scenario Scenario
+	if err := json.Unmarshal(buf.Bytes(), &scenario); err != nil {
+		return Scenario{}, fmt.Errorf("rendered template is not a valid scenario: %w", err)
+	}
+	return scenario, nil
+}
+
+func (s *Service) listHubTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := s.fetchTemplateIndex(r.Context())
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to load hub templates")
+		return
+	}
+	s.jsonResponse(w, http.StatusOK, templates)
+}
+
+func (s *Service) getHubTemplate(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	templates, err := s.fetchTemplateIndex(r.Context())
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to load hub templates")
+		return
+	}
+
+	for _, tpl := range templates {
+		if tpl.ID == id {
+			s.jsonResponse(w, http.StatusOK, tpl)
+			return
+		}
+	}
+
+	s.errorResponse(w, http.StatusNotFound, "Template not found")
+}
+
+// createScenarioFromTemplate materializes template_id with the given
+// variables into a new Scenario for user_id, after verifying the template's
+// signature against the configured trusted keys.
+func (s *Service) createScenarioFromTemplate(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	var req struct {
+		TemplateID string            `json:"template_id"`
+		Variables  map[string]string `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.TemplateID == "" {
+		s.errorResponse(w, http.StatusBadRequest, "template_id is required")
+		return
+	}
+
+	templates, err := s.fetchTemplateIndex(r.Context())
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to load hub templates")
+		return
+	}
+
+	var tpl Template
+	found := false
+	for _, t := range templates {
+		if t.ID == req.TemplateID {
+			tpl = t
+			found = true
+			break
+		}
+	}
+	if !found {
+		s.errorResponse(w, http.StatusNotFound, "Template not found")
+		return
+	}
+
+	if !verifyTemplateSignature(tpl, parseTrustedKeys(s.config.HubTrustedKeys)) {
+		s.errorResponse(w, http.StatusForbidden, "Template signature is not trusted")
+		return
+	}
+
+	scenario, err := materializeTemplate(tpl, req.Variables)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Failed to materialize template: "+err.Error())
+		return
+	}
+
+	if scenario.Name == "" || len(scenario.Actions) == 0 {
+		s.errorResponse(w, http.StatusBadRequest, "Template did not produce a valid scenario")
+		return
+	}
+
+	scenario.ID = uuid.New().String()
+	scenario.UserID = userID
+	scenario.Enabled = true
+	scenario.TemplateID = tpl.ID
+	scenario.TemplateVersion = tpl.Version
+	scenario.CreatedAt = time.Now()
+	scenario.UpdatedAt = time.Now()
+	if scenario.Timezone == "" {
+		scenario.Timezone = "UTC"
+	}
+
+	if err := compileScenario(&scenario); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid condition expression: "+err.Error())
+		return
+	}
+
+	ctx := context.Background()
+	key := fmt.Sprintf("scenarios:%s", userID)
+	scenarioJSON, _ := json.Marshal(scenario)
+	if err := s.redis.LPush(ctx, key, scenarioJSON).Err(); err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to create scenario")
+		return
+	}
+
+	s.mu.Lock()
+	s.scenarios[userID] = append(s.scenarios[userID], scenario)
+	s.scheduler.Rebuild(s.scenarios)
+	s.mu.Unlock()
+
+	s.jsonResponse(w, http.StatusCreated, scenario)
+}
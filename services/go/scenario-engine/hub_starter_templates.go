@@ -0,0 +1,71 @@
+package main
+
+// starterTemplates is the in-tree hub registry used whenever HUB_INDEX_URL
+// isn't configured (or the remote index can't be reached). Each entry is
+// signed with the private key matching starterRegistryPublicKey.
+var starterTemplates = []Template{
+	{
+		SchemaVersion:        1,
+		ID:                   "motion-triggers-light",
+		Version:              "1.0.0",
+		Author:               "homeguard-hub",
+		Description:          "Turn on a light when a motion sensor trips.",
+		Tags:                 []string{"lighting", "motion"},
+		RequiredCapabilities: []string{"motion_sensor", "light"},
+		Variables: []TemplateVariable{
+			{Name: "motion_device_id", Description: "Motion sensor device ID", Required: true},
+			{Name: "light_device_id", Description: "Light device ID", Required: true},
+		},
+		Scenario: `{
+  "name": "Motion triggers light",
+  "trigger": {"type": "device_event", "device_id": "{{ .motion_device_id }}", "event": "motion_detected"},
+  "actions": [
+    {"type": "device_command", "device_id": "{{ .light_device_id }}", "command": "turn_on"}
+  ]
+}`,
+		Signature: "XsUx8fvVV7uVfFbg7Ndg6weNrOKv89eEsuI48xA7g+F9lSLXzU+QrTr6b/cMXlYUtT1BCSSJP8Fk7XwncfCUAg==",
+	},
+	{
+		SchemaVersion:        1,
+		ID:                   "leak-sensor-shutoff-valve",
+		Version:              "1.0.0",
+		Author:               "homeguard-hub",
+		Description:          "Shut off the water valve and notify when a leak is detected.",
+		Tags:                 []string{"water", "safety"},
+		RequiredCapabilities: []string{"leak_sensor", "water_valve"},
+		Variables: []TemplateVariable{
+			{Name: "leak_device_id", Description: "Leak sensor device ID", Required: true},
+			{Name: "valve_device_id", Description: "Water valve device ID", Required: true},
+		},
+		Scenario: `{
+  "name": "Leak sensor shuts off valve",
+  "trigger": {"type": "device_event", "device_id": "{{ .leak_device_id }}", "event": "leak_detected"},
+  "actions": [
+    {"type": "device_command", "device_id": "{{ .valve_device_id }}", "command": "close"},
+    {"type": "notification", "params": {"title": "Leak detected", "message": "Water valve shut off automatically."}}
+  ]
+}`,
+		Signature: "1JFLdQ3x04VsERdIUVvN8VeNyoz3UplaY6mKMU8Bv3kapOwCxiImZrpodYHcmX0KkmhXMnK4rrsaZvqNsA3jBg==",
+	},
+	{
+		SchemaVersion:        1,
+		ID:                   "door-open-too-long",
+		Version:              "1.0.0",
+		Author:               "homeguard-hub",
+		Description:          "Notify if a door stays open longer than a threshold.",
+		Tags:                 []string{"door", "security"},
+		RequiredCapabilities: []string{"door_sensor"},
+		Variables: []TemplateVariable{
+			{Name: "door_device_id", Description: "Door sensor device ID", Required: true},
+			{Name: "threshold_seconds", Description: "How long the door may stay open before notifying", Default: "300", Type: "number"},
+		},
+		Scenario: `{
+  "name": "Door open too long",
+  "trigger": {"type": "device_event", "device_id": "{{ .door_device_id }}", "event": "door_opened"},
+  "actions": [
+    {"type": "notification", "delay": {{ .threshold_seconds }}, "params": {"title": "Door open", "message": "Door has been open too long."}}
+  ]
+}`,
+		Signature: "zYrI+QpqCWze8jO0Dnlt4nlS2+MRBE8VcJP2n+j4P+baXmuFLNkrCdeBQ90ZTCjU/6PJkG15/ykuXIVXG7lxCQ==",
+	},
+}
@@ -3,29 +3,45 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/cenkalti/backoff/v4"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/homeguard/scenario-engine/notify"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Port              string
-	RedisURL          string
-	DeviceServiceURL  string
-	NotificationURL   string
+	Port             string
+	RedisURL         string
+	DeviceServiceURL string
+	NotificationURL  string
+	// HubIndexURL is a Git-backed JSON index of scenario templates (see
+	// hub.go). Empty means "no remote hub configured" - /hub/templates then
+	// serves only the in-tree starter registry.
+	HubIndexURL string
+	// HubTrustedKeys is a comma-separated list of base64-encoded Ed25519
+	// public keys allowed to sign hub templates.
+	HubTrustedKeys string
 }
 
 // Scenario represents an automation scenario
@@ -38,8 +54,17 @@ type Scenario struct {
 	Trigger     Trigger     `json:"trigger"`
 	Conditions  []Condition `json:"conditions,omitempty"`
 	Actions     []Action    `json:"actions"`
-	CreatedAt   time.Time   `json:"created_at"`
-	UpdatedAt   time.Time   `json:"updated_at"`
+	// Timezone is an IANA location (e.g. "America/New_York") used to
+	// evaluate this scenario's schedule trigger and any time_range
+	// condition in local wall-clock time. Defaults to "UTC".
+	Timezone string `json:"timezone,omitempty"`
+	// TemplateID and TemplateVersion record which hub template (if any) this
+	// scenario was materialized from, so users can be notified when a newer
+	// version of the template is published.
+	TemplateID      string    `json:"template_id,omitempty"`
+	TemplateVersion string    `json:"template_version,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
 // Trigger defines what starts the scenario
@@ -53,20 +78,88 @@ type Trigger struct {
 
 // Condition defines when actions should execute
 type Condition struct {
-	Type     string      `json:"type"` // device_state, time_range, value_compare
+	Type     string      `json:"type"` // device_state, time_range, value_compare, expression
 	DeviceID string      `json:"device_id,omitempty"`
 	Property string      `json:"property,omitempty"`
-	Operator string      `json:"operator"` // eq, ne, gt, lt, gte, lte, contains
-	Value    interface{} `json:"value"`
+	Operator string      `json:"operator,omitempty"` // eq, ne, gt, lt, gte, lte, contains
+	Value    interface{} `json:"value,omitempty"`
+
+	// Expression is an expr-lang expression evaluated against exprEnv, used
+	// when Type is "expression", e.g.:
+	//   event.payload.temperature > 25 && device("thermostat-1").mode == "cool" && time.hour in 8..22
+	Expression string `json:"expression,omitempty"`
+
+	// compiledExpr is Expression compiled once at scenario create/update
+	// time by compileScenario, so evaluation never re-parses it.
+	compiledExpr *vm.Program
 }
 
 // Action defines what happens when triggered
 type Action struct {
-	Type     string                 `json:"type"` // device_command, notification, webhook, delay
-	DeviceID string                 `json:"device_id,omitempty"`
-	Command  string                 `json:"command,omitempty"`
-	Params   map[string]interface{} `json:"params,omitempty"`
-	Delay    int                    `json:"delay,omitempty"` // seconds
+	Type        string                 `json:"type"` // device_command, notification, webhook, delay
+	DeviceID    string                 `json:"device_id,omitempty"`
+	Command     string                 `json:"command,omitempty"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+	Delay       int                    `json:"delay,omitempty"` // seconds
+	ServiceURLs []string               `json:"service_urls,omitempty"`
+	Profile     string                 `json:"profile,omitempty"`
+	Retry       *RetryPolicy           `json:"retry,omitempty"`
+}
+
+// RetryPolicy configures the exponential backoff used when an action's
+// outbound call fails. Any zero field falls back to backoff's own default.
+type RetryPolicy struct {
+	InitialIntervalSeconds int `json:"initial_interval_seconds,omitempty"`
+	MaxIntervalSeconds     int `json:"max_interval_seconds,omitempty"`
+	MaxElapsedTimeSeconds  int `json:"max_elapsed_time_seconds,omitempty"`
+}
+
+// DLQEntry is an action that exhausted its retries (or failed permanently),
+// dead-lettered so a user can inspect or replay it later.
+type DLQEntry struct {
+	ID          string    `json:"id"`
+	ScenarioID  string    `json:"scenario_id"`
+	ActionIndex int       `json:"action_index"`
+	Action      Action    `json:"action"`
+	Error       string    `json:"error"`
+	Attempts    int       `json:"attempts"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AuditCondition is one condition's pass/fail result, recorded so a user can
+// see why a scenario did or didn't fire.
+type AuditCondition struct {
+	Type   string `json:"type"`
+	Result bool   `json:"result"`
+}
+
+// AuditAction is one action's outcome within a scenario execution.
+type AuditAction struct {
+	Type      string `json:"type"`
+	Success   bool   `json:"success"`
+	Attempts  int    `json:"attempts"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AuditRecord is a single scenario execution, written to the user's
+// audit:{user_id} Redis stream for later inspection via the executions
+// endpoint.
+type AuditRecord struct {
+	ScenarioID string           `json:"scenario_id"`
+	TraceID    string           `json:"trace_id,omitempty"`
+	Trigger    string           `json:"trigger"`
+	Conditions []AuditCondition `json:"conditions"`
+	Actions    []AuditAction    `json:"actions"`
+	Timestamp  time.Time        `json:"timestamp"`
+}
+
+// NotifyProfile is a named, saved list of Shoutrrr service URLs a user can
+// reference from a notification Action by name instead of repeating the
+// URLs in every scenario.
+type NotifyProfile struct {
+	Name        string   `json:"name"`
+	ServiceURLs []string `json:"service_urls"`
 }
 
 // EventPayload represents an incoming event
@@ -108,6 +201,20 @@ var (
 			Buckets: prometheus.DefBuckets,
 		},
 	)
+	notificationsSent = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scenario_engine_notifications_sent_total",
+			Help: "Total notification sends attempted via notify action service URLs",
+		},
+		[]string{"service", "status"},
+	)
+	actionsDLQ = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scenario_engine_actions_dlq_total",
+			Help: "Total actions dead-lettered after exhausting retries",
+		},
+		[]string{"action_type", "reason"},
+	)
 )
 
 func init() {
@@ -115,6 +222,8 @@ func init() {
 	prometheus.MustRegister(scenariosTriggered)
 	prometheus.MustRegister(actionsExecuted)
 	prometheus.MustRegister(evaluationDuration)
+	prometheus.MustRegister(notificationsSent)
+	prometheus.MustRegister(actionsDLQ)
 }
 
 // Service handles scenario automation
@@ -125,6 +234,14 @@ type Service struct {
 	client    *http.Client
 	scenarios map[string][]Scenario // userID -> scenarios
 	mu        sync.RWMutex
+
+	scheduler *Scheduler
+
+	// shutdownCtx is canceled when the service begins shutting down, so
+	// in-flight action delays and retry backoffs return promptly instead
+	// of blocking a graceful shutdown.
+	shutdownCtx context.Context
+	shutdown    context.CancelFunc
 }
 
 func loadConfig() *Config {
@@ -133,6 +250,8 @@ func loadConfig() *Config {
 		RedisURL:         getEnv("REDIS_URL", "redis://redis.homeguard-data:6379"),
 		DeviceServiceURL: getEnv("DEVICE_SERVICE_URL", "http://device-service:8080"),
 		NotificationURL:  getEnv("NOTIFICATION_SERVICE_URL", "http://notification-service:8080"),
+		HubIndexURL:      getEnv("HUB_INDEX_URL", ""),
+		HubTrustedKeys:   getEnv("HUB_TRUSTED_KEYS", starterRegistryPublicKey),
 	}
 }
 
@@ -159,17 +278,23 @@ func NewService(config *Config) (*Service, error) {
 		log.Printf("Warning: Redis connection failed: %v", err)
 	}
 
+	shutdownCtx, shutdown := context.WithCancel(context.Background())
 	service := &Service{
-		config:    config,
-		redis:     redisClient,
-		router:    mux.NewRouter(),
-		client:    &http.Client{Timeout: 10 * time.Second},
-		scenarios: make(map[string][]Scenario),
+		config:      config,
+		redis:       redisClient,
+		router:      mux.NewRouter(),
+		client:      &http.Client{Timeout: 10 * time.Second},
+		scenarios:   make(map[string][]Scenario),
+		shutdownCtx: shutdownCtx,
+		shutdown:    shutdown,
 	}
 
 	// Load scenarios from Redis
 	service.loadScenarios()
 
+	service.scheduler = NewScheduler(service)
+	service.scheduler.Rebuild(service.scenarios)
+
 	return service, nil
 }
 
@@ -190,9 +315,14 @@ func (s *Service) loadScenarios() {
 		userID := strings.TrimPrefix(key, "scenarios:")
 		for _, scenarioJSON := range scenarios {
 			var scenario Scenario
-			if err := json.Unmarshal([]byte(scenarioJSON), &scenario); err == nil {
-				s.scenarios[userID] = append(s.scenarios[userID], scenario)
+			if err := json.Unmarshal([]byte(scenarioJSON), &scenario); err != nil {
+				continue
+			}
+			if err := compileScenario(&scenario); err != nil {
+				log.Printf("Skipping invalid expression in scenario %s: %v", scenario.ID, err)
+				continue
 			}
+			s.scenarios[userID] = append(s.scenarios[userID], scenario)
 		}
 	}
 	log.Printf("Loaded %d scenario groups", len(s.scenarios))
@@ -212,9 +342,29 @@ func (s *Service) SetupRoutes() {
 	s.router.HandleFunc("/scenarios/{user_id}/{scenario_id}/enable", s.enableScenario).Methods("POST")
 	s.router.HandleFunc("/scenarios/{user_id}/{scenario_id}/disable", s.disableScenario).Methods("POST")
 	s.router.HandleFunc("/scenarios/{user_id}/{scenario_id}/trigger", s.manualTrigger).Methods("POST")
+	s.router.HandleFunc("/scenarios/{user_id}/{scenario_id}/next_runs", s.nextRuns).Methods("GET")
+	s.router.HandleFunc("/scenarios/{user_id}/{scenario_id}/executions", s.listExecutions).Methods("GET")
 
 	// Event evaluation endpoint
 	s.router.HandleFunc("/evaluate", s.evaluateEvent).Methods("POST")
+
+	// Notification profiles: named groups of Shoutrrr service URLs a
+	// notification action can reference by name instead of repeating them.
+	s.router.HandleFunc("/notify-profiles/{user_id}", s.listNotifyProfiles).Methods("GET")
+	s.router.HandleFunc("/notify-profiles/{user_id}", s.saveNotifyProfile).Methods("POST")
+	s.router.HandleFunc("/notify-profiles/{user_id}/{name}", s.deleteNotifyProfile).Methods("DELETE")
+
+	// Dead-letter queue: actions that exhausted their retries, kept around
+	// for inspection or manual replay.
+	s.router.HandleFunc("/dlq/{user_id}", s.listDLQ).Methods("GET")
+	s.router.HandleFunc("/dlq/{user_id}/{entry_id}/retry", s.retryDLQEntry).Methods("POST")
+	s.router.HandleFunc("/dlq/{user_id}/{entry_id}", s.deleteDLQEntry).Methods("DELETE")
+
+	// Community scenario hub: signed, importable scenario templates (see
+	// hub.go).
+	s.router.HandleFunc("/hub/templates", s.listHubTemplates).Methods("GET")
+	s.router.HandleFunc("/hub/templates/{id}", s.getHubTemplate).Methods("GET")
+	s.router.HandleFunc("/scenarios/{user_id}/from_template", s.createScenarioFromTemplate).Methods("POST")
 }
 
 func (s *Service) healthCheck(w http.ResponseWriter, r *http.Request) {
@@ -242,6 +392,14 @@ func (s *Service) createScenario(w http.ResponseWriter, r *http.Request) {
 	req.CreatedAt = time.Now()
 	req.UpdatedAt = time.Now()
 	req.Enabled = true
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+
+	if err := compileScenario(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid condition expression: "+err.Error())
+		return
+	}
 
 	// Store in Redis
 	ctx := context.Background()
@@ -256,6 +414,7 @@ func (s *Service) createScenario(w http.ResponseWriter, r *http.Request) {
 	// Update in-memory cache
 	s.mu.Lock()
 	s.scenarios[req.UserID] = append(s.scenarios[req.UserID], req)
+	s.scheduler.Rebuild(s.scenarios)
 	s.mu.Unlock()
 
 	s.jsonResponse(w, http.StatusCreated, req)
@@ -309,6 +468,11 @@ func (s *Service) updateScenario(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := compileScenario(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid condition expression: "+err.Error())
+		return
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -325,6 +489,7 @@ func (s *Service) updateScenario(w http.ResponseWriter, r *http.Request) {
 
 			// Update in Redis
 			s.persistScenarios(userID)
+			s.scheduler.Rebuild(s.scenarios)
 
 			s.jsonResponse(w, http.StatusOK, req)
 			return
@@ -347,6 +512,7 @@ func (s *Service) deleteScenario(w http.ResponseWriter, r *http.Request) {
 		if scenario.ID == scenarioID {
 			s.scenarios[userID] = append(scenarios[:i], scenarios[i+1:]...)
 			s.persistScenarios(userID)
+			s.scheduler.Rebuild(s.scenarios)
 			s.jsonResponse(w, http.StatusOK, map[string]string{"status": "deleted"})
 			return
 		}
@@ -355,6 +521,80 @@ func (s *Service) deleteScenario(w http.ResponseWriter, r *http.Request) {
 	s.errorResponse(w, http.StatusNotFound, "Scenario not found")
 }
 
+func notifyProfilesKey(userID string) string {
+	return fmt.Sprintf("notify_profiles:%s", userID)
+}
+
+func (s *Service) listNotifyProfiles(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	fields, err := s.redis.HGetAll(r.Context(), notifyProfilesKey(userID)).Result()
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to load notification profiles")
+		return
+	}
+
+	profiles := make([]NotifyProfile, 0, len(fields))
+	for name, urlsJSON := range fields {
+		var urls []string
+		if err := json.Unmarshal([]byte(urlsJSON), &urls); err != nil {
+			continue
+		}
+		profiles = append(profiles, NotifyProfile{Name: name, ServiceURLs: urls})
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{"profiles": profiles})
+}
+
+func (s *Service) saveNotifyProfile(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	var profile NotifyProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if profile.Name == "" || len(profile.ServiceURLs) == 0 {
+		s.errorResponse(w, http.StatusBadRequest, "name and service_urls are required")
+		return
+	}
+
+	urlsJSON, _ := json.Marshal(profile.ServiceURLs)
+	if err := s.redis.HSet(r.Context(), notifyProfilesKey(userID), profile.Name, urlsJSON).Err(); err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to save notification profile")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, profile)
+}
+
+func (s *Service) deleteNotifyProfile(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	name := vars["name"]
+
+	if err := s.redis.HDel(r.Context(), notifyProfilesKey(userID), name).Err(); err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to delete notification profile")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// notifyProfileURLs looks up a saved profile's service URLs.
+func (s *Service) notifyProfileURLs(userID, name string) ([]string, error) {
+	urlsJSON, err := s.redis.HGet(context.Background(), notifyProfilesKey(userID), name).Result()
+	if err != nil {
+		return nil, fmt.Errorf("notification profile %q not found: %w", name, err)
+	}
+
+	var urls []string
+	if err := json.Unmarshal([]byte(urlsJSON), &urls); err != nil {
+		return nil, fmt.Errorf("corrupt notification profile %q: %w", name, err)
+	}
+	return urls, nil
+}
+
 func (s *Service) enableScenario(w http.ResponseWriter, r *http.Request) {
 	s.setScenarioEnabled(w, r, true)
 }
@@ -378,6 +618,7 @@ func (s *Service) setScenarioEnabled(w http.ResponseWriter, r *http.Request, ena
 			scenarios[i].UpdatedAt = time.Now()
 			s.scenarios[userID] = scenarios
 			s.persistScenarios(userID)
+			s.scheduler.Rebuild(s.scenarios)
 			s.jsonResponse(w, http.StatusOK, scenarios[i])
 			return
 		}
@@ -391,13 +632,17 @@ func (s *Service) manualTrigger(w http.ResponseWriter, r *http.Request) {
 	userID := vars["user_id"]
 	scenarioID := vars["scenario_id"]
 
+	ctx, span := startSpan(r.Context(), "manual_trigger")
+	defer span.End()
+	detachedCtx := detachContext(ctx)
+
 	s.mu.RLock()
 	scenarios := s.scenarios[userID]
 	s.mu.RUnlock()
 
 	for _, scenario := range scenarios {
 		if scenario.ID == scenarioID {
-			go s.executeScenario(scenario, nil)
+			go s.executeScenario(detachedCtx, scenario, nil, "manual", nil)
 			s.jsonResponse(w, http.StatusAccepted, map[string]string{
 				"status":  "triggered",
 				"message": "Scenario execution started",
@@ -409,12 +654,57 @@ func (s *Service) manualTrigger(w http.ResponseWriter, r *http.Request) {
 	s.errorResponse(w, http.StatusNotFound, "Scenario not found")
 }
 
+func (s *Service) nextRuns(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	scenarioID := vars["scenario_id"]
+
+	n := 5
+	if raw := r.URL.Query().Get("n"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			n = parsed
+		}
+	}
+
+	s.mu.RLock()
+	scenarios := s.scenarios[userID]
+	s.mu.RUnlock()
+
+	for _, scenario := range scenarios {
+		if scenario.ID != scenarioID {
+			continue
+		}
+		if scenario.Trigger.Type != "schedule" || scenario.Trigger.Schedule == "" {
+			s.errorResponse(w, http.StatusBadRequest, "Scenario has no schedule trigger")
+			return
+		}
+
+		runs, err := s.scheduler.NextRuns(scenario, n)
+		if err != nil {
+			s.errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"scenario_id": scenario.ID,
+			"next_runs":   runs,
+		})
+		return
+	}
+
+	s.errorResponse(w, http.StatusNotFound, "Scenario not found")
+}
+
 func (s *Service) evaluateEvent(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	defer func() {
 		evaluationDuration.Observe(time.Since(start).Seconds())
 	}()
 
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := startSpan(ctx, "evaluate_event")
+	defer span.End()
+	detachedCtx := detachContext(ctx)
+
 	var event EventPayload
 	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
 		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
@@ -422,30 +712,38 @@ func (s *Service) evaluateEvent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	scenariosEvaluated.Inc()
+	s.recordHistory(event)
 
 	s.mu.RLock()
 	scenarios := s.scenarios[event.UserID]
 	s.mu.RUnlock()
 
+	cache := newDeviceStateCache(s.client, s.config.DeviceServiceURL)
+
 	triggered := 0
 	for _, scenario := range scenarios {
 		if !scenario.Enabled {
 			continue
 		}
+		if !s.matchesTrigger(scenario.Trigger, event) {
+			continue
+		}
 
-		if s.matchesTrigger(scenario.Trigger, event) {
-			if s.evaluateConditions(scenario.Conditions, event) {
-				go s.executeScenario(scenario, &event)
-				scenariosTriggered.WithLabelValues(scenario.ID).Inc()
-				triggered++
-			}
+		passed, conditionAudits := s.evaluateConditionsWithAudit(ctx, scenario.Conditions, event, cache)
+		if !passed {
+			continue
 		}
+
+		go s.executeScenario(detachedCtx, scenario, &event, "device_event", conditionAudits)
+		scenariosTriggered.WithLabelValues(scenario.ID).Inc()
+		triggered++
 	}
 
 	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
-		"evaluated":  len(scenarios),
-		"triggered":  triggered,
-		"event_id":   event.EventID,
+		"evaluated": len(scenarios),
+		"triggered": triggered,
+		"event_id":  event.EventID,
+		"trace_id":  traceIDFromContext(ctx),
 	})
 }
 
@@ -465,21 +763,31 @@ func (s *Service) matchesTrigger(trigger Trigger, event EventPayload) bool {
 	return true
 }
 
-func (s *Service) evaluateConditions(conditions []Condition, event EventPayload) bool {
-	if len(conditions) == 0 {
-		return true
+// evaluateConditionsWithAudit evaluates every condition (it does not
+// short-circuit on the first failure, so the audit trail covers all of
+// them) and returns whether they all passed alongside a per-condition
+// record for the scenario's audit log.
+func (s *Service) evaluateConditionsWithAudit(ctx context.Context, conditions []Condition, event EventPayload, cache *deviceStateCache) (bool, []AuditCondition) {
+	_, span := startSpan(ctx, "evaluate_conditions")
+	defer span.End()
+
+	if cache == nil {
+		cache = newDeviceStateCache(s.client, s.config.DeviceServiceURL)
 	}
 
+	passed := true
+	audits := make([]AuditCondition, 0, len(conditions))
 	for _, condition := range conditions {
-		if !s.evaluateCondition(condition, event) {
-			return false
+		ok := s.evaluateCondition(condition, event, cache)
+		audits = append(audits, AuditCondition{Type: condition.Type, Result: ok})
+		if !ok {
+			passed = false
 		}
 	}
-
-	return true
+	return passed, audits
 }
 
-func (s *Service) evaluateCondition(condition Condition, event EventPayload) bool {
+func (s *Service) evaluateCondition(condition Condition, event EventPayload, cache *deviceStateCache) bool {
 	switch condition.Type {
 	case "value_compare":
 		value, ok := event.Payload[condition.Property]
@@ -487,14 +795,318 @@ func (s *Service) evaluateCondition(condition Condition, event EventPayload) boo
 			return false
 		}
 		return s.compareValues(value, condition.Operator, condition.Value)
+	case "expression":
+		return s.evaluateExpression(condition, event, cache)
 	case "device_state":
 		// Would query device service for current state
 		return true
+	case "time_range":
+		return s.evaluateTimeRange(condition, event)
 	default:
 		return true
 	}
 }
 
+// compileScenario compiles every "expression" condition in scenario and
+// caches the resulting program on the Condition itself (compiledExpr), so
+// evaluation never re-parses the expression. Returns the first compile
+// error, if any, so callers can reject the scenario outright.
+func compileScenario(scenario *Scenario) error {
+	for i := range scenario.Conditions {
+		condition := &scenario.Conditions[i]
+		if condition.Type != "expression" {
+			continue
+		}
+
+		program, err := expr.Compile(condition.Expression, expr.Env(exprCompileEnv()), expr.AsBool())
+		if err != nil {
+			return fmt.Errorf("condition %d: %w", i, err)
+		}
+		condition.compiledExpr = program
+	}
+	return nil
+}
+
+// exprCompileEnv describes the shape of exprEnv for compile-time type
+// checking: a map so field access on event/time is permissively dynamic, and
+// real closures so device()/history() calls type-check.
+func exprCompileEnv() map[string]interface{} {
+	return map[string]interface{}{
+		"event":   map[string]interface{}{},
+		"time":    map[string]interface{}{},
+		"device":  func(id string) map[string]interface{} { return nil },
+		"history": func(deviceID, property, duration string) []float64 { return nil },
+	}
+}
+
+// evaluateExpression runs condition's compiled expression against an
+// environment exposing the triggering event, lazy cross-device state lookups
+// (device), time-of-day helpers (time), and recent samples (history).
+func (s *Service) evaluateExpression(condition Condition, event EventPayload, cache *deviceStateCache) bool {
+	if condition.compiledExpr == nil {
+		return false
+	}
+	if cache == nil {
+		cache = newDeviceStateCache(s.client, s.config.DeviceServiceURL)
+	}
+
+	env := map[string]interface{}{
+		"event": map[string]interface{}{
+			"event_id":   event.EventID,
+			"device_id":  event.DeviceID,
+			"user_id":    event.UserID,
+			"event_type": event.EventType,
+			"timestamp":  event.Timestamp.Unix(),
+			"payload":    event.Payload,
+		},
+		"time": map[string]interface{}{
+			"hour":    event.Timestamp.UTC().Hour(),
+			"minute":  event.Timestamp.UTC().Minute(),
+			"weekday": int(event.Timestamp.UTC().Weekday()),
+			"unix":    event.Timestamp.Unix(),
+		},
+		"device": func(id string) map[string]interface{} {
+			return cache.get(event.UserID, id)
+		},
+		"history": func(deviceID, property, duration string) []float64 {
+			return s.historyLookup(event.UserID, deviceID, property, duration)
+		},
+	}
+
+	output, err := expr.Run(condition.compiledExpr, env)
+	if err != nil {
+		log.Printf("Expression evaluation failed: %v", err)
+		return false
+	}
+
+	result, ok := output.(bool)
+	return ok && result
+}
+
+// deviceStateCache memoizes device state lookups for the lifetime of a
+// single event evaluation, so an expression referencing the same device
+// multiple times (or across multiple conditions) only hits the device
+// service once per 2s TTL window.
+type deviceStateCache struct {
+	client  *http.Client
+	baseURL string
+
+	mu      sync.Mutex
+	entries map[string]deviceCacheEntry
+}
+
+type deviceCacheEntry struct {
+	state     map[string]interface{}
+	expiresAt time.Time
+}
+
+func newDeviceStateCache(client *http.Client, baseURL string) *deviceStateCache {
+	return &deviceStateCache{
+		client:  client,
+		baseURL: baseURL,
+		entries: make(map[string]deviceCacheEntry),
+	}
+}
+
+// get returns deviceID's state, scoped to userID: the lookup is forwarded to
+// device-service with an X-User-ID header, so a scenario belonging to one
+// tenant can never read another tenant's device through a crafted deviceID.
+func (c *deviceStateCache) get(userID, deviceID string) map[string]interface{} {
+	c.mu.Lock()
+	if entry, ok := c.entries[deviceID]; ok && time.Now().Before(entry.expiresAt) {
+		c.mu.Unlock()
+		return entry.state
+	}
+	c.mu.Unlock()
+
+	state := c.fetch(userID, deviceID)
+
+	c.mu.Lock()
+	c.entries[deviceID] = deviceCacheEntry{state: state, expiresAt: time.Now().Add(2 * time.Second)}
+	c.mu.Unlock()
+
+	return state
+}
+
+func (c *deviceStateCache) fetch(userID, deviceID string) map[string]interface{} {
+	url := fmt.Sprintf("%s/devices/%s/state", c.baseURL, deviceID)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		log.Printf("Device state lookup failed for %s: %v", deviceID, err)
+		return map[string]interface{}{}
+	}
+	req.Header.Set("X-User-ID", userID)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		log.Printf("Device state lookup failed for %s: %v", deviceID, err)
+		return map[string]interface{}{}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return map[string]interface{}{}
+	}
+
+	var state map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return map[string]interface{}{}
+	}
+	return state
+}
+
+// historyKey is the Redis sorted set evaluateEvent appends numeric payload
+// samples to, keyed by owner, device, and property, scored by sample time.
+// Namespacing by userID keeps the history() expression helper from reading
+// another tenant's telemetry for a device it doesn't own.
+func historyKey(userID, deviceID, property string) string {
+	return "history:" + userID + ":" + deviceID + ":" + property
+}
+
+// recordHistory appends each numeric property in event.Payload to its
+// device+property sorted set, for the history() expression helper to read
+// back later. Entries expire after 24h so the set doesn't grow unbounded.
+func (s *Service) recordHistory(event EventPayload) {
+	if event.DeviceID == "" {
+		return
+	}
+
+	ctx := context.Background()
+	ts := event.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	for property, raw := range event.Payload {
+		value, ok := toFloat64(raw)
+		if !ok {
+			continue
+		}
+
+		key := historyKey(event.UserID, event.DeviceID, property)
+		member := fmt.Sprintf("%d:%v", ts.UnixNano(), value)
+		if err := s.redis.ZAdd(ctx, key, &redis.Z{Score: float64(ts.UnixNano()), Member: member}).Err(); err != nil {
+			continue
+		}
+		s.redis.Expire(ctx, key, 24*time.Hour)
+	}
+}
+
+// historyLookup returns the numeric samples recorded for userID's
+// deviceID/property within the last duration (a Go duration string, e.g.
+// "10m"), for the history() expression helper. userID scopes the lookup to
+// the scenario owner, so it can never read another tenant's history.
+func (s *Service) historyLookup(userID, deviceID, property, duration string) []float64 {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	minScore := float64(time.Now().Add(-d).UnixNano())
+	members, err := s.redis.ZRangeByScore(ctx, historyKey(userID, deviceID, property), &redis.ZRangeBy{
+		Min: fmt.Sprintf("%.0f", minScore),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil
+	}
+
+	values := make([]float64, 0, len(members))
+	for _, m := range members {
+		_, rawValue, found := strings.Cut(m, ":")
+		if !found {
+			continue
+		}
+		if v, err := strconv.ParseFloat(rawValue, 64); err == nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// evaluateTimeRange checks whether event.Timestamp falls within the window
+// described by condition.Value, a JSON object shaped like:
+//
+//	{"start": "HH:MM", "end": "HH:MM", "timezone": "America/New_York", "days": ["mon", "wed"]}
+//
+// timezone defaults to UTC and days, if omitted, matches every day. An end
+// time earlier than start is treated as wrapping past midnight.
+func (s *Service) evaluateTimeRange(condition Condition, event EventPayload) bool {
+	spec, ok := condition.Value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	start, ok := parseClockTime(spec["start"])
+	if !ok {
+		return false
+	}
+	end, ok := parseClockTime(spec["end"])
+	if !ok {
+		return false
+	}
+
+	loc := time.UTC
+	if tz, ok := spec["timezone"].(string); ok && tz != "" {
+		parsed, err := time.LoadLocation(tz)
+		if err != nil {
+			return false
+		}
+		loc = parsed
+	}
+
+	now := event.Timestamp.In(loc)
+
+	if days, ok := spec["days"].([]interface{}); ok && len(days) > 0 {
+		if !matchesWeekday(now.Weekday(), days) {
+			return false
+		}
+	}
+
+	cur := now.Hour()*60 + now.Minute()
+	if end < start {
+		return cur >= start || cur < end
+	}
+	return cur >= start && cur < end
+}
+
+// parseClockTime parses an "HH:MM" string into minutes since midnight.
+func parseClockTime(v interface{}) (int, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, false
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+var weekdayAbbrevs = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func matchesWeekday(day time.Weekday, allowed []interface{}) bool {
+	for _, a := range allowed {
+		name, ok := a.(string)
+		if !ok {
+			continue
+		}
+		if weekdayAbbrevs[strings.ToLower(name)] == day {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Service) compareValues(actual interface{}, operator string, expected interface{}) bool {
 	// Convert to float64 for numeric comparison
 	actualFloat, actualOk := toFloat64(actual)
@@ -548,45 +1160,143 @@ func toFloat64(v interface{}) (float64, bool) {
 	}
 }
 
-func (s *Service) executeScenario(scenario Scenario, event *EventPayload) {
+// executeScenario runs scenario's actions in order, recording each one's
+// outcome/latency/attempt count and writing the whole run as a single audit
+// record to the user's audit:{user_id} Redis stream.
+func (s *Service) executeScenario(ctx context.Context, scenario Scenario, event *EventPayload, triggerDesc string, conditionAudits []AuditCondition) {
+	ctx, span := startSpan(ctx, "execute_scenario")
+	defer span.End()
+	span.SetAttributes(attribute.String("scenario.id", scenario.ID))
+
 	log.Printf("Executing scenario: %s (%s)", scenario.Name, scenario.ID)
 
-	for _, action := range scenario.Actions {
+	actionAudits := make([]AuditAction, 0, len(scenario.Actions))
+	for i, action := range scenario.Actions {
 		if action.Delay > 0 {
-			time.Sleep(time.Duration(action.Delay) * time.Second)
+			select {
+			case <-time.After(time.Duration(action.Delay) * time.Second):
+			case <-s.shutdownCtx.Done():
+				return
+			}
 		}
 
-		if err := s.executeAction(action, scenario.UserID, event); err != nil {
-			log.Printf("Failed to execute action: %v", err)
+		actionStart := time.Now()
+		attempts, err := s.executeActionWithRetry(ctx, scenario.UserID, scenario.ID, i, action, event)
+		audit := AuditAction{
+			Type:      action.Type,
+			Success:   err == nil,
+			Attempts:  attempts,
+			LatencyMS: time.Since(actionStart).Milliseconds(),
+		}
+		if err != nil {
+			audit.Error = err.Error()
+			log.Printf("Action dead-lettered after retries: %v", err)
 		} else {
 			actionsExecuted.WithLabelValues(action.Type).Inc()
 		}
+		actionAudits = append(actionAudits, audit)
 	}
+
+	s.writeAuditRecord(ctx, scenario, triggerDesc, conditionAudits, actionAudits)
 }
 
-func (s *Service) executeAction(action Action, userID string, event *EventPayload) error {
+// executeActionWithRetry retries action via exponential backoff (configured
+// by action.Retry, or backoff's defaults if unset), giving up either when the
+// operation returns a permanent error or the backoff's MaxElapsedTime is
+// reached. A final failure is pushed onto the user's dead-letter queue rather
+// than silently dropped. It returns the number of attempts made, for the
+// caller's audit record.
+func (s *Service) executeActionWithRetry(ctx context.Context, userID, scenarioID string, actionIndex int, action Action, event *EventPayload) (int, error) {
+	ctx, span := startSpan(ctx, "execute_action")
+	defer span.End()
+	span.SetAttributes(attribute.String("action.type", action.Type))
+
+	attempts := 0
+	reason := "retries_exhausted"
+
+	operation := func() error {
+		attempts++
+		err := s.executeAction(ctx, action, userID, event)
+		if err != nil {
+			var permErr *backoff.PermanentError
+			if errors.As(err, &permErr) {
+				reason = "permanent"
+			} else {
+				reason = "retries_exhausted"
+			}
+		}
+		return err
+	}
+
+	err := backoff.Retry(operation, backoff.WithContext(retryBackoff(action.Retry), s.shutdownCtx))
+	if err == nil {
+		return attempts, nil
+	}
+	if s.shutdownCtx.Err() != nil {
+		reason = "shutdown"
+	}
+
+	s.pushToDLQ(userID, scenarioID, actionIndex, action, err, attempts)
+	actionsDLQ.WithLabelValues(action.Type, reason).Inc()
+	return attempts, err
+}
+
+// retryBackoff builds the exponential backoff for an action's retries,
+// applying any fields the caller overrode in policy on top of the library's
+// defaults (InitialInterval 500ms, MaxInterval 1m, MaxElapsedTime 15m).
+func retryBackoff(policy *RetryPolicy) *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	if policy != nil {
+		if policy.InitialIntervalSeconds > 0 {
+			b.InitialInterval = time.Duration(policy.InitialIntervalSeconds) * time.Second
+		}
+		if policy.MaxIntervalSeconds > 0 {
+			b.MaxInterval = time.Duration(policy.MaxIntervalSeconds) * time.Second
+		}
+		if policy.MaxElapsedTimeSeconds > 0 {
+			b.MaxElapsedTime = time.Duration(policy.MaxElapsedTimeSeconds) * time.Second
+		}
+	}
+	return b
+}
+
+func (s *Service) executeAction(ctx context.Context, action Action, userID string, event *EventPayload) error {
 	switch action.Type {
 	case "device_command":
-		return s.sendDeviceCommand(action)
+		return s.sendDeviceCommand(ctx, action)
 	case "notification":
-		return s.sendNotification(action, userID)
+		return s.sendNotification(ctx, action, userID)
 	case "webhook":
-		return s.callWebhook(action)
+		return s.callWebhook(ctx, action)
 	default:
 		log.Printf("Unknown action type: %s", action.Type)
 	}
 	return nil
 }
 
-func (s *Service) sendDeviceCommand(action Action) error {
+func (s *Service) sendDeviceCommand(ctx context.Context, action Action) error {
 	payload, _ := json.Marshal(map[string]interface{}{
 		"command": action.Command,
 		"params":  action.Params,
 	})
 
 	url := fmt.Sprintf("%s/devices/%s/command", s.config.DeviceServiceURL, action.DeviceID)
-	req, _ := http.NewRequest("POST", url, strings.NewReader(string(payload)))
+	return s.postJSON(ctx, url, payload)
+}
+
+// postJSON performs a single POST attempt and classifies the outcome for the
+// retry loop in executeActionWithRetry: network errors and 5xx/429 responses
+// are left as plain errors (retryable), anything else is wrapped as a
+// backoff.PermanentError so it's dead-lettered on the first failure. The
+// caller's trace context is injected as outbound headers so the downstream
+// service's span links back to this one.
+func (s *Service) postJSON(ctx context.Context, url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(s.shutdownCtx, "POST", url, strings.NewReader(string(payload)))
+	if err != nil {
+		return backoff.Permanent(err)
+	}
 	req.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -594,14 +1304,64 @@ func (s *Service) sendDeviceCommand(action Action) error {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("device command failed with status %d", resp.StatusCode)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("request to %s failed with status %d", url, resp.StatusCode)
+	case resp.StatusCode >= 400:
+		return backoff.Permanent(fmt.Errorf("request to %s failed with status %d", url, resp.StatusCode))
 	}
 
 	return nil
 }
 
-func (s *Service) sendNotification(action Action, userID string) error {
+// sendNotification fans a notification out to the action's Shoutrrr service
+// URLs (explicit or resolved from a saved profile), falling back to the
+// original single-URL POST against the notification service when neither is
+// set, so existing scenarios keep working unchanged.
+func (s *Service) sendNotification(ctx context.Context, action Action, userID string) error {
+	urls := action.ServiceURLs
+	if action.Profile != "" {
+		profileURLs, err := s.notifyProfileURLs(userID, action.Profile)
+		if err != nil {
+			return err
+		}
+		urls = append(urls, profileURLs...)
+	}
+
+	if len(urls) == 0 {
+		return s.sendLegacyNotification(ctx, action, userID)
+	}
+
+	title, _ := action.Params["title"].(string)
+	message, _ := action.Params["message"].(string)
+	priority, _ := toFloat64(action.Params["priority"])
+
+	results, err := notify.Send(ctx, urls, notify.Message{
+		Title:    title,
+		Body:     message,
+		Priority: int(priority),
+	})
+	for _, result := range results {
+		status := "success"
+		if result.Err != nil {
+			status = "failure"
+			log.Printf("Notification send failed for %s: %v", serviceNameFromURL(result.URL), result.Err)
+		}
+		notificationsSent.WithLabelValues(serviceNameFromURL(result.URL), status).Inc()
+	}
+	return err
+}
+
+func serviceNameFromURL(rawURL string) string {
+	if idx := strings.Index(rawURL, "://"); idx >= 0 {
+		return rawURL[:idx]
+	}
+	return "unknown"
+}
+
+// sendLegacyNotification is the original behavior: a single POST to the
+// notification service's own /notify endpoint.
+func (s *Service) sendLegacyNotification(ctx context.Context, action Action, userID string) error {
 	payload, _ := json.Marshal(map[string]interface{}{
 		"user_id":  userID,
 		"type":     "automation",
@@ -610,35 +1370,17 @@ func (s *Service) sendNotification(action Action, userID string) error {
 		"priority": action.Params["priority"],
 	})
 
-	req, _ := http.NewRequest("POST", s.config.NotificationURL+"/notify", strings.NewReader(string(payload)))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	return nil
+	return s.postJSON(ctx, s.config.NotificationURL+"/notify", payload)
 }
 
-func (s *Service) callWebhook(action Action) error {
+func (s *Service) callWebhook(ctx context.Context, action Action) error {
 	url, ok := action.Params["url"].(string)
 	if !ok {
-		return fmt.Errorf("webhook URL not specified")
+		return backoff.Permanent(fmt.Errorf("webhook URL not specified"))
 	}
 
 	payload, _ := json.Marshal(action.Params["body"])
-	req, _ := http.NewRequest("POST", url, strings.NewReader(string(payload)))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	return nil
+	return s.postJSON(ctx, url, payload)
 }
 
 func (s *Service) persistScenarios(userID string) {
@@ -654,6 +1396,217 @@ func (s *Service) persistScenarios(userID string) {
 	}
 }
 
+func dlqKey(userID string) string {
+	return "dlq:actions:" + userID
+}
+
+// pushToDLQ records a permanently or repeatedly failed action so a user can
+// inspect and replay it later via the /dlq endpoints.
+func (s *Service) pushToDLQ(userID, scenarioID string, actionIndex int, action Action, actionErr error, attempts int) {
+	entry := DLQEntry{
+		ID:          uuid.New().String(),
+		ScenarioID:  scenarioID,
+		ActionIndex: actionIndex,
+		Action:      action,
+		Error:       actionErr.Error(),
+		Attempts:    attempts,
+		CreatedAt:   time.Now(),
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to marshal DLQ entry: %v", err)
+		return
+	}
+
+	if err := s.redis.RPush(context.Background(), dlqKey(userID), data).Err(); err != nil {
+		log.Printf("Failed to push DLQ entry: %v", err)
+	}
+}
+
+// findAndRemoveDLQEntry scans the user's dead-letter list for entryID and, if
+// found, removes it. Redis lists have no delete-by-value-match-once primitive,
+// so it's removed by first overwriting the matched element with a tombstone
+// via LSET, then LREM-ing that tombstone.
+func (s *Service) findAndRemoveDLQEntry(userID, entryID string) (DLQEntry, bool, error) {
+	ctx := context.Background()
+	key := dlqKey(userID)
+
+	raw, err := s.redis.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return DLQEntry{}, false, err
+	}
+
+	for i, item := range raw {
+		var entry DLQEntry
+		if err := json.Unmarshal([]byte(item), &entry); err != nil {
+			continue
+		}
+		if entry.ID != entryID {
+			continue
+		}
+
+		tombstone := "__dlq_removed__:" + entry.ID
+		if err := s.redis.LSet(ctx, key, int64(i), tombstone).Err(); err != nil {
+			return DLQEntry{}, false, err
+		}
+		if err := s.redis.LRem(ctx, key, 1, tombstone).Err(); err != nil {
+			return DLQEntry{}, false, err
+		}
+		return entry, true, nil
+	}
+
+	return DLQEntry{}, false, nil
+}
+
+func (s *Service) listDLQ(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	raw, err := s.redis.LRange(context.Background(), dlqKey(userID), 0, -1).Result()
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to read dead-letter queue")
+		return
+	}
+
+	entries := make([]DLQEntry, 0, len(raw))
+	for _, item := range raw {
+		var entry DLQEntry
+		if err := json.Unmarshal([]byte(item), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	s.jsonResponse(w, http.StatusOK, entries)
+}
+
+func (s *Service) retryDLQEntry(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	entryID := vars["entry_id"]
+
+	entry, found, err := s.findAndRemoveDLQEntry(userID, entryID)
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to read dead-letter queue")
+		return
+	}
+	if !found {
+		s.errorResponse(w, http.StatusNotFound, "Dead-letter entry not found")
+		return
+	}
+
+	if err := s.executeAction(r.Context(), entry.Action, userID, nil); err != nil {
+		entry.Attempts++
+		entry.Error = err.Error()
+		entry.CreatedAt = time.Now()
+		data, marshalErr := json.Marshal(entry)
+		if marshalErr == nil {
+			s.redis.RPush(context.Background(), dlqKey(userID), data)
+		}
+		s.errorResponse(w, http.StatusBadGateway, "Retry failed, re-queued: "+err.Error())
+		return
+	}
+
+	actionsExecuted.WithLabelValues(entry.Action.Type).Inc()
+	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "replayed"})
+}
+
+func (s *Service) deleteDLQEntry(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	entryID := vars["entry_id"]
+
+	_, found, err := s.findAndRemoveDLQEntry(userID, entryID)
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to read dead-letter queue")
+		return
+	}
+	if !found {
+		s.errorResponse(w, http.StatusNotFound, "Dead-letter entry not found")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func auditKey(userID string) string {
+	return "audit:" + userID
+}
+
+// writeAuditRecord appends a scenario execution's outcome to the user's audit
+// stream, capped to the most recent ~1000 entries. Failures are logged, not
+// returned, since a missed audit entry shouldn't affect scenario execution.
+func (s *Service) writeAuditRecord(ctx context.Context, scenario Scenario, trigger string, conditions []AuditCondition, actions []AuditAction) {
+	record := AuditRecord{
+		ScenarioID: scenario.ID,
+		TraceID:    traceIDFromContext(ctx),
+		Trigger:    trigger,
+		Conditions: conditions,
+		Actions:    actions,
+		Timestamp:  time.Now(),
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("Failed to marshal audit record: %v", err)
+		return
+	}
+
+	err = s.redis.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: auditKey(scenario.UserID),
+		MaxLen: 1000,
+		Approx: true,
+		Values: map[string]interface{}{"record": data},
+	}).Err()
+	if err != nil {
+		log.Printf("Failed to write audit record: %v", err)
+	}
+}
+
+// listExecutions returns the most recent audit records for one scenario. The
+// audit stream holds every scenario's executions for the user, so this
+// over-fetches and filters by scenario_id rather than keeping a
+// stream-per-scenario.
+func (s *Service) listExecutions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	scenarioID := vars["scenario_id"]
+
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	messages, err := s.redis.XRevRangeN(context.Background(), auditKey(userID), "+", "-", int64(limit*5)).Result()
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to read audit log")
+		return
+	}
+
+	records := make([]AuditRecord, 0, limit)
+	for _, msg := range messages {
+		raw, ok := msg.Values["record"].(string)
+		if !ok {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal([]byte(raw), &record); err != nil {
+			continue
+		}
+		if record.ScenarioID != scenarioID {
+			continue
+		}
+		records = append(records, record)
+		if len(records) >= limit {
+			break
+		}
+	}
+
+	s.jsonResponse(w, http.StatusOK, records)
+}
+
 func (s *Service) jsonResponse(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -678,7 +1631,14 @@ func main() {
 	}
 	defer service.redis.Close()
 
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		log.Printf("Tracing setup failed, continuing without it: %v", err)
+		shutdownTracing = func(context.Context) error { return nil }
+	}
+
 	service.SetupRoutes()
+	service.scheduler.Start()
 
 	server := &http.Server{
 		Addr:         ":" + config.Port,
@@ -694,12 +1654,17 @@ func main() {
 		<-sigChan
 
 		log.Println("Shutting down server...")
+		service.shutdown()
+		service.scheduler.Stop()
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
 		if err := server.Shutdown(ctx); err != nil {
 			log.Printf("Server shutdown error: %v", err)
 		}
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Tracing shutdown error: %v", err)
+		}
 	}()
 
 	log.Printf("Scenario Engine listening on port %s", config.Port)
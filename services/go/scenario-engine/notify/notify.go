@@ -0,0 +1,77 @@
+// Package notify fans a single notification out to one or more Shoutrrr
+// service URLs (discord://, slack://, smtp://, pushover://, gotify://, ...)
+// concurrently, reporting a per-URL result so a caller can tell which
+// channels actually delivered.
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containrrr/shoutrrr"
+	"github.com/containrrr/shoutrrr/pkg/types"
+	"golang.org/x/sync/errgroup"
+)
+
+// Message is a channel-agnostic notification; Title is passed through to
+// services that support it (Shoutrrr ignores it for the rest).
+type Message struct {
+	Title    string
+	Body     string
+	Priority int
+}
+
+// Result is the outcome of sending Message to one service URL.
+type Result struct {
+	URL string
+	Err error
+}
+
+// Send dispatches msg to every URL in urls concurrently, one Shoutrrr sender
+// per URL, and returns a Result per URL in the same order. A failure sending
+// to one URL doesn't stop the others. The returned error is non-nil (and
+// wraps every per-URL failure) only if every send failed.
+func Send(ctx context.Context, urls []string, msg Message) ([]Result, error) {
+	results := make([]Result, len(urls))
+
+	g, ctx := errgroup.WithContext(ctx)
+	for i, url := range urls {
+		i, url := i, url
+		g.Go(func() error {
+			results[i] = send(ctx, url, msg)
+			return nil
+		})
+	}
+	_ = g.Wait() // per-URL errors are captured in results, not returned here
+
+	failures := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failures++
+		}
+	}
+	if len(urls) > 0 && failures == len(urls) {
+		return results, fmt.Errorf("all %d notification service(s) failed, first error: %w", len(urls), results[0].Err)
+	}
+	return results, nil
+}
+
+func send(ctx context.Context, url string, msg Message) Result {
+	sender, err := shoutrrr.CreateSender(url)
+	if err != nil {
+		return Result{URL: url, Err: fmt.Errorf("invalid service url: %w", err)}
+	}
+
+	params := types.Params{}
+	if msg.Title != "" {
+		params["title"] = msg.Title
+	}
+
+	errs := sender.Send(msg.Body, &params)
+	for _, err := range errs {
+		if err != nil {
+			return Result{URL: url, Err: err}
+		}
+	}
+	return Result{URL: url}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+// Scheduler runs schedule-triggered scenarios on their cron expression. It
+// holds one cron.Cron entry per enabled schedule scenario, keyed by
+// "userID:scenarioID" so Rebuild can cleanly replace the whole set after any
+// scenario create/update/delete/enable/disable.
+type Scheduler struct {
+	cron    *cron.Cron
+	service *Service
+
+	mu      sync.Mutex
+	entries map[string]cron.EntryID
+}
+
+// NewScheduler creates a Scheduler for service. Call Start to begin firing.
+func NewScheduler(service *Service) *Scheduler {
+	return &Scheduler{
+		cron:    cron.New(),
+		service: service,
+		entries: make(map[string]cron.EntryID),
+	}
+}
+
+func (sch *Scheduler) Start() {
+	sch.cron.Start()
+}
+
+// Stop stops the underlying cron and waits for in-progress jobs to finish.
+func (sch *Scheduler) Stop() {
+	<-sch.cron.Stop().Done()
+}
+
+func scheduleKey(userID, scenarioID string) string {
+	return userID + ":" + scenarioID
+}
+
+// cronSpec builds the spec string for scenario's schedule trigger, prefixing
+// a CRON_TZ directive when the scenario has a timezone set so the schedule
+// fires on local wall-clock time rather than the server's.
+func cronSpec(scenario Scenario) string {
+	if scenario.Timezone == "" {
+		return scenario.Trigger.Schedule
+	}
+	return fmt.Sprintf("CRON_TZ=%s %s", scenario.Timezone, scenario.Trigger.Schedule)
+}
+
+// Rebuild tears down every registered cron entry and re-registers one per
+// enabled, schedule-triggered scenario in scenarios. It's meant to be called
+// after every scenario create/update/delete/enable/disable, since robfig/cron
+// has no update-in-place - replacing the whole set is simplest and cheap at
+// this scale.
+func (sch *Scheduler) Rebuild(scenarios map[string][]Scenario) {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	for _, id := range sch.entries {
+		sch.cron.Remove(id)
+	}
+	sch.entries = make(map[string]cron.EntryID)
+
+	for userID, list := range scenarios {
+		for _, scenario := range list {
+			if !scenario.Enabled || scenario.Trigger.Type != "schedule" || scenario.Trigger.Schedule == "" {
+				continue
+			}
+
+			scenario := scenario
+			id, err := sch.cron.AddFunc(cronSpec(scenario), func() {
+				sch.fire(scenario)
+			})
+			if err != nil {
+				log.Printf("Skipping invalid schedule for scenario %s: %v", scenario.ID, err)
+				continue
+			}
+			sch.entries[scheduleKey(userID, scenario.ID)] = id
+		}
+	}
+}
+
+// fire synthesizes a schedule EventPayload and runs it through the same
+// evaluate-conditions-then-execute path as a device-triggered event.
+func (sch *Scheduler) fire(scenario Scenario) {
+	ctx, span := startSpan(context.Background(), "scheduled_fire")
+	defer span.End()
+
+	event := EventPayload{
+		EventID:   uuid.New().String(),
+		UserID:    scenario.UserID,
+		EventType: "schedule",
+		Timestamp: time.Now(),
+	}
+
+	passed, conditionAudits := sch.service.evaluateConditionsWithAudit(ctx, scenario.Conditions, event, nil)
+	if !passed {
+		return
+	}
+
+	sch.service.executeScenario(ctx, scenario, &event, "schedule", conditionAudits)
+	scenariosTriggered.WithLabelValues(scenario.ID).Inc()
+}
+
+// NextRuns returns the next n scheduled fire times for scenario's cron
+// expression, for a UI to preview upcoming runs.
+func (sch *Scheduler) NextRuns(scenario Scenario, n int) ([]time.Time, error) {
+	schedule, err := cron.ParseStandard(cronSpec(scenario))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+
+	runs := make([]time.Time, 0, n)
+	t := time.Now()
+	for i := 0; i < n; i++ {
+		t = schedule.Next(t)
+		runs = append(runs, t)
+	}
+	return runs, nil
+}
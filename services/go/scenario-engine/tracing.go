@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is used by every instrumented call site. setupTracing replaces it
+// with a real one; until then (or if tracing is disabled) it stays the
+// package-level no-op tracer returned by otel.Tracer.
+var tracer = otel.Tracer("github.com/homeguard/scenario-engine")
+
+// setupTracing configures the global TracerProvider and W3C trace context
+// propagator from OTEL_* environment variables, choosing the OTLP exporter
+// protocol the same way Dapr's runtime does: OTEL_EXPORTER_OTLP_PROTOCOL is
+// "grpc" or "http/protobuf" (default "grpc"), pointed at
+// OTEL_EXPORTER_OTLP_ENDPOINT. If the endpoint is unset, tracing stays a
+// no-op and the returned shutdown func does nothing.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	endpoint := getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newOTLPExporter(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(newTracingResource()),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	tracer = otel.Tracer("github.com/homeguard/scenario-engine")
+
+	return tp.Shutdown, nil
+}
+
+func newTracingResource() *resource.Resource {
+	r, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(semconv.ServiceName(getEnv("OTEL_SERVICE_NAME", "scenario-engine"))),
+	)
+	if err != nil {
+		log.Printf("Failed to build tracing resource, using default: %v", err)
+		return resource.Default()
+	}
+	return r
+}
+
+func newOTLPExporter(ctx context.Context, endpoint string) (*otlptrace.Exporter, error) {
+	protocol := getEnv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+
+	switch protocol {
+	case "http/protobuf":
+		client := otlptracehttp.NewClient(
+			otlptracehttp.WithEndpoint(endpoint),
+			otlptracehttp.WithInsecure(),
+		)
+		return otlptrace.New(ctx, client)
+	default:
+		client := otlptracegrpc.NewClient(
+			otlptracegrpc.WithEndpoint(endpoint),
+			otlptracegrpc.WithInsecure(),
+		)
+		return otlptrace.New(ctx, client)
+	}
+}
+
+// startSpan is a small convenience wrapper so call sites don't each import
+// go.opentelemetry.io/otel/trace just to spell out span options.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name)
+}
+
+// traceIDFromContext returns the hex trace ID of ctx's active span, or ""
+// if there isn't one (e.g. tracing disabled).
+func traceIDFromContext(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// detachContext carries ctx's span context onto a fresh background context,
+// so a handoff to a goroutine (scenario execution after an HTTP handler
+// returns) keeps its trace ID without inheriting the request context's
+// cancellation.
+func detachContext(ctx context.Context) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+}
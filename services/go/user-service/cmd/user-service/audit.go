@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/homeguard/user-service/pkg/audit"
+	"github.com/homeguard/user-service/pkg/auth"
+)
+
+var auditEventsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "audit_events_total",
+		Help: "Total number of audit events recorded, by event type",
+	},
+	[]string{"event"},
+)
+
+func init() {
+	prometheus.MustRegister(auditEventsTotal)
+}
+
+// audit records a security-relevant event: eventType is one of the
+// "user.registered", "token.revoked"-style names in docs/events.md; target is
+// the user_id the event is about, which may differ from the caller (e.g. an
+// admin deleting another user) or be empty. meta is stored as-is in the jsonb
+// metadata column. The actor and client IP are read off r, so the webhook
+// and query API can attribute every event to a request.
+func (s *Service) audit(r *http.Request, eventType, target string, meta map[string]interface{}) {
+	var actorUserID string
+	if claims := auth.ClaimsFromContext(r.Context()); claims != nil {
+		actorUserID = claims.UserID
+	}
+
+	event := &audit.Event{
+		ActorUserID:  actorUserID,
+		ActorIP:      clientIP(r),
+		EventType:    eventType,
+		TargetUserID: target,
+		Metadata:     meta,
+	}
+
+	if err := s.auditLog.Record(event); err != nil {
+		log.Printf("Error recording audit event %q: %v", eventType, err)
+		return
+	}
+
+	auditEventsTotal.WithLabelValues(eventType).Inc()
+
+	if s.config.AuditWebhookURL != "" {
+		go s.forwardAuditWebhook(event)
+	}
+}
+
+// forwardAuditWebhook best-effort POSTs event as JSON to the configured
+// webhook URL so a downstream SIEM can subscribe to audit activity.
+func (s *Service) forwardAuditWebhook(event *audit.Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling audit webhook payload: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.AuditWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Error building audit webhook request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("Error delivering audit webhook: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Printf("Audit webhook returned status %d", resp.StatusCode)
+	}
+}
+
+// adminListAuditEvents serves GET /admin/audit, restricted to role=admin,
+// with keyset pagination on (ts, id) via cursor.
+func (s *Service) adminListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter := audit.Filter{
+		UserID: q.Get("user_id"),
+		Event:  q.Get("event"),
+	}
+
+	if since := q.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			s.errorResponse(w, http.StatusBadRequest, "Invalid since timestamp, expected RFC3339")
+			return
+		}
+		filter.Since = t
+	}
+	if until := q.Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			s.errorResponse(w, http.StatusBadRequest, "Invalid until timestamp, expected RFC3339")
+			return
+		}
+		filter.Until = t
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			s.errorResponse(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		filter.Limit = n
+	}
+	if cursor := q.Get("cursor"); cursor != "" {
+		ts, id, err := decodeAuditCursor(cursor)
+		if err != nil {
+			s.errorResponse(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		filter.CursorTS = ts
+		filter.CursorID = id
+	}
+
+	page, err := s.auditLog.List(filter)
+	if err != nil {
+		log.Printf("Error listing audit events: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to list audit events")
+		return
+	}
+
+	resp := map[string]interface{}{"events": page.Events}
+	if !page.NextCursorTS.IsZero() {
+		resp["next_cursor"] = encodeAuditCursor(page.NextCursorTS, page.NextCursorID)
+	}
+	s.jsonResponse(w, http.StatusOK, resp)
+}
+
+// encodeAuditCursor/decodeAuditCursor round-trip the (ts, id) keyset cursor
+// through an opaque string so callers don't need to know its format.
+func encodeAuditCursor(ts time.Time, id string) string {
+	return ts.Format(time.RFC3339Nano) + "_" + id
+}
+
+func decodeAuditCursor(cursor string) (time.Time, string, error) {
+	idx := strings.LastIndex(cursor, "_")
+	if idx < 0 {
+		return time.Time{}, "", fmt.Errorf("malformed cursor")
+	}
+	ts, err := time.Parse(time.RFC3339Nano, cursor[:idx])
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	return ts, cursor[idx+1:], nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// loginLockoutSchedule maps a consecutive-failure threshold to the lockout
+// duration applied once that threshold is reached, giving increasingly long
+// cooldowns for a persistently brute-forced account.
+var loginLockoutSchedule = []struct {
+	threshold int
+	duration  time.Duration
+}{
+	{5, time.Minute},
+	{10, 15 * time.Minute},
+	{20, 24 * time.Hour},
+}
+
+// lockoutDurationFor returns the lockout duration for a given consecutive
+// failure count, or zero if failedCount hasn't reached the first threshold.
+func lockoutDurationFor(failedCount int) time.Duration {
+	var dur time.Duration
+	for _, tier := range loginLockoutSchedule {
+		if failedCount >= tier.threshold {
+			dur = tier.duration
+		}
+	}
+	return dur
+}
+
+// checkAccountLock reports whether email is currently locked out, and for
+// how much longer.
+func (s *Service) checkAccountLock(email string) (bool, time.Duration, error) {
+	var lockedUntil sql.NullTime
+	query := `SELECT locked_until FROM login_attempts WHERE email = $1`
+	err := s.db.QueryRow(query, email).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	if lockedUntil.Valid && lockedUntil.Time.After(time.Now()) {
+		return true, time.Until(lockedUntil.Time), nil
+	}
+	return false, 0, nil
+}
+
+// recordLoginFailure increments email's consecutive failure count and, once
+// it crosses a lockoutDurationFor threshold, locks the account out for the
+// matching duration.
+func (s *Service) recordLoginFailure(email string) {
+	authLoginFailures.Inc()
+
+	var failedCount int
+	query := `
+		INSERT INTO login_attempts (email, failed_count, last_attempt)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (email) DO UPDATE
+		SET failed_count = login_attempts.failed_count + 1, last_attempt = NOW()
+		RETURNING failed_count`
+	if err := s.db.QueryRow(query, email).Scan(&failedCount); err != nil {
+		log.Printf("Error recording login failure: %v", err)
+		return
+	}
+
+	if lockDuration := lockoutDurationFor(failedCount); lockDuration > 0 {
+		query := `UPDATE login_attempts SET locked_until = $1 WHERE email = $2`
+		if _, err := s.db.Exec(query, time.Now().Add(lockDuration), email); err != nil {
+			log.Printf("Error locking account: %v", err)
+		}
+	}
+}
+
+// resetLoginAttempts clears email's failure count after a successful login.
+func (s *Service) resetLoginAttempts(email string) {
+	if _, err := s.db.Exec(`DELETE FROM login_attempts WHERE email = $1`, email); err != nil {
+		log.Printf("Error resetting login attempts: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+)
+
+// Mailer sends transactional email. SMTPMailer is the production
+// implementation; NoopMailer discards every message, for environments with
+// no SMTP relay configured.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// SMTPMailer sends mail through a standard SMTP relay using PLAIN auth.
+type SMTPMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+// NewSMTPMailer builds an SMTPMailer. Send dials host:port fresh per call,
+// matching net/smtp.SendMail's one-shot connection model.
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{host: host, port: port, username: username, password: password, from: from}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	addr := fmt.Sprintf("%s:%s", m.host, m.port)
+	auth := smtp.PlainAuth("", m.username, m.password, m.host)
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", m.from, to, subject, body)
+	return smtp.SendMail(addr, auth, m.from, []string{to}, []byte(msg))
+}
+
+// NoopMailer discards every message without error. Used when SMTP isn't
+// configured (local development, tests).
+type NoopMailer struct{}
+
+func (NoopMailer) Send(ctx context.Context, to, subject, body string) error {
+	return nil
+}
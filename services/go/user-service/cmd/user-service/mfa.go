@@ -0,0 +1,435 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	qrcode "github.com/skip2/go-qrcode"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/homeguard/user-service/pkg/auth"
+	"github.com/homeguard/user-service/pkg/users"
+)
+
+const (
+	totpDigits         = 6
+	totpModulus        = 1000000
+	totpPeriod         = 30 * time.Second
+	totpSkewSteps      = 1
+	mfaTokenExpiry     = 5 * time.Minute
+	mfaTokenIssuer     = "homeguard-mfa"
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 5 // raw bytes, base32-encoded into an 8-char code
+)
+
+var base32Enc = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFAClaims are the claims of the short-lived token returned by login in
+// place of an AuthResponse when the user has confirmed TOTP 2FA. It carries
+// no role/email since it's only good for completing the 2FA challenge.
+type MFAClaims struct {
+	UserID string `json:"user_id"`
+	jwt.RegisteredClaims
+}
+
+func (s *Service) generateMFAToken(user *users.User) (string, error) {
+	claims := &MFAClaims{
+		UserID: user.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(mfaTokenExpiry)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    mfaTokenIssuer,
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(s.config.JWTSecret))
+}
+
+func (s *Service) parseMFAToken(tokenString string) (string, error) {
+	claims := &MFAClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(s.config.JWTSecret), nil
+	})
+	if err != nil || !token.Valid || claims.Issuer != mfaTokenIssuer {
+		return "", fmt.Errorf("invalid or expired mfa token")
+	}
+	return claims.UserID, nil
+}
+
+// generateTOTPSecret returns a new random base32-encoded TOTP secret.
+func generateTOTPSecret() (string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+	return base32Enc.EncodeToString(raw), nil
+}
+
+// totpProvisioningURI builds the otpauth:// URI that authenticator apps
+// consume, either typed in manually or via the enrollment QR code.
+func totpProvisioningURI(email, secret string) string {
+	v := url.Values{
+		"secret":    {secret},
+		"issuer":    {"HomeGuard"},
+		"algorithm": {"SHA1"},
+		"digits":    {strconv.Itoa(totpDigits)},
+		"period":    {strconv.Itoa(int(totpPeriod.Seconds()))},
+	}
+	label := url.PathEscape("HomeGuard:" + email)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, v.Encode())
+}
+
+// totpQRCodePNG renders the provisioning URI as a PNG QR code image.
+func totpQRCodePNG(uri string) ([]byte, error) {
+	return qrcode.Encode(uri, qrcode.Medium, 256)
+}
+
+// totpCodeAt computes the RFC 6238 TOTP code for secret at time t.
+func totpCodeAt(secret string, t time.Time) (string, error) {
+	key, err := base32Enc.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid totp secret: %w", err)
+	}
+
+	counter := uint64(t.Unix()) / uint64(totpPeriod.Seconds())
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(buf)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	truncated := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	code := truncated % totpModulus
+
+	return fmt.Sprintf("%0*d", totpDigits, code), nil
+}
+
+// validateTOTPCode checks code against secret at the current time step and
+// the steps immediately before/after, to tolerate clock drift between the
+// server and the user's authenticator app.
+func validateTOTPCode(secret, code string) bool {
+	now := time.Now()
+	for skew := -totpSkewSteps; skew <= totpSkewSteps; skew++ {
+		want, err := totpCodeAt(secret, now.Add(time.Duration(skew)*totpPeriod))
+		if err != nil {
+			return false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// generateRecoveryCodes returns n fresh plaintext recovery codes, formatted
+// as two dash-separated groups to make them easier to transcribe by hand.
+func generateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		raw := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		encoded := base32Enc.EncodeToString(raw)
+		codes[i] = fmt.Sprintf("%s-%s", encoded[:4], encoded[4:8])
+	}
+	return codes, nil
+}
+
+// has2FAEnabled reports whether userID has a confirmed TOTP secret, i.e.
+// whether login must route them through the 2FA challenge.
+func (s *Service) has2FAEnabled(userID string) bool {
+	var confirmed bool
+	query := `SELECT confirmed_at IS NOT NULL FROM user_totp WHERE user_id = $1`
+	if err := s.db.QueryRow(query, userID).Scan(&confirmed); err != nil {
+		return false
+	}
+	return confirmed
+}
+
+// enroll2FA starts (or restarts) TOTP enrollment for the current user,
+// returning a provisioning URI and matching QR code. The secret isn't active
+// until confirmed via verify2FA.
+func (s *Service) enroll2FA(w http.ResponseWriter, r *http.Request) {
+	claims := auth.ClaimsFromContext(r.Context())
+	if claims == nil {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	userID := claims.UserID
+
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		s.errorResponse(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating totp secret: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to start 2FA enrollment")
+		return
+	}
+
+	query := `INSERT INTO user_totp (user_id, secret, confirmed_at)
+	          VALUES ($1, $2, NULL)
+	          ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, confirmed_at = NULL`
+	if _, err := s.db.Exec(query, userID, secret); err != nil {
+		log.Printf("Error storing totp secret: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to start 2FA enrollment")
+		return
+	}
+
+	uri := totpProvisioningURI(user.Email, secret)
+	png, err := totpQRCodePNG(uri)
+	if err != nil {
+		log.Printf("Error generating totp qr code: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to start 2FA enrollment")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"provisioning_uri": uri,
+		"qr_code_png":      base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// verify2FA confirms a pending TOTP enrollment. On first confirmation it
+// also mints a fresh set of recovery codes, returned once in plaintext.
+func (s *Service) verify2FA(w http.ResponseWriter, r *http.Request) {
+	claims := auth.ClaimsFromContext(r.Context())
+	if claims == nil {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	userID := claims.UserID
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var secret string
+	var confirmedAt sql.NullTime
+	query := `SELECT secret, confirmed_at FROM user_totp WHERE user_id = $1`
+	if err := s.db.QueryRow(query, userID).Scan(&secret, &confirmedAt); err != nil {
+		if err == sql.ErrNoRows {
+			s.errorResponse(w, http.StatusBadRequest, "2FA enrollment not started")
+			return
+		}
+		log.Printf("Error loading totp secret: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to verify 2FA")
+		return
+	}
+
+	if !validateTOTPCode(secret, req.Code) {
+		s.errorResponse(w, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+
+	if confirmedAt.Valid {
+		s.jsonResponse(w, http.StatusOK, map[string]interface{}{"confirmed": true})
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to confirm 2FA")
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE user_totp SET confirmed_at = NOW() WHERE user_id = $1`, userID); err != nil {
+		log.Printf("Error confirming totp: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to confirm 2FA")
+		return
+	}
+
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to confirm 2FA")
+		return
+	}
+
+	for _, code := range codes {
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			log.Printf("Error hashing recovery code: %v", err)
+			s.errorResponse(w, http.StatusInternalServerError, "Failed to confirm 2FA")
+			return
+		}
+		if _, err := tx.Exec(`INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, string(hash)); err != nil {
+			log.Printf("Error storing recovery code: %v", err)
+			s.errorResponse(w, http.StatusInternalServerError, "Failed to confirm 2FA")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to confirm 2FA")
+		return
+	}
+
+	s.audit(r, "2fa.enrolled", userID, nil)
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"confirmed":      true,
+		"recovery_codes": codes,
+	})
+}
+
+// disable2FA removes the user's TOTP secret and any unused recovery codes.
+func (s *Service) disable2FA(w http.ResponseWriter, r *http.Request) {
+	claims := auth.ClaimsFromContext(r.Context())
+	if claims == nil {
+		s.errorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	userID := claims.UserID
+
+	if _, err := s.db.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		log.Printf("Error disabling 2fa: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to disable 2FA")
+		return
+	}
+	if _, err := s.db.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		log.Printf("Error deleting recovery codes: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to disable 2FA")
+		return
+	}
+
+	s.audit(r, "2fa.disabled", userID, nil)
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{"disabled": true})
+}
+
+// challenge2FA completes a login that login paused for 2FA: it validates
+// the mfa_pending token plus either a TOTP code or a recovery code, then
+// issues the same AuthResponse a password-only login would.
+func (s *Service) challenge2FA(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	userID, err := s.parseMFAToken(req.MFAToken)
+	if err != nil {
+		s.errorResponse(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to complete login")
+		return
+	}
+
+	// A valid password already got the caller this far, so the TOTP/recovery
+	// code is the only thing standing between them and the account - lock it
+	// out on repeated failures the same as a brute-forced password, or an
+	// attacker could grind all 1,000,000 TOTP codes against this endpoint.
+	locked, retryAfter, err := s.checkAccountLock(user.Email)
+	if err != nil {
+		log.Printf("Error checking account lock: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to complete login")
+		return
+	}
+	if locked {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		s.errorResponse(w, http.StatusTooManyRequests, "Account temporarily locked due to repeated failed logins")
+		return
+	}
+
+	ok := false
+	switch {
+	case req.Code != "":
+		var secret string
+		query := `SELECT secret FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL`
+		if err := s.db.QueryRow(query, userID).Scan(&secret); err == nil {
+			ok = validateTOTPCode(secret, req.Code)
+		}
+	case req.RecoveryCode != "":
+		ok = s.consumeRecoveryCode(userID, req.RecoveryCode)
+	}
+
+	if !ok {
+		s.recordLoginFailure(user.Email)
+		s.errorResponse(w, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+	s.resetLoginAttempts(user.Email)
+
+	token, refreshToken, err := s.generateTokens(user)
+	if err != nil {
+		log.Printf("Error generating tokens: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to generate tokens")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.config.JWTExpiry.Seconds()),
+		User:         user,
+	})
+}
+
+// consumeRecoveryCode marks a matching, unused recovery code as used and
+// reports whether one was found. Recovery codes are single-use.
+func (s *Service) consumeRecoveryCode(userID, code string) bool {
+	rows, err := s.db.Query(`SELECT id, code_hash FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		log.Printf("Error loading recovery codes: %v", err)
+		return false
+	}
+	defer rows.Close()
+
+	var matchedID string
+	for rows.Next() {
+		var id, hash string
+		if err := rows.Scan(&id, &hash); err != nil {
+			continue
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(code)) == nil {
+			matchedID = id
+			break
+		}
+	}
+	if matchedID == "" {
+		return false
+	}
+
+	if _, err := s.db.Exec(`UPDATE user_recovery_codes SET used_at = NOW() WHERE id = $1`, matchedID); err != nil {
+		log.Printf("Error marking recovery code used: %v", err)
+		return false
+	}
+	return true
+}
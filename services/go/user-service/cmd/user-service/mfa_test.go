@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238TestSecret is the base32 encoding of the RFC 6238 Appendix B test
+// seed ("12345678901234567890" ASCII, SHA1 mode).
+const rfc6238TestSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTotpCodeAtMatchesRFC6238Vector(t *testing.T) {
+	// RFC 6238's SHA1 test vector at T=59s is the 8-digit HOTP 94287082;
+	// this package truncates to 6 digits, which is that value's low 6
+	// digits since both just take the last d digits of the same HOTP value.
+	got, err := totpCodeAt(rfc6238TestSecret, time.Unix(59, 0))
+	if err != nil {
+		t.Fatalf("totpCodeAt: %v", err)
+	}
+	if want := "287082"; got != want {
+		t.Errorf("totpCodeAt at T=59 = %q, want %q", got, want)
+	}
+}
+
+func TestTotpCodeAtChangesPerPeriod(t *testing.T) {
+	a, err := totpCodeAt(rfc6238TestSecret, time.Unix(0, 0))
+	if err != nil {
+		t.Fatalf("totpCodeAt: %v", err)
+	}
+	b, err := totpCodeAt(rfc6238TestSecret, time.Unix(int64(totpPeriod.Seconds()), 0))
+	if err != nil {
+		t.Fatalf("totpCodeAt: %v", err)
+	}
+	if a == b {
+		t.Errorf("totpCodeAt produced the same code in two different 30s periods: %q", a)
+	}
+
+	// Within the same period the code must be stable.
+	c, err := totpCodeAt(rfc6238TestSecret, time.Unix(1, 0))
+	if err != nil {
+		t.Fatalf("totpCodeAt: %v", err)
+	}
+	if a != c {
+		t.Errorf("totpCodeAt(t=0)=%q and totpCodeAt(t=1)=%q should match within the same period", a, c)
+	}
+}
+
+func TestTotpCodeAtRejectsInvalidSecret(t *testing.T) {
+	if _, err := totpCodeAt("not valid base32!!", time.Unix(0, 0)); err == nil {
+		t.Error("totpCodeAt with an invalid secret = nil error, want an error")
+	}
+}
+
+func TestValidateTOTPCodeTolerantOfClockSkew(t *testing.T) {
+	now := time.Now()
+	prevStep, err := totpCodeAt(rfc6238TestSecret, now.Add(-totpPeriod))
+	if err != nil {
+		t.Fatalf("totpCodeAt: %v", err)
+	}
+
+	if !validateTOTPCode(rfc6238TestSecret, prevStep) {
+		t.Error("validateTOTPCode rejected a code from the immediately preceding time step")
+	}
+}
+
+func TestValidateTOTPCodeRejectsWrongCode(t *testing.T) {
+	if validateTOTPCode(rfc6238TestSecret, "000000") {
+		t.Error("validateTOTPCode accepted an arbitrary wrong code")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/lib/pq"
+
+	"github.com/homeguard/user-service/pkg/config"
+	"github.com/homeguard/user-service/pkg/migrate"
+)
+
+// runMigrateCLI implements the `user-service migrate {up,down,status,create}`
+// subcommand so operators can run migrations out-of-band instead of relying
+// on NewService running them at boot.
+func runMigrateCLI(args []string) {
+	if len(args) == 0 {
+		log.Fatal("usage: user-service migrate {up,down,status,create} [args]")
+	}
+
+	if args[0] == "create" {
+		if len(args) < 2 {
+			log.Fatal("usage: user-service migrate create <name>")
+		}
+		if err := migrate.Create(args[1]); err != nil {
+			log.Fatalf("migrate create: %v", err)
+		}
+		return
+	}
+
+	cfg := config.Load()
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		err = migrate.Up(db)
+	case "down":
+		err = migrate.Down(db)
+	case "status":
+		err = migrate.Status(db)
+	default:
+		log.Fatalf("unknown migrate subcommand %q", args[0])
+	}
+	if err != nil {
+		log.Fatalf("migrate %s: %v", args[0], err)
+	}
+}
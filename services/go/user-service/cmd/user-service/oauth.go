@@ -0,0 +1,525 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/homeguard/user-service/pkg/users"
+)
+
+// oauthStateCookie is the short-lived cookie that carries the CSRF state
+// value between /auth/oauth/{provider}/login and its callback.
+const oauthStateCookie = "homeguard_oauth_state"
+const oauthStateTTL = 10 * time.Minute
+
+// OAuthProviderConfig is one entry of the OAUTH_PROVIDERS JSON config,
+// letting operators enable and configure social login providers without
+// recompiling the service.
+type OAuthProviderConfig struct {
+	// Name identifies the provider in routes and the identities table, e.g.
+	// "google". Type selects the implementation ("google", "github", or
+	// "oidc" for a generic OpenID Connect provider); Name and Type are
+	// usually the same except when running more than one OIDC provider.
+	Name                 string   `json:"name"`
+	Type                 string   `json:"type"`
+	ClientID             string   `json:"client_id"`
+	ClientSecret         string   `json:"client_secret"`
+	RedirectURL          string   `json:"redirect_url"`
+	Scopes               []string `json:"scopes,omitempty"`
+	DiscoveryURL         string   `json:"discovery_url,omitempty"`
+	AllowedHostedDomains []string `json:"allowed_hosted_domains,omitempty"`
+}
+
+// OAuthIdentity is what a provider's callback resolves an authorization code
+// into: the user's identity at the provider, plus the tokens issued for it.
+type OAuthIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	AccessToken   string
+	RefreshToken  string
+	ExpiresAt     time.Time
+}
+
+// OAuthProvider is one configured social login provider.
+type OAuthProvider interface {
+	Name() string
+	AuthCodeURL(state string) string
+	Exchange(ctx context.Context, code string) (*OAuthIdentity, error)
+}
+
+// tokenResponse is the OAuth2 token endpoint's JSON response, shared by
+// Google, GitHub (with an Accept: application/json request), and standard
+// OIDC providers.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// oauth2Provider implements OAuthProvider for any standard
+// authorization-code OAuth2 flow. userInfo does the provider-specific work
+// of turning an access token into an OAuthIdentity, so Google/GitHub/OIDC
+// only differ in their endpoints and userInfo implementation.
+type oauth2Provider struct {
+	name         string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	authURL      string
+	tokenURL     string
+	httpClient   *http.Client
+	userInfo     func(ctx context.Context, client *http.Client, tok *tokenResponse) (*OAuthIdentity, error)
+}
+
+func (p *oauth2Provider) Name() string { return p.name }
+
+func (p *oauth2Provider) AuthCodeURL(state string) string {
+	v := url.Values{
+		"client_id":     {p.clientID},
+		"redirect_uri":  {p.redirectURL},
+		"response_type": {"code"},
+		"scope":         {strings.Join(p.scopes, " ")},
+		"state":         {state},
+	}
+	return p.authURL + "?" + v.Encode()
+}
+
+func (p *oauth2Provider) Exchange(ctx context.Context, code string) (*OAuthIdentity, error) {
+	form := url.Values{
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+		"redirect_uri":  {p.redirectURL},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var tok tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	identity, err := p.userInfo(ctx, p.httpClient, &tok)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user info: %w", err)
+	}
+
+	identity.AccessToken = tok.AccessToken
+	identity.RefreshToken = tok.RefreshToken
+	if tok.ExpiresIn > 0 {
+		identity.ExpiresAt = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	}
+	return identity, nil
+}
+
+// fetchJSON GETs url with a bearer token and decodes the JSON response into
+// out, used by every provider's userInfo to call its userinfo/profile API.
+func fetchJSON(ctx context.Context, client *http.Client, url, accessToken string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request to %s returned status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func scopesOrDefault(configured, fallback []string) []string {
+	if len(configured) > 0 {
+		return configured
+	}
+	return fallback
+}
+
+// newGoogleProvider builds the Google OIDC provider. If cfg.AllowedHostedDomains
+// is non-empty, sign-in is restricted to Google Workspace accounts in one of
+// those domains.
+func newGoogleProvider(cfg OAuthProviderConfig) *oauth2Provider {
+	allowedDomains := make(map[string]bool, len(cfg.AllowedHostedDomains))
+	for _, d := range cfg.AllowedHostedDomains {
+		allowedDomains[d] = true
+	}
+
+	return &oauth2Provider{
+		name:         cfg.Name,
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		redirectURL:  cfg.RedirectURL,
+		scopes:       scopesOrDefault(cfg.Scopes, []string{"openid", "email", "profile"}),
+		authURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		tokenURL:     "https://oauth2.googleapis.com/token",
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		userInfo: func(ctx context.Context, client *http.Client, tok *tokenResponse) (*OAuthIdentity, error) {
+			var info struct {
+				Sub           string `json:"sub"`
+				Email         string `json:"email"`
+				EmailVerified bool   `json:"email_verified"`
+				Name          string `json:"name"`
+				HD            string `json:"hd"`
+			}
+			if err := fetchJSON(ctx, client, "https://openidconnect.googleapis.com/v1/userinfo", tok.AccessToken, &info); err != nil {
+				return nil, err
+			}
+			if len(allowedDomains) > 0 && !allowedDomains[info.HD] {
+				return nil, fmt.Errorf("hosted domain %q is not allowed", info.HD)
+			}
+			return &OAuthIdentity{
+				Subject:       info.Sub,
+				Email:         info.Email,
+				EmailVerified: info.EmailVerified,
+				Name:          info.Name,
+			}, nil
+		},
+	}
+}
+
+// newGitHubProvider builds the GitHub provider. GitHub doesn't always return
+// a public email on /user, so userInfo falls back to the verified primary
+// address from /user/emails.
+func newGitHubProvider(cfg OAuthProviderConfig) *oauth2Provider {
+	return &oauth2Provider{
+		name:         cfg.Name,
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		redirectURL:  cfg.RedirectURL,
+		scopes:       scopesOrDefault(cfg.Scopes, []string{"read:user", "user:email"}),
+		authURL:      "https://github.com/login/oauth/authorize",
+		tokenURL:     "https://github.com/login/oauth/access_token",
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		userInfo: func(ctx context.Context, client *http.Client, tok *tokenResponse) (*OAuthIdentity, error) {
+			var user struct {
+				ID    int64  `json:"id"`
+				Login string `json:"login"`
+				Name  string `json:"name"`
+				Email string `json:"email"`
+			}
+			if err := fetchJSON(ctx, client, "https://api.github.com/user", tok.AccessToken, &user); err != nil {
+				return nil, err
+			}
+
+			email, verified := user.Email, user.Email != ""
+			if !verified {
+				var emails []struct {
+					Email    string `json:"email"`
+					Primary  bool   `json:"primary"`
+					Verified bool   `json:"verified"`
+				}
+				if err := fetchJSON(ctx, client, "https://api.github.com/user/emails", tok.AccessToken, &emails); err == nil {
+					for _, e := range emails {
+						if e.Primary && e.Verified {
+							email, verified = e.Email, true
+							break
+						}
+					}
+				}
+			}
+			if email == "" {
+				return nil, fmt.Errorf("github account has no accessible email")
+			}
+
+			name := user.Name
+			if name == "" {
+				name = user.Login
+			}
+			return &OAuthIdentity{
+				Subject:       strconv.FormatInt(user.ID, 10),
+				Email:         email,
+				EmailVerified: verified,
+				Name:          name,
+			}, nil
+		},
+	}
+}
+
+// oidcDiscovery is the subset of a standard OIDC discovery document
+// (.well-known/openid-configuration) newOIDCProvider needs.
+type oidcDiscovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// newOIDCProvider builds a generic OIDC provider by fetching its discovery
+// document once at startup, so operators can point HomeGuard at any
+// standards-compliant identity provider (Okta, Keycloak, Auth0, ...) without
+// a dedicated implementation.
+func newOIDCProvider(cfg OAuthProviderConfig) (*oauth2Provider, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	resp, err := client.Get(cfg.DiscoveryURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch oidc discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var doc oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode oidc discovery document: %w", err)
+	}
+
+	return &oauth2Provider{
+		name:         cfg.Name,
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		redirectURL:  cfg.RedirectURL,
+		scopes:       scopesOrDefault(cfg.Scopes, []string{"openid", "email", "profile"}),
+		authURL:      doc.AuthorizationEndpoint,
+		tokenURL:     doc.TokenEndpoint,
+		httpClient:   client,
+		userInfo: func(ctx context.Context, client *http.Client, tok *tokenResponse) (*OAuthIdentity, error) {
+			var info struct {
+				Sub           string `json:"sub"`
+				Email         string `json:"email"`
+				EmailVerified bool   `json:"email_verified"`
+				Name          string `json:"name"`
+			}
+			if err := fetchJSON(ctx, client, doc.UserinfoEndpoint, tok.AccessToken, &info); err != nil {
+				return nil, err
+			}
+			return &OAuthIdentity{
+				Subject:       info.Sub,
+				Email:         info.Email,
+				EmailVerified: info.EmailVerified,
+				Name:          info.Name,
+			}, nil
+		},
+	}, nil
+}
+
+// loadOAuthProviders parses the OAUTH_PROVIDERS JSON config into a registry
+// keyed by provider name. A provider that fails to configure (e.g. an OIDC
+// discovery fetch failure) is logged and skipped rather than failing
+// service startup, so one bad provider config doesn't take down password
+// login or the other providers.
+func loadOAuthProviders(rawConfig string) map[string]OAuthProvider {
+	providers := make(map[string]OAuthProvider)
+	if rawConfig == "" {
+		return providers
+	}
+
+	var configs []OAuthProviderConfig
+	if err := json.Unmarshal([]byte(rawConfig), &configs); err != nil {
+		log.Printf("Error parsing OAUTH_PROVIDERS: %v", err)
+		return providers
+	}
+
+	for _, cfg := range configs {
+		var provider OAuthProvider
+		var err error
+
+		switch cfg.Type {
+		case "google":
+			provider = newGoogleProvider(cfg)
+		case "github":
+			provider = newGitHubProvider(cfg)
+		case "oidc":
+			provider, err = newOIDCProvider(cfg)
+		default:
+			err = fmt.Errorf("unknown provider type %q", cfg.Type)
+		}
+
+		if err != nil {
+			log.Printf("Error configuring OAuth provider %q: %v", cfg.Name, err)
+			continue
+		}
+		providers[cfg.Name] = provider
+	}
+
+	return providers
+}
+
+// oauthLogin redirects the browser to the provider's authorization URL,
+// stashing a CSRF state value in a short-lived cookie for the callback to
+// verify.
+func (s *Service) oauthLogin(w http.ResponseWriter, r *http.Request) {
+	providerName := mux.Vars(r)["provider"]
+	provider, ok := s.oauthProviders[providerName]
+	if !ok {
+		s.errorResponse(w, http.StatusNotFound, "Unknown OAuth provider")
+		return
+	}
+
+	state := uuid.New().String()
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/auth/oauth/" + providerName,
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, provider.AuthCodeURL(state), http.StatusFound)
+}
+
+// oauthCallback exchanges the authorization code for an identity, upserts
+// the corresponding user, and issues the same AuthResponse the password
+// login flow issues.
+func (s *Service) oauthCallback(w http.ResponseWriter, r *http.Request) {
+	providerName := mux.Vars(r)["provider"]
+	provider, ok := s.oauthProviders[providerName]
+	if !ok {
+		s.errorResponse(w, http.StatusNotFound, "Unknown OAuth provider")
+		return
+	}
+
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil || cookie.Value == "" || cookie.Value != r.URL.Query().Get("state") {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid or expired OAuth state")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Value: "", Path: "/auth/oauth/" + providerName, MaxAge: -1})
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		s.errorResponse(w, http.StatusBadRequest, "Missing authorization code")
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), code)
+	if err != nil {
+		log.Printf("OAuth exchange failed for provider %s: %v", providerName, err)
+		s.errorResponse(w, http.StatusUnauthorized, "OAuth authentication failed")
+		return
+	}
+	if identity.Email == "" || !identity.EmailVerified {
+		s.errorResponse(w, http.StatusUnauthorized, "OAuth provider did not return a verified email")
+		return
+	}
+
+	user, err := s.upsertOAuthUser(providerName, identity)
+	if err != nil {
+		log.Printf("Error upserting OAuth user: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to complete OAuth login")
+		return
+	}
+
+	token, refreshToken, err := s.generateTokens(user)
+	if err != nil {
+		log.Printf("Error generating tokens: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to generate tokens")
+		return
+	}
+
+	s.audit(r, "oauth.linked", user.ID, map[string]interface{}{"provider": providerName})
+
+	s.jsonResponse(w, http.StatusOK, AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.config.JWTExpiry.Seconds()),
+		User:         user,
+	})
+}
+
+// upsertOAuthUser links identity to a user: an existing identity's user, or
+// (by verified email) an existing password-login user, or else a freshly
+// created one with no password set.
+func (s *Service) upsertOAuthUser(provider string, identity *OAuthIdentity) (*users.User, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRow(`SELECT user_id FROM identities WHERE provider = $1 AND subject = $2`, provider, identity.Subject).Scan(&userID)
+
+	switch {
+	case err == sql.ErrNoRows:
+		email := strings.ToLower(identity.Email)
+		err = tx.QueryRow(`SELECT id FROM users WHERE email = $1`, email).Scan(&userID)
+		if err == sql.ErrNoRows {
+			name := identity.Name
+			if name == "" {
+				name = email
+			}
+			userID = uuid.New().String()
+			_, err = tx.Exec(
+				`INSERT INTO users (id, email, password_hash, name, role, created_at, updated_at)
+				 VALUES ($1, $2, '', $3, 'user', NOW(), NOW())`,
+				userID, email, name,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create user: %w", err)
+			}
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to look up user by email: %w", err)
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO identities (user_id, provider, subject, access_token, refresh_token, expires_at)
+			 VALUES ($1, $2, $3, $4, $5, $6)`,
+			userID, provider, identity.Subject, identity.AccessToken, identity.RefreshToken, nullableTime(identity.ExpiresAt),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to link identity: %w", err)
+		}
+
+	case err != nil:
+		return nil, fmt.Errorf("failed to look up identity: %w", err)
+
+	default:
+		_, err = tx.Exec(
+			`UPDATE identities SET access_token = $1, refresh_token = $2, expires_at = $3, updated_at = NOW()
+			 WHERE provider = $4 AND subject = $5`,
+			identity.AccessToken, identity.RefreshToken, nullableTime(identity.ExpiresAt), provider, identity.Subject,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update identity: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.users.FindByID(userID)
+}
+
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
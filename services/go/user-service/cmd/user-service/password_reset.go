@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/homeguard/user-service/pkg/users"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+// forgotPassword starts a password reset if the email belongs to an
+// account, but always returns the same response either way so the endpoint
+// can't be used to enumerate registered emails.
+func (s *Service) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Email != "" {
+		s.startPasswordReset(r.Context(), req.Email)
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"message": "If an account with that email exists, a password reset link has been sent",
+	})
+}
+
+func (s *Service) startPasswordReset(ctx context.Context, email string) {
+	user := &users.User{}
+	query := `SELECT id, email, name FROM users WHERE email = $1`
+	err := s.db.QueryRow(query, strings.ToLower(email)).Scan(&user.ID, &user.Email, &user.Name)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error looking up user for password reset: %v", err)
+		}
+		return
+	}
+
+	token, err := generateResetToken()
+	if err != nil {
+		log.Printf("Error generating reset token: %v", err)
+		return
+	}
+
+	query = `INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	if _, err := s.db.Exec(query, user.ID, hashResetToken(token), time.Now().Add(passwordResetTTL)); err != nil {
+		log.Printf("Error storing password reset token: %v", err)
+		return
+	}
+
+	resetURL := fmt.Sprintf("%s/reset-password?token=%s", s.config.PublicURL, url.QueryEscape(token))
+	body := fmt.Sprintf(
+		"Hi %s,\n\nUse the link below to reset your HomeGuard password. This link expires in 30 minutes.\n\n%s\n\nIf you didn't request this, you can ignore this email.",
+		user.Name, resetURL,
+	)
+
+	if err := s.mailer.Send(ctx, user.Email, "Reset your HomeGuard password", body); err != nil {
+		log.Printf("Error sending password reset email: %v", err)
+	}
+}
+
+// resetPassword consumes a reset token issued by forgotPassword, rotating
+// the account's password hash and invalidating every outstanding refresh
+// token for it.
+func (s *Service) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Token == "" || req.NewPassword == "" {
+		s.errorResponse(w, http.StatusBadRequest, "Token and new password are required")
+		return
+	}
+	if len(req.NewPassword) < 8 {
+		s.errorResponse(w, http.StatusBadRequest, "Password must be at least 8 characters")
+		return
+	}
+
+	var resetID, userID string
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	query := `SELECT id, user_id, expires_at, used_at FROM password_resets WHERE token_hash = $1`
+	err := s.db.QueryRow(query, hashResetToken(req.Token)).Scan(&resetID, &userID, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up password reset token: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	if usedAt.Valid || time.Now().After(expiresAt) {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2`, string(hashedPassword), userID); err != nil {
+		log.Printf("Error updating password: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE password_resets SET used_at = NOW() WHERE id = $1`, resetID); err != nil {
+		log.Printf("Error marking reset token used: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	if _, err := tx.Exec(`DELETE FROM refresh_tokens WHERE user_id = $1`, userID); err != nil {
+		log.Printf("Error invalidating refresh tokens: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	s.audit(r, "user.password_changed", userID, nil)
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{"reset": true})
+}
+
+func generateResetToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	authLoginFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "auth_login_failures_total",
+			Help: "Total number of failed login attempts",
+		},
+	)
+	authRateLimited = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_rate_limited_total",
+			Help: "Total number of requests rejected by auth rate limiting",
+		},
+		[]string{"route"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(authLoginFailures, authRateLimited)
+}
+
+// RateLimiter enforces a sliding-window request limit per key. Two
+// implementations exist: InMemoryRateLimiter for single-instance
+// deployments, and RedisRateLimiter (matching scenario-engine's existing
+// go-redis dependency) for limits shared across replicas.
+type RateLimiter interface {
+	// Allow reports whether the action identified by key is permitted under
+	// limit occurrences per window. If not, the returned duration is how
+	// long until the oldest occurrence in the window expires.
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error)
+}
+
+// InMemoryRateLimiter tracks a sliding window of hit timestamps per key in
+// memory. Fine for a single replica; limits reset on restart and aren't
+// shared across instances.
+type InMemoryRateLimiter struct {
+	mu   sync.Mutex
+	hits map[string][]time.Time
+}
+
+func NewInMemoryRateLimiter() *InMemoryRateLimiter {
+	return &InMemoryRateLimiter{hits: make(map[string][]time.Time)}
+}
+
+func (l *InMemoryRateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-window)
+
+	kept := l.hits[key][:0]
+	for _, t := range l.hits[key] {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+
+	if len(kept) >= limit {
+		l.hits[key] = kept
+		return false, kept[0].Add(window).Sub(now), nil
+	}
+
+	l.hits[key] = append(kept, now)
+	return true, 0, nil
+}
+
+// RedisRateLimiter implements the same sliding window using a per-key
+// sorted set, so the limit is shared across every replica of the service.
+type RedisRateLimiter struct {
+	client *redis.Client
+}
+
+func NewRedisRateLimiter(client *redis.Client) *RedisRateLimiter {
+	return &RedisRateLimiter{client: client}
+}
+
+func (l *RedisRateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	redisKey := "ratelimit:" + key
+	now := time.Now()
+	cutoff := now.Add(-window)
+
+	if err := l.client.ZRemRangeByScore(ctx, redisKey, "0", strconv.FormatInt(cutoff.UnixNano(), 10)).Err(); err != nil {
+		return false, 0, fmt.Errorf("failed to prune rate limit window: %w", err)
+	}
+
+	count, err := l.client.ZCard(ctx, redisKey).Result()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to read rate limit count: %w", err)
+	}
+
+	if count >= int64(limit) {
+		oldest, err := l.client.ZRangeWithScores(ctx, redisKey, 0, 0).Result()
+		if err != nil || len(oldest) == 0 {
+			return false, window, nil
+		}
+		oldestAt := time.Unix(0, int64(oldest[0].Score))
+		return false, oldestAt.Add(window).Sub(now), nil
+	}
+
+	if err := l.client.ZAdd(ctx, redisKey, &redis.Z{Score: float64(now.UnixNano()), Member: uuid.New().String()}).Err(); err != nil {
+		return false, 0, fmt.Errorf("failed to record rate limit hit: %w", err)
+	}
+	l.client.Expire(ctx, redisKey, window)
+
+	return true, 0, nil
+}
+
+// rateLimitByIP builds a middleware that throttles route to limit requests
+// per window per client IP, recording auth_rate_limited_total and setting
+// Retry-After when it fires.
+func (s *Service) rateLimitByIP(route string, limit int, window time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := fmt.Sprintf("ip:%s:%s", route, clientIP(r))
+			allowed, retryAfter, err := s.rateLimiter.Allow(r.Context(), key, limit, window)
+			if err != nil {
+				log.Printf("Error checking rate limit: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !allowed {
+				authRateLimited.WithLabelValues(route).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+				s.errorResponse(w, http.StatusTooManyRequests, "Too many requests, please try again later")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the caller's address, preferring X-Forwarded-For (set by
+// the API gateway/load balancer) over the raw connection's RemoteAddr.
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestInMemoryRateLimiterAllowsUpToLimit(t *testing.T) {
+	l := NewInMemoryRateLimiter()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		allowed, _, err := l.Allow(ctx, "key", 3, time.Minute)
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		if !allowed {
+			t.Fatalf("Allow call %d = false, want true (within limit)", i+1)
+		}
+	}
+
+	allowed, retryAfter, err := l.Allow(ctx, "key", 3, time.Minute)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if allowed {
+		t.Fatal("Allow past the limit = true, want false")
+	}
+	if retryAfter <= 0 {
+		t.Errorf("retryAfter = %v, want a positive duration", retryAfter)
+	}
+}
+
+func TestInMemoryRateLimiterKeysAreIndependent(t *testing.T) {
+	l := NewInMemoryRateLimiter()
+	ctx := context.Background()
+
+	if allowed, _, err := l.Allow(ctx, "a", 1, time.Minute); err != nil || !allowed {
+		t.Fatalf("Allow(a) = %v, %v", allowed, err)
+	}
+	if allowed, _, err := l.Allow(ctx, "a", 1, time.Minute); err != nil || allowed {
+		t.Fatalf("second Allow(a) = %v, %v, want false (limit reached)", allowed, err)
+	}
+	if allowed, _, err := l.Allow(ctx, "b", 1, time.Minute); err != nil || !allowed {
+		t.Fatalf("Allow(b) = %v, %v, want true (independent key)", allowed, err)
+	}
+}
+
+func TestInMemoryRateLimiterWindowExpires(t *testing.T) {
+	l := NewInMemoryRateLimiter()
+	ctx := context.Background()
+	window := 20 * time.Millisecond
+
+	if allowed, _, err := l.Allow(ctx, "key", 1, window); err != nil || !allowed {
+		t.Fatalf("Allow = %v, %v", allowed, err)
+	}
+	if allowed, _, err := l.Allow(ctx, "key", 1, window); err != nil || allowed {
+		t.Fatalf("Allow within the window = %v, %v, want false", allowed, err)
+	}
+
+	time.Sleep(window + 10*time.Millisecond)
+
+	if allowed, _, err := l.Allow(ctx, "key", 1, window); err != nil || !allowed {
+		t.Fatalf("Allow after the window expired = %v, %v, want true", allowed, err)
+	}
+}
+
+func TestClientIPPrefersForwardedFor(t *testing.T) {
+	r := &http.Request{Header: http.Header{}, RemoteAddr: "10.0.0.1:5555"}
+	r.Header.Set("X-Forwarded-For", "203.0.113.5, 10.0.0.1")
+
+	if got := clientIP(r); got != "203.0.113.5" {
+		t.Errorf("clientIP = %q, want %q", got, "203.0.113.5")
+	}
+}
+
+func TestClientIPFallsBackToRemoteAddr(t *testing.T) {
+	r := &http.Request{Header: http.Header{}, RemoteAddr: "10.0.0.1:5555"}
+
+	if got := clientIP(r); got != "10.0.0.1" {
+		t.Errorf("clientIP = %q, want %q", got, "10.0.0.1")
+	}
+}
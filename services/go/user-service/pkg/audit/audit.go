@@ -0,0 +1,136 @@
+// Package audit records security-relevant account events (logins, password
+// changes, token revocations, 2FA and OAuth changes, ...) to an append-only
+// table, giving operators forensic visibility into account activity.
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event is one row of the audit_events table.
+type Event struct {
+	ID           string                 `json:"id"`
+	Timestamp    time.Time              `json:"ts"`
+	ActorUserID  string                 `json:"actor_user_id,omitempty"`
+	ActorIP      string                 `json:"actor_ip,omitempty"`
+	EventType    string                 `json:"event_type"`
+	TargetUserID string                 `json:"target_user_id,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Repository persists and queries audit_events.
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository wraps db for audit event storage.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Record inserts e, filling in its ID and Timestamp as assigned by the
+// database.
+func (r *Repository) Record(e *Event) error {
+	meta, err := json.Marshal(e.Metadata)
+	if err != nil {
+		return fmt.Errorf("marshaling audit metadata: %w", err)
+	}
+
+	query := `
+		INSERT INTO audit_events (actor_user_id, actor_ip, event_type, target_user_id, metadata)
+		VALUES (NULLIF($1, '')::uuid, $2, $3, NULLIF($4, '')::uuid, $5)
+		RETURNING id, ts`
+	return r.db.QueryRow(query, e.ActorUserID, e.ActorIP, e.EventType, e.TargetUserID, meta).Scan(&e.ID, &e.Timestamp)
+}
+
+// Filter narrows a List query. Zero values mean "no filter".
+type Filter struct {
+	// UserID matches events where the user is either the actor or the
+	// target, e.g. both "alice logged in" and "admin deleted alice".
+	UserID string
+	Event  string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+
+	// CursorTS/CursorID resume after the (ts, id) pair returned as
+	// NextCursorTS/NextCursorID by a prior List call, so pagination stays
+	// stable even as new events are inserted concurrently.
+	CursorTS time.Time
+	CursorID string
+}
+
+// Page is one page of a List query, plus the cursor to pass back in Filter
+// to fetch the next page. NextCursorTS is the zero Time once exhausted.
+type Page struct {
+	Events       []*Event
+	NextCursorTS time.Time
+	NextCursorID string
+}
+
+// List returns events matching f, newest first.
+func (r *Repository) List(f Filter) (*Page, error) {
+	limit := f.Limit
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	query := `
+		SELECT id, ts, COALESCE(actor_user_id::text, ''), COALESCE(actor_ip, ''),
+		       event_type, COALESCE(target_user_id::text, ''), metadata
+		FROM audit_events
+		WHERE ($1 = '' OR actor_user_id::text = $1 OR target_user_id::text = $1)
+		  AND ($2 = '' OR event_type = $2)
+		  AND ($3::timestamptz IS NULL OR ts >= $3)
+		  AND ($4::timestamptz IS NULL OR ts <= $4)
+		  AND ($5::timestamptz IS NULL OR (ts, id) < ($5::timestamptz, $6::uuid))
+		ORDER BY ts DESC, id DESC
+		LIMIT $7`
+
+	var since, until, cursorTS interface{}
+	if !f.Since.IsZero() {
+		since = f.Since
+	}
+	if !f.Until.IsZero() {
+		until = f.Until
+	}
+	var cursorID interface{}
+	if !f.CursorTS.IsZero() {
+		cursorTS = f.CursorTS
+		cursorID = f.CursorID
+	}
+
+	rows, err := r.db.Query(query, f.UserID, f.Event, since, until, cursorTS, cursorID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &Page{}
+	for rows.Next() {
+		e := &Event{}
+		var meta []byte
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.ActorUserID, &e.ActorIP, &e.EventType, &e.TargetUserID, &meta); err != nil {
+			return nil, err
+		}
+		if len(meta) > 0 {
+			if err := json.Unmarshal(meta, &e.Metadata); err != nil {
+				return nil, fmt.Errorf("unmarshaling audit metadata: %w", err)
+			}
+		}
+		page.Events = append(page.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Events) == limit {
+		last := page.Events[len(page.Events)-1]
+		page.NextCursorTS = last.Timestamp
+		page.NextCursorID = last.ID
+	}
+	return page, nil
+}
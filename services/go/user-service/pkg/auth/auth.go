@@ -0,0 +1,147 @@
+// Package auth provides the JWT claims, token generation/validation, and
+// HTTP middleware shared by every service that needs to authenticate
+// HomeGuard access tokens. User-service issues these tokens; other services
+// (api-gateway, scenario-engine) import this package to verify them the
+// same way instead of re-implementing JWT parsing themselves.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Issuer is the "iss" claim user-service stamps on every access token it
+// issues; tokens from anywhere else are rejected.
+const Issuer = "homeguard-api"
+
+// Claims are the JWT claims carried by a HomeGuard access token.
+type Claims struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// GenerateToken signs a new access token for the given identity, valid for
+// ttl, with a fresh jti so it can later be revoked individually.
+func GenerateToken(secret, userID, email, role string, ttl time.Duration) (string, error) {
+	claims := &Claims{
+		UserID: userID,
+		Email:  email,
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    Issuer,
+			ID:        uuid.New().String(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// ParseToken validates tokenString's signature, expiry, and issuer, and
+// returns its claims.
+func ParseToken(tokenString, secret string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return []byte(secret), nil
+	})
+	if err != nil || !token.Valid || claims.Issuer != Issuer {
+		return nil, fmt.Errorf("invalid or expired token")
+	}
+	return claims, nil
+}
+
+type contextKey string
+
+const claimsContextKey contextKey = "claims"
+
+// ClaimsFromContext returns the Claims a Middleware call stored on ctx, or
+// nil if none are present.
+func ClaimsFromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(claimsContextKey).(*Claims)
+	return claims
+}
+
+// RevocationChecker reports whether a token's jti has already been
+// revoked (e.g. by logout). Callers with no revocation store can pass nil.
+type RevocationChecker func(jti string) bool
+
+// Middleware parses and validates the Authorization: Bearer JWT, rejecting
+// requests with a missing, malformed, expired, or revoked token, and
+// injects the parsed Claims into the request context for downstream
+// handlers.
+func Middleware(secret string, isRevoked RevocationChecker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if !strings.HasPrefix(header, "Bearer ") {
+				writeUnauthorized(w, "Missing bearer token")
+				return
+			}
+			tokenString := strings.TrimPrefix(header, "Bearer ")
+
+			claims, err := ParseToken(tokenString, secret)
+			if err != nil {
+				writeUnauthorized(w, "Invalid or expired token")
+				return
+			}
+
+			if isRevoked != nil && isRevoked(claims.ID) {
+				writeUnauthorized(w, "Token has been revoked")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireRole builds a middleware that rejects requests whose Claims (as
+// stored by Middleware) don't carry one of roles.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		allowed[role] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := ClaimsFromContext(r.Context())
+			if claims == nil || !allowed[claims.Role] {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"error":   true,
+					"message": "Insufficient permissions",
+					"status":  http.StatusForbidden,
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":   true,
+		"message": message,
+		"status":  http.StatusUnauthorized,
+	})
+}
@@ -0,0 +1,52 @@
+// Package httpx holds the small HTTP helpers shared across the user
+// service's handlers: consistent JSON responses and request logging.
+package httpx
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// JSON writes data as a JSON response body with the given status code.
+func JSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// Error writes a standard {error, message, status} JSON error body.
+func Error(w http.ResponseWriter, status int, message string) {
+	JSON(w, status, map[string]interface{}{
+		"error":   true,
+		"message": message,
+		"status":  status,
+	})
+}
+
+// LoggingMiddleware logs the method, path, response status, and latency of
+// every request it handles.
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(lw, r)
+
+		log.Printf("%s %s %d %s", r.Method, r.URL.Path, lw.status, time.Since(start))
+	})
+}
+
+// statusWriter captures the status code passed to WriteHeader so
+// LoggingMiddleware can log it after the handler has already written the
+// response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,51 @@
+// Package migrate applies the user service's SQL schema as a sequence of
+// versioned goose migrations, embedded into the binary so the service never
+// depends on a migrations/ directory being present on disk at runtime.
+package migrate
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+
+	"github.com/pressly/goose/v3"
+)
+
+//go:embed migrations/*.sql
+var embedded embed.FS
+
+// Dir is the path goose tracks migrations under, relative to the embedded
+// filesystem root.
+const Dir = "migrations"
+
+func init() {
+	goose.SetBaseFS(embedded)
+	if err := goose.SetDialect("postgres"); err != nil {
+		panic(fmt.Sprintf("migrate: %v", err))
+	}
+}
+
+// Up applies every pending migration.
+func Up(db *sql.DB) error {
+	return goose.Up(db, Dir)
+}
+
+// Down rolls back the most recently applied migration.
+func Down(db *sql.DB) error {
+	return goose.Down(db, Dir)
+}
+
+// Status prints the current migration status to stdout.
+func Status(db *sql.DB) error {
+	return goose.Status(db, Dir)
+}
+
+// Create writes a new, empty timestamped migration file to the on-disk
+// migrations/ directory so it can be filled in and committed. This operates
+// against the real filesystem rather than the embedded copy used by Up/Down,
+// since the embedded copy is fixed at build time.
+func Create(name string) error {
+	goose.SetBaseFS(nil)
+	defer goose.SetBaseFS(embedded)
+	return goose.Create(nil, Dir, name, "sql")
+}
@@ -0,0 +1,91 @@
+// Package users holds the User model and its database-backed repository.
+package users
+
+import (
+	"database/sql"
+	"time"
+)
+
+// User represents a user in the system.
+type User struct {
+	ID           string    `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	Name         string    `json:"name"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Repository provides CRUD access to the users table.
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository builds a Repository backed by db.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Create inserts u.
+func (r *Repository) Create(u *User) error {
+	query := `INSERT INTO users (id, email, password_hash, name, role, created_at, updated_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.Exec(query, u.ID, u.Email, u.PasswordHash, u.Name, u.Role, u.CreatedAt, u.UpdatedAt)
+	return err
+}
+
+// FindByEmail looks up a user by email, including its password hash.
+func (r *Repository) FindByEmail(email string) (*User, error) {
+	u := &User{}
+	query := `SELECT id, email, password_hash, name, role, created_at, updated_at FROM users WHERE email = $1`
+	err := r.db.QueryRow(query, email).Scan(
+		&u.ID, &u.Email, &u.PasswordHash, &u.Name, &u.Role, &u.CreatedAt, &u.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// FindByID looks up a user by id, without its password hash.
+func (r *Repository) FindByID(id string) (*User, error) {
+	u := &User{}
+	query := `SELECT id, email, name, role, created_at, updated_at FROM users WHERE id = $1`
+	err := r.db.QueryRow(query, id).Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// List returns every user, ordered newest first, without password hashes.
+func (r *Repository) List() ([]*User, error) {
+	rows, err := r.db.Query(`SELECT id, email, name, role, created_at, updated_at FROM users ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*User, 0)
+	for rows.Next() {
+		u := &User{}
+		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// UpdateName sets the name of the user identified by id.
+func (r *Repository) UpdateName(id, name string) error {
+	_, err := r.db.Exec(`UPDATE users SET name = $1, updated_at = NOW() WHERE id = $2`, name, id)
+	return err
+}
+
+// Delete removes the user identified by id.
+func (r *Repository) Delete(id string) error {
+	_, err := r.db.Exec(`DELETE FROM users WHERE id = $1`, id)
+	return err
+}